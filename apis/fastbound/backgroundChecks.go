@@ -0,0 +1,189 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/storage"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// form4473CompletedStatus is the status Fastbound reports for a 4473 that is finished and safe to archive
+const form4473CompletedStatus = "Completed"
+
+// form4473PageSize is how many 4473s are asked for in each page of the list. Tests lower it to exercise paging.
+var form4473PageSize = 100
+
+// Form4473 A completed 4473 as listed by the Fastbound API
+type Form4473 struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// BackgroundCheckResults A summary of a DownloadBackgroundChecks run
+type BackgroundCheckResults struct {
+	Downloaded []string // Locations of the 4473s saved during this run
+	Skipped    int      // Count of 4473s that had already been downloaded
+	Failed     int      // Count of 4473s that could not be downloaded
+	Rejected   int      // Count of 4473s that were downloaded but failed validation and were quarantined
+}
+
+// DownloadBackgroundChecks downloads every completed 4473 from the Fastbound API into destination that has not already been saved.
+// Cancelling ctx stops it before the next 4473, returning the results so far with the context's error.
+func (c *Client) DownloadBackgroundChecks(ctx context.Context, destination storage.Backend) (BackgroundCheckResults, error) {
+	var results BackgroundCheckResults
+
+	// Get the list of completed 4473s for this account
+	forms, err := c.ListCompletedForm4473s(ctx)
+	if err != nil {
+		c.reportFailure(err)
+		return results, err
+	}
+
+	// A completed 4473 never changes, so one already downloaded is skipped without asking Fastbound for it again
+	downloadedForms, err := downloadedForm4473s(ctx, destination)
+	if err != nil {
+		c.reportFailure(err)
+		return results, err
+	}
+
+	// Download each 4473 separately so one failed file does not fail the rest
+	for _, form := range forms {
+		// A download cut short by shutting down did not fail, so neither it nor the rest are counted
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		savedPath, err := c.downloadForm4473(ctx, form.ID, destination, downloadedForms)
+		if err != nil && ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+		if err != nil {
+			c.reportFailure(err)
+		}
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			log.Printf("Rejected 4473 %s: %v\n", form.ID, err)
+			results.Rejected++
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to download 4473 %s: %v\n", form.ID, err)
+			results.Failed++
+			continue
+		}
+		if savedPath == "" {
+			results.Skipped++
+			continue
+		}
+		results.Downloaded = append(results.Downloaded, savedPath)
+	}
+	return results, nil
+}
+
+// ListCompletedForm4473s returns the 4473s the Fastbound API reports as completed, following every page of the list
+func (c *Client) ListCompletedForm4473s(ctx context.Context) ([]Form4473, error) {
+
+	// Define a struct to hold the API's JSON response.
+	type listApiResponse struct {
+		Forms []Form4473 `json:"forms"`
+	}
+
+	var completedForms []Form4473
+	listed := make(map[string]bool)
+	for skip := 0; ; skip += form4473PageSize {
+		query := url.Values{}
+		query.Set("status", form4473CompletedStatus)
+		query.Set("skip", strconv.Itoa(skip))
+		query.Set("take", strconv.Itoa(form4473PageSize))
+		var apiResponse listApiResponse
+		if err := c.doJSON(ctx, "GET", "api/4473s?"+query.Encode(), &apiResponse); err != nil {
+			return nil, err
+		}
+
+		newForms := 0
+		for _, form := range apiResponse.Forms {
+			if form.ID == "" || listed[form.ID] {
+				continue
+			}
+			listed[form.ID] = true
+			newForms++
+			// Only keep forms that are actually completed in case the API ignores the status filter
+			if strings.EqualFold(form.Status, form4473CompletedStatus) {
+				completedForms = append(completedForms, form)
+			}
+		}
+		// A short page is the last one, and a page of forms already listed means the API ignored the paging
+		if len(apiResponse.Forms) < form4473PageSize || newForms == 0 {
+			return completedForms, nil
+		}
+	}
+}
+
+// downloadedForm4473s returns the key of every 4473 the manifest in destination records, by form ID
+func downloadedForm4473s(ctx context.Context, destination storage.Backend) (map[string]string, error) {
+	entries, err := readManifest(ctx, destination)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]string)
+	for _, entry := range entries {
+		if entry.FormID != "" {
+			keys[entry.FormID] = entry.FileName
+		}
+	}
+	return keys, nil
+}
+
+// findExistingForm4473 returns the key of a previous download of the 4473 formID in destination, or nothing if there is
+// none. 4473s are found through the manifest, or where the layout would put a 4473 downloaded before form IDs were
+// recorded, which Fastbound names after its form ID.
+func (c *Client) findExistingForm4473(ctx context.Context, destination storage.Backend, formID string, downloadedForms map[string]string, now time.Time) (string, error) {
+	if key, ok := downloadedForms[formID]; ok {
+		if _, err := destination.Stat(ctx, key); err == nil {
+			return key, nil
+		}
+	}
+	if c.layout.usesHash {
+		return "", nil
+	}
+	expectedKey, err := c.layout.render(c.layout.values(c.accountNumber, formID+".pdf", now, ""))
+	if err != nil {
+		return "", err
+	}
+	_, err = destination.Stat(ctx, expectedKey)
+	if errors.Is(err, storage.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to check if a file for %s exists already: %w", destination.Location(expectedKey), err)
+	}
+	return expectedKey, nil
+}
+
+// downloadForm4473 downloads a single 4473 PDF into destination and returns the location of the saved file, or nothing
+// if it had already been downloaded
+func (c *Client) downloadForm4473(ctx context.Context, formID string, destination storage.Backend, downloadedForms map[string]string) (string, error) {
+	existingKey, err := c.findExistingForm4473(ctx, destination, formID, downloadedForms, time.Now())
+	if err != nil {
+		return "", err
+	}
+	if existingKey != "" {
+		log.Printf("%s has already been downloaded. Skipping download.", destination.Location(existingKey))
+		return "", nil
+	}
+
+	downloadURL, err := c.requestDownloadURL(ctx, fmt.Sprintf("api/Downloads/4473/%s", url.PathEscape(formID)))
+	if err != nil {
+		return "", err
+	}
+	saved, err := c.downloadFile(ctx, downloadURL, formID, destination)
+	return saved.Location, err
+}
@@ -0,0 +1,204 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/storage"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDownloadBackgroundChecks validates the DownloadBackgroundChecks function
+func TestDownloadBackgroundChecks(t *testing.T) {
+	// Track which 4473s the mock server was asked for download URLs for and to download
+	requestedForms := map[string]int{}
+	downloadedForms := map[string]int{}
+	// Create a mock server to simulate the Fastbound API
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Return a list with two completed 4473s and one that is still in progress
+		if r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/api/4473s") {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, err := fmt.Fprint(w, `{"forms": [
+				{"id": "FORM-1", "status": "Completed"},
+				{"id": "FORM-2", "status": "Completed"},
+				{"id": "FORM-3", "status": "InProgress"}
+			]}`)
+			if err != nil {
+				t.Fatalf("Mock server failed to write response: %v", err)
+			}
+			return
+		}
+		// Return a download URL for the requested 4473
+		if r.Method == "POST" && strings.Contains(r.URL.Path, "/api/Downloads/4473/") {
+			formID := filepath.Base(r.URL.Path)
+			requestedForms[formID]++
+			responseURL := "http://" + r.Host + "/download/" + formID + ".pdf"
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			_, err := fmt.Fprintf(w, `{"url": "%s"}`, responseURL)
+			if err != nil {
+				t.Fatalf("Mock server failed to write response: %v", err)
+			}
+			return
+		}
+		// Serve the 4473 PDF itself, or only its headers to compare with an existing file
+		if (r.Method == "GET" || r.Method == "HEAD") && strings.HasPrefix(r.URL.Path, "/download/") {
+			if r.Method == "GET" {
+				downloadedForms[filepath.Base(r.URL.Path)]++
+			}
+			w.WriteHeader(http.StatusOK)
+			_, err := w.Write(mockPDF)
+			if err != nil {
+				t.Fatalf("Mock server failed to write file content: %v", err)
+			}
+			return
+		}
+		// Return a 404 if the request doesn't match any of the above
+		t.Errorf("Mock server received unexpected request: %s %s", r.Method, r.URL.Path)
+		http.NotFound(w, r)
+	}))
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	// Create a test client pointed at our mockServer instead of the real API
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com")
+
+	// Pre-create FORM-2 so it is detected as already downloaded
+	existingFile := filepath.Join(tempDir, "FORM-2.pdf")
+	if err := os.WriteFile(existingFile, mockPDF, 0644); err != nil {
+		t.Fatalf("Failed to create pre-existing file: %v", err)
+	}
+
+	results, err := testClient.DownloadBackgroundChecks(context.Background(), storage.NewLocal(tempDir))
+	if err != nil {
+		t.Fatalf("DownloadBackgroundChecks() returned an unexpected error: %v", err)
+	}
+
+	// Only FORM-1 should have been downloaded
+	expectedFile := filepath.Join(tempDir, "FORM-1.pdf")
+	if len(results.Downloaded) != 1 || results.Downloaded[0] != expectedFile {
+		t.Errorf("Expected only '%s' to be downloaded, but got %v", expectedFile, results.Downloaded)
+	}
+	if results.Skipped != 1 {
+		t.Errorf("Expected 1 skipped 4473, but got %d", results.Skipped)
+	}
+	if results.Failed != 0 {
+		t.Errorf("Expected 0 failed 4473s, but got %d", results.Failed)
+	}
+	if _, err := os.Stat(expectedFile); os.IsNotExist(err) {
+		t.Errorf("Expected file to be created, but it was not: %s", expectedFile)
+	}
+
+	// The in-progress and already downloaded 4473s should never be fetched
+	if downloadedForms["FORM-2.pdf"] > 0 || downloadedForms["FORM-3.pdf"] > 0 {
+		t.Errorf("Expected FORM-2 and FORM-3 to be skipped, but got downloads %v", downloadedForms)
+	}
+	if requestedForms["FORM-2"] > 0 || requestedForms["FORM-3"] > 0 {
+		t.Errorf("Expected no download URL to be requested for FORM-2 or FORM-3, but got %v", requestedForms)
+	}
+
+	// The manifest records the form ID, so the next run skips FORM-1 without asking Fastbound for it again
+	entries, err := readManifest(context.Background(), storage.NewLocal(tempDir))
+	if err != nil || len(entries) != 1 || entries[0].FormID != "FORM-1" {
+		t.Fatalf("Expected the manifest to record FORM-1, but got %+v (%v)", entries, err)
+	}
+	if err := os.Rename(expectedFile, filepath.Join(tempDir, "RENAMED_BY_LAYOUT.pdf")); err != nil {
+		t.Fatalf("Failed to move downloaded file: %v", err)
+	}
+	entries[0].FileName = "RENAMED_BY_LAYOUT.pdf"
+	line, err := json.Marshal(entries[0])
+	if err != nil {
+		t.Fatalf("Failed to encode manifest entry: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, ManifestFileName), append(line, '\n'), 0644); err != nil {
+		t.Fatalf("Failed to rewrite manifest: %v", err)
+	}
+	results, err = testClient.DownloadBackgroundChecks(context.Background(), storage.NewLocal(tempDir))
+	if err != nil || len(results.Downloaded) != 0 || results.Skipped != 2 {
+		t.Errorf("Expected both 4473s to be skipped on the next run, but got %+v (%v)", results, err)
+	}
+	if requestedForms["FORM-1"] != 1 {
+		t.Errorf("Expected one download URL request for FORM-1, but got %d", requestedForms["FORM-1"])
+	}
+}
+
+// TestListCompletedForm4473s_Pages validates that every page of completed 4473s is listed
+func TestListCompletedForm4473s_Pages(t *testing.T) {
+	previousPageSize := form4473PageSize
+	form4473PageSize = 2
+	defer func() {
+		form4473PageSize = previousPageSize
+	}()
+
+	pages := map[string]string{
+		"0": `{"forms": [{"id": "FORM-1", "status": "Completed"}, {"id": "FORM-2", "status": "InProgress"}]}`,
+		"2": `{"forms": [{"id": "FORM-3", "status": "Completed"}]}`,
+	}
+	var requestedPages []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("status") != "Completed" || query.Get("take") != "2" {
+			t.Errorf("Unexpected list query: %s", r.URL.RawQuery)
+		}
+		requestedPages = append(requestedPages, query.Get("skip"))
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := fmt.Fprint(w, pages[query.Get("skip")]); err != nil {
+			t.Fatalf("Mock server failed to write response: %v", err)
+		}
+	}))
+	defer mockServer.Close()
+
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com")
+	forms, err := testClient.ListCompletedForm4473s(context.Background())
+	if err != nil {
+		t.Fatalf("ListCompletedForm4473s() returned an unexpected error: %v", err)
+	}
+	if len(forms) != 2 || forms[0].ID != "FORM-1" || forms[1].ID != "FORM-3" {
+		t.Errorf("Expected the completed 4473s from both pages, but got %+v", forms)
+	}
+	if strings.Join(requestedPages, ",") != "0,2" {
+		t.Errorf("Expected two pages to be requested, but got %v", requestedPages)
+	}
+}
+
+// TestDownloadBackgroundChecks_Shutdown validates that shutting down stops at the next 4473 without counting failures
+func TestDownloadBackgroundChecks_Shutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/api/4473s"):
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprint(w, `{"forms": [{"id": "FORM-1", "status": "Completed"}, {"id": "FORM-2", "status": "Completed"}]}`)
+		case r.Method == "POST" && strings.Contains(r.URL.Path, "/api/Downloads/4473/"):
+			// Shutting down while the first 4473 is being requested
+			cancel()
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"url": "%s"}`, "http://"+r.Host+"/download/"+filepath.Base(r.URL.Path)+".pdf")
+		default:
+			_, _ = w.Write(mockPDF)
+		}
+	}))
+	defer mockServer.Close()
+
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com")
+	results, err := testClient.DownloadBackgroundChecks(ctx, storage.NewLocal(t.TempDir()))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the shutdown to be returned, but got %v", err)
+	}
+	if results.Failed != 0 || results.Rejected != 0 || len(results.Downloaded) != 0 {
+		t.Errorf("Expected nothing to be counted after shutting down, but got %+v", results)
+	}
+}
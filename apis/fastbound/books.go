@@ -7,117 +7,243 @@ package fastbound
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/route1337/fastbound-downloader/apis/fbdownloader_settings"
+	"github.com/route1337/fastbound-downloader/ledger"
+	"github.com/route1337/fastbound-downloader/metrics"
+	"github.com/route1337/fastbound-downloader/storage"
 	"io"
 	"log"
-	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
+	"path"
+	"strings"
 	"time"
 )
 
-// DownloadBoundBook downloads the latest A&D book from the Fastbound API and return the path of the saved file
-func DownloadBoundBook(apiBase string, config fbdownloader_settings.FBDConfig) (string, error) {
-
-	// Define a struct to hold the API's JSON response.
-	type downloadApiResponse struct {
-		URL string `json:"url"`
+// DownloadBoundBook downloads the latest A&D book from the Fastbound API into destination and returns the location of the saved file
+func (c *Client) DownloadBoundBook(ctx context.Context, destination storage.Backend) (string, error) {
+	// Ask the API for a download URL for the latest bound book
+	downloadURL, err := c.requestDownloadURL(ctx, "api/Downloads/BoundBook")
+	if err != nil {
+		c.reportFailure(err)
+		return "", err
 	}
 
-	// Craft the API URL and set up a Context
-	apiURL := fmt.Sprintf("%s/%s/api/Downloads/BoundBook", apiBase, config.Fastbound.AccountNumber)
-	apiContext, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-	client := &http.Client{}
-
-	// Create a new HTTP request with context.
-	postRequest, err := http.NewRequestWithContext(apiContext, "POST", apiURL, nil)
+	saved, err := c.downloadFile(ctx, downloadURL, "", destination)
 	if err != nil {
-		return "", fmt.Errorf("failed to create API POST request: %w", err)
+		c.reportFailure(err)
+		return "", err
 	}
+	if saved.Location != "" {
+		metrics.LastBookSizeBytes.WithLabelValues(c.accountNumber).Set(float64(saved.Size))
+	}
+	return saved.Location, nil
+}
 
-	postRequest.SetBasicAuth(config.Fastbound.ApiKey, config.Fastbound.ApiKey)
-	postRequest.Header.Set("accept", "application/json")
-	postRequest.Header.Set("X-AuditUser", config.Fastbound.AuditUser)
+// savedFile Where a downloaded file was stored and its size. A blank Location means the file had already been downloaded.
+type savedFile struct {
+	Location string
+	Size     int64
+}
 
-	// Execute the request using a default HTTP client.
-	postResponse, err := client.Do(postRequest)
+// downloadFile downloads downloadURL into destination, under the key chosen by the Client's Layout, and returns where it was
+// saved. formID is recorded in the manifest for a 4473 and blank for a bound book.
+func (c *Client) downloadFile(ctx context.Context, downloadURL string, formID string, destination storage.Backend) (savedFile, error) {
+	// Extract file name from URL
+	parsedUrl, err := url.Parse(downloadURL)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute POST request: %w", err)
+		return savedFile{}, fmt.Errorf("failed to parse download URL: %w", err)
 	}
-	defer func() {
-		if err := postResponse.Body.Close(); err != nil {
-			log.Printf("Warning: failed to close postResponse body: %v", err)
-		}
-	}()
+	downloadedFile := path.Base(parsedUrl.Path)
 
-	// Read the response status code and fail out with any errors
-	if postResponse.StatusCode != http.StatusOK {
-		errorBody, _ := io.ReadAll(postResponse.Body)
-		return "", fmt.Errorf("api request failed with status %d: %s", postResponse.StatusCode, string(errorBody))
+	// Validate the file has not already been downloaded, and log if it has. A previous download only counts if it still
+	// matches what Fastbound is serving, otherwise the file is downloaded again under a new name.
+	existing, err := c.findExistingDownload(ctx, destination, downloadedFile, time.Now())
+	if err != nil {
+		return savedFile{}, err
 	}
-	// Decode the JSON response from the POST request
-	var apiResponse downloadApiResponse
-	if err := json.NewDecoder(postResponse.Body).Decode(&apiResponse); err != nil {
-		return "", fmt.Errorf("failed to decode JSON response: %w", err)
+	comparison := remoteUnknown
+	if existing != nil {
+		var reason string
+		if comparison, reason, err = c.compareWithRemote(ctx, downloadURL, existing); err != nil {
+			return savedFile{}, err
+		}
+		switch comparison {
+		case remoteMatches:
+			log.Printf("%s has already been downloaded. Skipping download.", destination.Location(existing.Key))
+			return savedFile{}, nil // A blank location can indicate to other functions that we already have this file
+		case remoteDiffers:
+			c.reportMismatch(destination, existing, reason)
+		}
 	}
-	if apiResponse.URL == "" {
-		return "", fmt.Errorf("API response did not contain a download URL")
+
+	// Download to a local temporary file first so nothing is stored until the whole file has arrived and been checked
+	storeFile, err := createPartialFile(c.stagingDir)
+	if err != nil {
+		return savedFile{}, err
 	}
+	defer storeFile.abort()
 
-	// Extract file name from URL
-	parsedUrl, err := url.Parse(apiResponse.URL)
+	// Download the file from the provided URL. This is a storage URL, so no API credentials are sent.
+	downloadStarted := time.Now()
+	download, err := c.streamDownload(ctx, downloadURL, storeFile)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse download URL: %w", err)
+		return savedFile{}, fmt.Errorf("failed to download %s: %w", downloadedFile, err)
 	}
-	downloadedBook := filepath.Base(parsedUrl.Path)
-	// Set a destination path and create a file to store there
-	destinationPath := filepath.Join(config.Paths.BoundBooks, downloadedBook)
+	metrics.DownloadDurationSeconds.WithLabelValues(c.accountNumber).Observe(time.Since(downloadStarted).Seconds())
+	metrics.DownloadedBytesTotal.WithLabelValues(c.accountNumber).Add(float64(download.Size))
+	written, sha256Hex := download.Size, download.SHA256
 
-	// Validate the file does not already exist, and log if it does
-	if _, err := os.Stat(destinationPath); err == nil {
-		log.Printf("%s has already been downloaded. Skipping download.", destinationPath)
-		return "", nil // A blank destinationPath can indicate to other functions that we already have this file
-	} else if !os.IsNotExist(err) {
-		// An error other than the file existing already occurred.
-		return "", fmt.Errorf("failed to check if a file for %s exists already: %w", destinationPath, err)
+	// Only accept the file if it is a complete PDF, otherwise move it aside for inspection
+	if err := validatePDF(storeFile, written, download.Header); err != nil {
+		return savedFile{}, c.quarantine(storeFile, downloadedFile, err)
 	}
 
-	// Download the file from the provided URL
-	downloadRequest, err := http.NewRequestWithContext(apiContext, "GET", apiResponse.URL, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create GET request for download: %w", err)
+	// Without headers to compare, a previous download is compared by hash now that the whole file is here
+	if existing != nil && comparison == remoteUnknown {
+		recordedHash, err := existing.recordedHash(ctx, destination)
+		if err != nil {
+			return savedFile{}, err
+		}
+		if recordedHash == sha256Hex {
+			log.Printf("%s has already been downloaded. Skipping download.", destination.Location(existing.Key))
+			return savedFile{}, nil
+		}
+		c.reportMismatch(destination, existing, fmt.Sprintf("SHA-256 changed from %s to %s", recordedHash, sha256Hex))
 	}
-	downloadResponse, err := client.Do(downloadRequest)
+
+	// Now that the hash is known, work out where the layout puts the file
+	downloadedAt := time.Now().UTC()
+	key, err := c.layout.render(c.layout.values(c.accountNumber, downloadedFile, downloadedAt, sha256Hex))
 	if err != nil {
-		return "", fmt.Errorf("failed to download file from URL: %w", err)
+		return savedFile{}, err
+	}
+	if key, err = availableKey(ctx, destination, key); err != nil {
+		return savedFile{}, err
 	}
+
+	// Write the checksum and signature before the file itself so a saved file is never missing either, and remove them
+	// again if the file isn't saved so they never describe a file that isn't there
+	stored := false
 	defer func() {
-		if err := downloadResponse.Body.Close(); err != nil {
-			log.Printf("Warning: failed to close downloadResponse body: %v", err)
+		if !stored {
+			c.removeSidecars(ctx, destination, key)
 		}
 	}()
+	if err := writeChecksumFile(ctx, destination, key, sha256Hex); err != nil {
+		return savedFile{}, err
+	}
+	if err := c.writeSignatureFile(ctx, destination, key, storeFile); err != nil {
+		return savedFile{}, err
+	}
+	if _, err := storeFile.Seek(0, io.SeekStart); err != nil {
+		return savedFile{}, fmt.Errorf("failed to rewind %s: %w", storeFile.Name(), err)
+	}
+	if err := storage.PutRecord(ctx, destination, key, storeFile, written); err != nil {
+		return savedFile{}, fmt.Errorf("failed to store %s: %w", downloadedFile, err)
+	}
+	stored = true
+	err = appendManifestEntry(ctx, destination, ManifestEntry{
+		FileName:      key,
+		OriginalName:  downloadedFile,
+		FormID:        formID,
+		Size:          written,
+		SHA256:        sha256Hex,
+		ETag:          download.ETag,
+		DownloadedAt:  downloadedAt,
+		AccountNumber: c.accountNumber,
+		AuditUser:     c.auditUser,
+	})
+	if err != nil {
+		return savedFile{}, err
+	}
+	// Link the download into the tamper-evident ledger
+	_, err = ledger.Append(ctx, destination, ledger.Entry{
+		RecordedAt:    downloadedAt,
+		FileName:      key,
+		Size:          written,
+		SHA256:        sha256Hex,
+		AccountNumber: c.accountNumber,
+		AuditUser:     c.auditUser,
+	})
+	if err != nil {
+		return savedFile{}, err
+	}
 
-	if downloadResponse.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("file download failed with status %d", downloadResponse.StatusCode)
+	metrics.LastDownloadTimestampSeconds.WithLabelValues(c.accountNumber).Set(float64(downloadedAt.Unix()))
+	return savedFile{Location: destination.Location(key), Size: written}, nil
+}
+
+// removeSidecars deletes the checksum and signature written for key when the file itself could not be stored
+func (c *Client) removeSidecars(ctx context.Context, destination storage.Backend, key string) {
+	// Use a fresh context so the sidecars of a cancelled download are still removed
+	cleanupContext, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	sidecars := []string{key + ChecksumFileSuffix}
+	if c.signer != nil {
+		sidecars = append(sidecars, key+c.signer.FileSuffix())
 	}
-	storeFile, err := os.Create(destinationPath)
+	for _, sidecar := range sidecars {
+		if err := destination.Delete(cleanupContext, sidecar); err != nil {
+			log.Printf("Warning: failed to remove %s after the file it describes was not stored: %v", destination.Location(sidecar), err)
+		}
+	}
+}
+
+// findExistingDownload returns the latest previous download of originalName in destination, or nil if there is none.
+// Files are found through the manifest, or where the layout would put them today if the manifest doesn't list them.
+func (c *Client) findExistingDownload(ctx context.Context, destination storage.Backend, originalName string, now time.Time) (*existingDownload, error) {
+	entries, err := readManifest(ctx, destination)
 	if err != nil {
-		return "", fmt.Errorf("failed to save bound book file: %w", err)
+		return nil, err
 	}
-	defer func() {
-		if err := storeFile.Close(); err != nil {
-			log.Printf("Warning: failed to close storeFile: %v", err)
+	// A file downloaded again after it changed is listed after the copy it replaced, so the latest copy is found first
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.originalName() != originalName {
+			continue
 		}
-	}()
+		if _, err := destination.Stat(ctx, entry.FileName); err == nil {
+			return &existingDownload{Key: entry.FileName, Size: entry.Size, SHA256: entry.SHA256, ETag: entry.ETag}, nil
+		}
+	}
 
-	// Stream the file contents to the new file
-	if _, err := io.Copy(storeFile, downloadResponse.Body); err != nil {
-		return "", fmt.Errorf("failed to write the bound book file: %w", err)
+	// The hash isn't known before downloading, so layouts that use it can only be checked through the manifest
+	if c.layout.usesHash {
+		return nil, nil
+	}
+	expectedKey, err := c.layout.render(c.layout.values(c.accountNumber, originalName, now, ""))
+	if err != nil {
+		return nil, err
+	}
+	info, err := destination.Stat(ctx, expectedKey)
+	if errors.Is(err, storage.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		// An error other than the file not existing occurred.
+		return nil, fmt.Errorf("failed to check if a file for %s exists already: %w", destination.Location(expectedKey), err)
+	}
+	// Files the manifest doesn't list were saved before manifests existed, and only their stored size is known. The stored
+	// size of an encrypted file says nothing about its contents, so it is compared by hash instead.
+	size := info.Size
+	if info.Encrypted {
+		size = -1
 	}
+	return &existingDownload{Key: expectedKey, Size: size}, nil
+}
 
-	return destinationPath, nil
+// availableKey returns key, or key with a numbered suffix if something is already stored under it
+func availableKey(ctx context.Context, destination storage.Backend, key string) (string, error) {
+	// Never overwrite an archived file. Layouts that map several files to one name get a numbered suffix instead.
+	extension := path.Ext(key)
+	baseKey := strings.TrimSuffix(key, extension)
+	candidate := key
+	for suffix := 2; ; suffix++ {
+		if _, err := destination.Stat(ctx, candidate); errors.Is(err, storage.ErrNotExist) {
+			return candidate, nil
+		} else if err != nil {
+			return "", fmt.Errorf("failed to check if %s exists already: %w", destination.Location(candidate), err)
+		}
+		candidate = fmt.Sprintf("%s-%d%s", baseKey, suffix, extension)
+	}
 }
@@ -6,8 +6,12 @@ This file is part of Fastbound Downloader.
 package fastbound
 
 import (
+	"context"
 	"fmt"
-	"github.com/route1337/fastbound-downloader/apis/fbdownloader_settings"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/route1337/fastbound-downloader/ledger"
+	"github.com/route1337/fastbound-downloader/storage"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -36,8 +40,8 @@ func TestDownloadBoundBook(t *testing.T) {
 		// Request the download of the mocked bound book
 		if r.Method == "GET" && r.URL.Path == "/download/MOCK_BOUND_BOOK.pdf" {
 			w.WriteHeader(http.StatusOK)
-			// We're writing some dummy data here
-			_, err := w.Write([]byte(`"Guns. Lots of guns."`))
+			// We're writing a small but valid PDF here
+			_, err := w.Write(mockPDF)
 			if err != nil {
 				t.Fatalf("Mock server failed to write file content: %v", err)
 			}
@@ -50,28 +54,11 @@ func TestDownloadBoundBook(t *testing.T) {
 	defer mockServer.Close()
 
 	tempDir := t.TempDir()
-	// Create a test config for use with function calls
-	testConfig := fbdownloader_settings.FBDConfig{
-		Fastbound: struct {
-			AccountNumber string `json:"account-number"`
-			ApiKey        string `json:"api-key"`
-			AuditUser     string `json:"audit-user"`
-		}{
-			AccountNumber: "123456",
-			ApiKey:        "kkJ4K3dHoHqZzNvoDJ",
-			AuditUser:     "pgibbons@initech.com",
-		},
-		Paths: struct {
-			BoundBooks       string `json:"bound-books"`
-			BackgroundChecks string `json:"background-checks"`
-		}{
-			BoundBooks:       tempDir,
-			BackgroundChecks: tempDir,
-		},
-	}
-
-	// Call the DownloadBoundBook function using our mockServer URL instead of the real API
-	savedFilePath, err := DownloadBoundBook(mockServer.URL, testConfig)
+	// Create a test client pointed at our mockServer instead of the real API
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com")
+
+	// Call the DownloadBoundBook method using our mockServer URL instead of the real API
+	savedFilePath, err := testClient.DownloadBoundBook(context.Background(), storage.NewLocal(tempDir))
 	if err != nil {
 		t.Fatalf("DownloadBoundBook() returned an unexpected error: %v", err)
 	}
@@ -86,9 +73,14 @@ func TestDownloadBoundBook(t *testing.T) {
 	if _, err := os.Stat(expectedFile); os.IsNotExist(err) {
 		t.Errorf("Expected file to be created, but it was not: %s", expectedFile)
 	}
+
+	// Check that the size of the book was recorded for the account
+	if size := accountMetric(t, "fastbound_downloader_last_book_size_bytes", "123456"); size != float64(len(mockPDF)) {
+		t.Errorf("Expected the last book size to be %d bytes, but got %v", len(mockPDF), size)
+	}
 }
 
-// TestDownloadBoundBook_FileExists validates that DownloadBoundBook skips downloading if the file exists
+// TestDownloadBoundBook_FileExists validates that DownloadBoundBook skips downloading if the file exists and matches what is served
 func TestDownloadBoundBook_FileExists(t *testing.T) {
 	// Create a mock server to simulate the Fastbound API
 	getCallCount := 0 // Count of times the API is called
@@ -106,12 +98,14 @@ func TestDownloadBoundBook_FileExists(t *testing.T) {
 			}
 			return
 		}
-		// Request the download of the mocked bound book
-		if r.Method == "GET" && r.URL.Path == "/download/MOCK_BOUND_BOOK.pdf" {
-			getCallCount++ // Track if this handler is called
+		// Request the download of the mocked bound book, or only its headers to compare with the existing file
+		if (r.Method == "GET" || r.Method == "HEAD") && r.URL.Path == "/download/MOCK_BOUND_BOOK.pdf" {
+			if r.Method == "GET" {
+				getCallCount++ // Track if the file is downloaded
+			}
 			w.WriteHeader(http.StatusOK)
-			// We're writing some dummy data here
-			_, err := w.Write([]byte(`"Guns. Lots of guns."`))
+			// We're writing a small but valid PDF here
+			_, err := w.Write(mockPDF)
 			if err != nil {
 				t.Fatalf("Mock server failed to write file content: %v", err)
 			}
@@ -124,36 +118,19 @@ func TestDownloadBoundBook_FileExists(t *testing.T) {
 	defer mockServer.Close()
 
 	tempDir := t.TempDir()
-	// Create a test config for use with function calls
-	testConfig := fbdownloader_settings.FBDConfig{
-		Fastbound: struct {
-			AccountNumber string `json:"account-number"`
-			ApiKey        string `json:"api-key"`
-			AuditUser     string `json:"audit-user"`
-		}{
-			AccountNumber: "123456",
-			ApiKey:        "kkJ4K3dHoHqZzNvoDJ",
-			AuditUser:     "pgibbons@initech.com",
-		},
-		Paths: struct {
-			BoundBooks       string `json:"bound-books"`
-			BackgroundChecks string `json:"background-checks"`
-		}{
-			BoundBooks:       tempDir,
-			BackgroundChecks: tempDir,
-		},
-	}
+	// Create a test client pointed at our mockServer instead of the real API
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com")
 
 	// Pre-create the file that should be detected as already downloaded
 	expectedFile := filepath.Join(tempDir, "MOCK_BOUND_BOOK.pdf")
-	testFileContent := []byte("Guns. Lots of guns.")
+	testFileContent := mockPDF
 	err := os.WriteFile(expectedFile, testFileContent, 0644)
 	if err != nil {
 		t.Fatalf("Failed to create pre-existing file: %v", err)
 	}
 
-	// Call the DownloadBoundBook function using our mockServer URL instead of the real API
-	savedFilePath, err := DownloadBoundBook(mockServer.URL, testConfig)
+	// Call the DownloadBoundBook method using our mockServer URL instead of the real API
+	savedFilePath, err := testClient.DownloadBoundBook(context.Background(), storage.NewLocal(tempDir))
 	if err != nil {
 		t.Fatalf("DownloadBoundBook() returned an unexpected error: %v", err)
 	}
@@ -182,3 +159,67 @@ func TestDownloadBoundBook_FileExists(t *testing.T) {
 		t.Errorf("Expected file content to be unchanged, but it was modified")
 	}
 }
+
+// TestDownloadBoundBook_S3 validates that books are archived to S3 and skipped once they are there
+func TestDownloadBoundBook_S3(t *testing.T) {
+	getCallCount := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && strings.Contains(r.URL.Path, "/api/Downloads/BoundBook") {
+			w.Header().Set("Content-Type", "application/json")
+			_, err := fmt.Fprintf(w, `{"url": "%s"}`, "http://"+r.Host+"/download/MOCK_BOUND_BOOK.pdf")
+			if err != nil {
+				t.Fatalf("Mock server failed to write response: %v", err)
+			}
+			return
+		}
+		if r.Method == "GET" {
+			getCallCount++
+		}
+		_, _ = w.Write(mockPDF)
+	}))
+	defer mockServer.Close()
+
+	// Create an in-memory S3 server with a bucket to archive into
+	memoryBackend := s3mem.New()
+	if err := memoryBackend.CreateBucket("books"); err != nil {
+		t.Fatalf("Failed to create mock bucket: %v", err)
+	}
+	mockS3 := httptest.NewTLSServer(gofakes3.New(memoryBackend).Server())
+	defer mockS3.Close()
+	books, err := storage.NewS3(storage.S3Config{
+		Endpoint:        mockS3.URL,
+		Bucket:          "books",
+		Prefix:          "123456",
+		Region:          "us-east-1",
+		PathStyle:       true,
+		AccessKeyID:     "pgibbons",
+		SecretAccessKey: "kkJ4K3dHoHqZzNvoDJ",
+		Transport:       mockS3.Client().Transport,
+	})
+	if err != nil {
+		t.Fatalf("NewS3() returned an unexpected error: %v", err)
+	}
+
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com", WithStagingDir(t.TempDir()))
+	savedLocation, err := testClient.DownloadBoundBook(context.Background(), books)
+	if err != nil {
+		t.Fatalf("DownloadBoundBook() returned an unexpected error: %v", err)
+	}
+	if savedLocation != "s3://books/123456/MOCK_BOUND_BOOK.pdf" {
+		t.Errorf("Expected the book to be archived to S3, but got '%s'", savedLocation)
+	}
+	for _, key := range []string{"MOCK_BOUND_BOOK.pdf", "MOCK_BOUND_BOOK.pdf" + ChecksumFileSuffix, ManifestFileName, ledger.FileName} {
+		if _, err := books.Stat(context.Background(), key); err != nil {
+			t.Errorf("Expected %s in the bucket: %v", key, err)
+		}
+	}
+
+	// The second run should find the book in the bucket and skip it
+	savedLocation, err = testClient.DownloadBoundBook(context.Background(), books)
+	if err != nil {
+		t.Fatalf("DownloadBoundBook() returned an unexpected error: %v", err)
+	}
+	if savedLocation != "" || getCallCount != 1 {
+		t.Errorf("Expected the second download to be skipped, but got '%s' after %d download(s)", savedLocation, getCallCount)
+	}
+}
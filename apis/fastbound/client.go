@@ -0,0 +1,164 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/metrics"
+	"github.com/route1337/fastbound-downloader/signature"
+	"github.com/route1337/fastbound-downloader/storage"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultUserAgent is sent with every request unless overridden with WithUserAgent
+const defaultUserAgent = "fastbound-downloader"
+
+// defaultAPITimeout bounds connecting and waiting for the response headers unless overridden with WithAPITimeout. Reading
+// the body of any response, including a download, is bounded by the stall timeout instead.
+const defaultAPITimeout = 60 * time.Second
+
+// defaultStallTimeout is how long a download may go without receiving data unless overridden with WithStallTimeout
+const defaultStallTimeout = 60 * time.Second
+
+// Client A Fastbound API client for a single account. All Fastbound endpoints should be called through it.
+type Client struct {
+	baseURL          string
+	accountNumber    string
+	apiKey           string
+	auditUser        string
+	httpClient       *http.Client
+	userAgent        string
+	apiTimeout       time.Duration
+	stallTimeout     time.Duration
+	retryPolicy      RetryPolicy
+	quarantineDir    string
+	quarantineCipher storage.Cipher
+	stagingDir       string
+	layout           *Layout
+	signer           signature.Signer
+}
+
+// ClientOption configures optional Client behavior in NewClient
+type ClientOption func(*Client)
+
+// WithHTTPClient makes the Client send its requests through httpClient
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTransport makes the Client send its requests through transport
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		c.httpClient = &http.Client{Transport: transport}
+	}
+}
+
+// WithUserAgent overrides the User-Agent header sent with every request
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// NewClient creates a Client for the Fastbound API at baseURL using the given account credentials
+func NewClient(baseURL string, accountNumber string, apiKey string, auditUser string, options ...ClientOption) *Client {
+	client := &Client{
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		accountNumber: accountNumber,
+		apiKey:        apiKey,
+		auditUser:     auditUser,
+		httpClient:    &http.Client{},
+		userAgent:     defaultUserAgent,
+		apiTimeout:    defaultAPITimeout,
+		stallTimeout:  defaultStallTimeout,
+		retryPolicy:   DefaultRetryPolicy,
+		stagingDir:    os.TempDir(),
+		layout:        DefaultLayout,
+	}
+	for _, option := range options {
+		option(client)
+	}
+	return client
+}
+
+// AccountNumber returns the Fastbound account number the Client acts on
+func (c *Client) AccountNumber() string {
+	return c.accountNumber
+}
+
+// apiURL builds the full URL of an account scoped API endpoint such as "api/Downloads/BoundBook"
+func (c *Client) apiURL(endpoint string) string {
+	return fmt.Sprintf("%s/%s/%s", c.baseURL, c.accountNumber, strings.TrimLeft(endpoint, "/"))
+}
+
+// newAPIRequest creates a request for an account scoped API endpoint with authentication and audit headers set
+func (c *Client) newAPIRequest(ctx context.Context, method string, endpoint string) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(ctx, method, c.apiURL(endpoint), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API %s request: %w", method, err)
+	}
+	request.SetBasicAuth(c.apiKey, c.apiKey)
+	request.Header.Set("accept", "application/json")
+	request.Header.Set("X-AuditUser", c.auditUser)
+	request.Header.Set("User-Agent", c.userAgent)
+	return request, nil
+}
+
+// doJSON sends an API request, retrying temporary failures, and decodes a successful JSON response into apiResponse
+func (c *Client) doJSON(ctx context.Context, method string, endpoint string, apiResponse any) error {
+	started := time.Now()
+	defer func() {
+		metrics.APIRequestDurationSeconds.WithLabelValues(c.accountNumber, method).Observe(time.Since(started).Seconds())
+	}()
+	response, err := c.doWithRetry(ctx, func(attemptContext context.Context) (*http.Request, error) {
+		return c.newAPIRequest(attemptContext, method, endpoint)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to execute %s request: %w", method, err)
+	}
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			log.Printf("Warning: failed to close %s response body: %v", method, err)
+		}
+	}()
+
+	// Read the response status code and fail out with any errors
+	if response.StatusCode != http.StatusOK {
+		errorBody, _ := io.ReadAll(response.Body)
+		return &StatusError{Operation: "api request", StatusCode: response.StatusCode, Body: string(errorBody)}
+	}
+	if err := json.NewDecoder(response.Body).Decode(apiResponse); err != nil {
+		return fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+	return nil
+}
+
+// requestDownloadURL sends a POST to a Fastbound Downloads endpoint and returns the URL of the file to download
+func (c *Client) requestDownloadURL(ctx context.Context, endpoint string) (string, error) {
+
+	// Define a struct to hold the API's JSON response.
+	type downloadApiResponse struct {
+		URL string `json:"url"`
+	}
+
+	var apiResponse downloadApiResponse
+	if err := c.doJSON(ctx, "POST", endpoint, &apiResponse); err != nil {
+		return "", err
+	}
+	if apiResponse.URL == "" {
+		return "", fmt.Errorf("API response did not contain a download URL")
+	}
+	return apiResponse.URL, nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"context"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// roundTripFunc lets a plain function be used as an http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+// TestClientAPIHeaders validates that API requests carry authentication, audit and User-Agent headers
+func TestClientAPIHeaders(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/123456/api/Downloads/BoundBook" {
+			t.Errorf("Mock server received unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		apiKey, password, ok := r.BasicAuth()
+		if !ok || apiKey != "kkJ4K3dHoHqZzNvoDJ" || password != "kkJ4K3dHoHqZzNvoDJ" {
+			t.Errorf("Expected basic auth with the API key, but got '%s:%s'", apiKey, password)
+		}
+		if auditUser := r.Header.Get("X-AuditUser"); auditUser != "pgibbons@initech.com" {
+			t.Errorf("Expected X-AuditUser to be 'pgibbons@initech.com', but got '%s'", auditUser)
+		}
+		if userAgent := r.Header.Get("User-Agent"); userAgent != "fbdownloader-test/1.0" {
+			t.Errorf("Expected User-Agent to be 'fbdownloader-test/1.0', but got '%s'", userAgent)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err := fmt.Fprint(w, `{"url": "https://storage.example.com/MOCK_BOUND_BOOK.pdf"}`)
+		if err != nil {
+			t.Fatalf("Mock server failed to write response: %v", err)
+		}
+	}))
+	defer mockServer.Close()
+
+	testClient := NewClient(mockServer.URL+"/", "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com",
+		WithUserAgent("fbdownloader-test/1.0"))
+	downloadURL, err := testClient.requestDownloadURL(context.Background(), "api/Downloads/BoundBook")
+	if err != nil {
+		t.Fatalf("requestDownloadURL() returned an unexpected error: %v", err)
+	}
+	if downloadURL != "https://storage.example.com/MOCK_BOUND_BOOK.pdf" {
+		t.Errorf("Expected the download URL from the API, but got '%s'", downloadURL)
+	}
+}
+
+// TestClientWithTransport validates that an injected RoundTripper is used for every request
+func TestClientWithTransport(t *testing.T) {
+	calls := 0
+	transport := roundTripFunc(func(request *http.Request) (*http.Response, error) {
+		calls++
+		return nil, fmt.Errorf("transport refused %s", request.URL)
+	})
+
+	testClient := NewClient("https://cloud.fastbound.test", "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com",
+		WithTransport(transport), WithAPITimeout(time.Second), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	if _, err := testClient.DownloadBoundBook(context.Background(), storage.NewLocal(t.TempDir())); err == nil {
+		t.Errorf("Expected an error from the refusing transport, but got none")
+	}
+	if calls != 1 {
+		t.Errorf("Expected the injected transport to be called once, but it was called %d time(s)", calls)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"context"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/metrics"
+	"github.com/route1337/fastbound-downloader/storage"
+	"log"
+	"net/http"
+)
+
+// existingDownload A previous download of a file and what was recorded about it when it was downloaded
+type existingDownload struct {
+	Key    string
+	Size   int64  // -1 when unknown
+	SHA256 string // Blank when only the stored copy can tell
+	ETag   string // Blank when the server sent none or the file was downloaded before ETags were recorded
+}
+
+// remoteComparison How a file Fastbound serves compares with a previous download of it
+type remoteComparison int
+
+const (
+	remoteUnknown remoteComparison = iota // Nothing to compare before downloading, so the hashes have to be compared after
+	remoteMatches
+	remoteDiffers
+)
+
+// compareWithRemote asks for the headers of downloadURL and compares its ETag, or otherwise its size, with existing.
+// Storage URLs that refuse HEAD requests, such as presigned GET URLs, can't be compared this way, which isn't an error.
+// When they differ, the returned string says how.
+func (c *Client) compareWithRemote(ctx context.Context, downloadURL string, existing *existingDownload) (remoteComparison, string, error) {
+	response, err := c.doWithRetry(ctx, func(attemptContext context.Context) (*http.Request, error) {
+		headRequest, err := http.NewRequestWithContext(attemptContext, "HEAD", downloadURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create HEAD request for download: %w", err)
+		}
+		headRequest.Header.Set("User-Agent", c.userAgent)
+		return headRequest, nil
+	})
+	if err != nil {
+		return remoteUnknown, "", fmt.Errorf("failed to check download URL: %w", err)
+	}
+	closeBody(response)
+	if response.StatusCode != http.StatusOK {
+		return remoteUnknown, "", nil
+	}
+
+	if etag := strongETag(response.Header); etag != "" && existing.ETag != "" {
+		if etag == existing.ETag {
+			return remoteMatches, "", nil
+		}
+		return remoteDiffers, fmt.Sprintf("ETag changed from %s to %s", existing.ETag, etag), nil
+	}
+	if response.ContentLength >= 0 && existing.Size >= 0 {
+		if response.ContentLength == existing.Size {
+			return remoteMatches, "", nil
+		}
+		return remoteDiffers, fmt.Sprintf("size changed from %d to %d bytes", existing.Size, response.ContentLength), nil
+	}
+	return remoteUnknown, "", nil
+}
+
+// recordedHash returns the SHA-256 recorded for the previous download, hashing the stored copy if none was recorded
+func (e *existingDownload) recordedHash(ctx context.Context, destination storage.Backend) (string, error) {
+	if e.SHA256 != "" {
+		return e.SHA256, nil
+	}
+	return hashObject(ctx, destination, e.Key)
+}
+
+// reportMismatch logs and counts a previous download that no longer matches what Fastbound serves
+func (c *Client) reportMismatch(destination storage.Backend, existing *existingDownload, reason string) {
+	metrics.DownloadMismatchesTotal.WithLabelValues(c.accountNumber).Inc()
+	log.Printf("Warning: %s no longer matches what Fastbound is serving (%s). Downloading it again under a new name.",
+		destination.Location(existing.Key), reason)
+}
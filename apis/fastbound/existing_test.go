@@ -0,0 +1,201 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/metrics"
+	"github.com/route1337/fastbound-downloader/storage"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mismatchCount returns how many mismatched downloads have been counted for accountNumber
+func mismatchCount(t *testing.T, accountNumber string) float64 {
+	return accountMetric(t, "fastbound_downloader_download_mismatches_total", accountNumber)
+}
+
+// accountMetric returns the value of the counter or gauge called name for accountNumber
+func accountMetric(t *testing.T, name string, accountNumber string) float64 {
+	families, err := metrics.MetricsRegistry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "account" && label.GetValue() == accountNumber {
+					return metric.GetCounter().GetValue() + metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// changingServer A mock Fastbound API serving a bound book that can change between downloads
+type changingServer struct {
+	content     []byte
+	etag        string
+	refuseHEAD  bool // Like a presigned URL that only allows GET
+	getRequests int
+}
+
+func (s *changingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" && strings.Contains(r.URL.Path, "/api/Downloads/BoundBook") {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"url": "%s"}`, "http://"+r.Host+"/download/MOCK_BOUND_BOOK.pdf")
+		return
+	}
+	if r.Method == "HEAD" && s.refuseHEAD {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if r.Method == "GET" {
+		s.getRequests++
+	}
+	if s.etag != "" {
+		w.Header().Set("ETag", s.etag)
+	}
+	_, _ = w.Write(s.content)
+}
+
+// TestDownloadBoundBook_Changed validates that a previous download is only skipped while it matches what is served,
+// and that a changed file is downloaded again under a new name and counted
+func TestDownloadBoundBook_Changed(t *testing.T) {
+	changedPDF := []byte(strings.Replace(string(mockPDF), "Guns.", "Ammo.", 1))
+	resizedPDF := []byte("%PDF-1.7\n" + strings.Repeat("% Guns. Lots of guns.\n", 65) + "%%EOF\n")
+	tests := map[string]struct {
+		etag       string
+		refuseHEAD bool
+		changed    []byte
+		newETag    string
+		reason     string
+	}{
+		"ETag":           {etag: `"v1"`, changed: changedPDF, newETag: `"v2"`},
+		"Content-Length": {changed: resizedPDF},
+		"Hash":           {refuseHEAD: true, changed: changedPDF},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := &changingServer{content: mockPDF, etag: test.etag, refuseHEAD: test.refuseHEAD}
+			mockServer := httptest.NewServer(server)
+			defer mockServer.Close()
+			accountNumber := "CHANGED-" + name
+			tempDir := t.TempDir()
+			destination := storage.NewLocal(tempDir)
+			testClient := NewClient(mockServer.URL, accountNumber, "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com")
+
+			if _, err := testClient.DownloadBoundBook(context.Background(), destination); err != nil {
+				t.Fatalf("DownloadBoundBook() returned an unexpected error: %v", err)
+			}
+			// Unchanged, the book is skipped, and only downloaded again to compare hashes when HEAD is refused
+			savedFilePath, err := testClient.DownloadBoundBook(context.Background(), destination)
+			if err != nil {
+				t.Fatalf("DownloadBoundBook() returned an unexpected error: %v", err)
+			}
+			expectedGets := 1
+			if test.refuseHEAD {
+				expectedGets = 2
+			}
+			if savedFilePath != "" || server.getRequests != expectedGets {
+				t.Errorf("Expected an unchanged book to be skipped, but got '%s' after %d download(s)", savedFilePath, server.getRequests)
+			}
+
+			// Changed, the book is downloaded again next to the original, which is left as it was
+			server.content, server.etag = test.changed, test.newETag
+			savedFilePath, err = testClient.DownloadBoundBook(context.Background(), destination)
+			if err != nil {
+				t.Fatalf("DownloadBoundBook() returned an unexpected error: %v", err)
+			}
+			if expectedFile := filepath.Join(tempDir, "MOCK_BOUND_BOOK-2.pdf"); savedFilePath != expectedFile {
+				t.Errorf("Expected the changed book to be saved to '%s', but got '%s'", expectedFile, savedFilePath)
+			}
+			if original, err := os.ReadFile(filepath.Join(tempDir, "MOCK_BOUND_BOOK.pdf")); err != nil || string(original) != string(mockPDF) {
+				t.Errorf("Expected the original book to be left as it was (%v)", err)
+			}
+			if count := mismatchCount(t, accountNumber); count != 1 {
+				t.Errorf("Expected 1 mismatch to be counted, but got %v", count)
+			}
+
+			// The new copy is what later runs compare against, so it isn't downloaded over and over
+			savedFilePath, err = testClient.DownloadBoundBook(context.Background(), destination)
+			if err != nil {
+				t.Fatalf("DownloadBoundBook() returned an unexpected error: %v", err)
+			}
+			if savedFilePath != "" || mismatchCount(t, accountNumber) != 1 {
+				t.Errorf("Expected the new copy to be skipped, but got '%s'", savedFilePath)
+			}
+		})
+	}
+}
+
+// TestDownloadBoundBook_IncompleteCopy validates that a copy saved before manifests existed is downloaded again if its
+// size doesn't match what is served
+func TestDownloadBoundBook_IncompleteCopy(t *testing.T) {
+	server := &changingServer{content: mockPDF}
+	mockServer := httptest.NewServer(server)
+	defer mockServer.Close()
+	tempDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tempDir, "MOCK_BOUND_BOOK.pdf"), mockPDF[:len(mockPDF)/2], 0644); err != nil {
+		t.Fatalf("Failed to create pre-existing file: %v", err)
+	}
+
+	testClient := NewClient(mockServer.URL, "INCOMPLETE", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com")
+	savedFilePath, err := testClient.DownloadBoundBook(context.Background(), storage.NewLocal(tempDir))
+	if err != nil {
+		t.Fatalf("DownloadBoundBook() returned an unexpected error: %v", err)
+	}
+	if expectedFile := filepath.Join(tempDir, "MOCK_BOUND_BOOK-2.pdf"); savedFilePath != expectedFile {
+		t.Errorf("Expected the book to be downloaded again to '%s', but got '%s'", expectedFile, savedFilePath)
+	}
+	if count := mismatchCount(t, "INCOMPLETE"); count != 1 {
+		t.Errorf("Expected 1 mismatch to be counted, but got %v", count)
+	}
+}
+
+// TestDownloadBoundBook_EncryptedCopy validates that an encrypted copy saved before manifests existed is compared by hash,
+// since its stored size is the size of the encrypted file
+func TestDownloadBoundBook_EncryptedCopy(t *testing.T) {
+	server := &changingServer{content: mockPDF}
+	mockServer := httptest.NewServer(server)
+	defer mockServer.Close()
+
+	keyFile := filepath.Join(t.TempDir(), "books.key")
+	if err := os.WriteFile(keyFile, []byte(strings.Repeat("ab", 32)), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	cipher, err := storage.NewAESGCMCipher(keyFile)
+	if err != nil {
+		t.Fatalf("NewAESGCMCipher() returned an unexpected error: %v", err)
+	}
+	tempDir := t.TempDir()
+	destination := storage.NewEncrypted(storage.NewLocal(tempDir), storage.EncryptedConfig{Cipher: cipher, StagingDir: t.TempDir()})
+	if err := destination.Put(context.Background(), "MOCK_BOUND_BOOK.pdf", bytes.NewReader(mockPDF), int64(len(mockPDF))); err != nil {
+		t.Fatalf("Failed to create pre-existing file: %v", err)
+	}
+
+	testClient := NewClient(mockServer.URL, "ENCRYPTED", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com")
+	savedFilePath, err := testClient.DownloadBoundBook(context.Background(), destination)
+	if err != nil {
+		t.Fatalf("DownloadBoundBook() returned an unexpected error: %v", err)
+	}
+	if savedFilePath != "" {
+		t.Errorf("Expected the encrypted copy to match by hash and be skipped, but the book was saved to '%s'", savedFilePath)
+	}
+	if count := mismatchCount(t, "ENCRYPTED"); count != 0 {
+		t.Errorf("Expected no mismatch to be counted, but got %v", count)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"errors"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/metrics"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+)
+
+// StatusError A request that Fastbound or its storage answered with an unsuccessful HTTP status
+type StatusError struct {
+	Operation  string // What was requested, such as "api request"
+	StatusCode int
+	Body       string // The response body, if it was read
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%s failed with status %d", e.Operation, e.StatusCode)
+	}
+	return fmt.Sprintf("%s failed with status %d: %s", e.Operation, e.StatusCode, e.Body)
+}
+
+// FailureReason returns the reason label of metrics.FailuresTotal that describes why err happened
+func FailureReason(err error) string {
+	var validationErr *ValidationError
+	var statusErr *StatusError
+	var netErr net.Error
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	switch {
+	case errors.As(err, &validationErr):
+		return metrics.FailureValidation
+	case errors.As(err, &statusErr):
+		if statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden {
+			return metrics.FailureAuth
+		}
+		return metrics.FailureHTTPStatus
+	// Checked before network errors since system call errors, such as a full disk, also satisfy net.Error
+	case errors.As(err, &pathErr), errors.As(err, &linkErr), errors.Is(err, syscall.ENOSPC):
+		return metrics.FailureDisk
+	case errors.As(err, &netErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return metrics.FailureNetwork
+	default:
+		return metrics.FailureOther
+	}
+}
+
+// reportFailure counts a failed or rejected download for the account by why it failed
+func (c *Client) reportFailure(err error) {
+	metrics.FailuresTotal.WithLabelValues(c.accountNumber, FailureReason(err)).Inc()
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/metrics"
+	"github.com/route1337/fastbound-downloader/storage"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+)
+
+// TestFailureReason validates the FailureReason function
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "Rejected download", err: fmt.Errorf("failed: %w", &ValidationError{FileName: "MOCK_BOUND_BOOK.pdf", Reason: "too small"}), want: metrics.FailureValidation},
+		{name: "Bad API key", err: fmt.Errorf("failed: %w", &StatusError{Operation: "api request", StatusCode: http.StatusUnauthorized}), want: metrics.FailureAuth},
+		{name: "Audit user without access", err: &StatusError{Operation: "api request", StatusCode: http.StatusForbidden}, want: metrics.FailureAuth},
+		{name: "Missing download", err: &StatusError{Operation: "file download", StatusCode: http.StatusNotFound}, want: metrics.FailureHTTPStatus},
+		{name: "Unreachable API", err: &url.Error{Op: "Get", URL: "https://cloud.fastbound.com", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}, want: metrics.FailureNetwork},
+		{name: "Dropped connection", err: fmt.Errorf("failed to write file: %w", io.ErrUnexpectedEOF), want: metrics.FailureNetwork},
+		{name: "Unwritable staging directory", err: &fs.PathError{Op: "open", Path: "/staging", Err: fs.ErrPermission}, want: metrics.FailureDisk},
+		{name: "Full disk", err: fmt.Errorf("failed to store: %w", syscall.ENOSPC), want: metrics.FailureDisk},
+		{name: "Anything else", err: errors.New("API response did not contain a download URL"), want: metrics.FailureOther},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := FailureReason(test.err); got != test.want {
+				t.Errorf("FailureReason() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+// TestDownloadBoundBook_FailureReason validates that a refused API key is counted as an auth failure
+func TestDownloadBoundBook_FailureReason(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+	}))
+	defer mockServer.Close()
+
+	testClient := NewClient(mockServer.URL, "401401", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com")
+	_, err := testClient.DownloadBoundBook(context.Background(), storage.NewLocal(t.TempDir()))
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected a 401 StatusError, but got: %v", err)
+	}
+	if failures := accountMetric(t, "fastbound_downloader_failures_total", "401401"); failures != 1 {
+		t.Errorf("Expected 1 failure to be counted, but got %v", failures)
+	}
+}
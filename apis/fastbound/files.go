@@ -0,0 +1,85 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"errors"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/storage"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// partialFilePrefix and partialFileSuffix mark in-progress downloads so they are never mistaken for a finished file
+const (
+	partialFilePrefix = storage.PartialFilePrefix
+	partialFileSuffix = storage.PartialFileSuffix
+)
+
+// partialFile A download being written to a temporary file in the staging directory until it is validated and stored
+type partialFile struct {
+	*os.File
+	done bool
+}
+
+// WithStagingDir sets the local directory downloads are written to before being stored, which is created if needed. By
+// default the system temporary directory is used.
+func WithStagingDir(dir string) ClientOption {
+	return func(c *Client) {
+		c.stagingDir = dir
+	}
+}
+
+// createPartialFile creates a temporary file in stagingDir to download into
+func createPartialFile(stagingDir string) (*partialFile, error) {
+	if err := os.MkdirAll(stagingDir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory %s: %w", stagingDir, err)
+	}
+	tempFile, err := os.CreateTemp(stagingDir, partialFilePrefix+"*"+partialFileSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a temporary file in %s: %w", stagingDir, err)
+	}
+	return &partialFile{File: tempFile}, nil
+}
+
+// abort closes and removes the temporary file unless it has already been moved elsewhere. It is safe to defer.
+func (p *partialFile) abort() {
+	if p.done {
+		return
+	}
+	p.done = true
+	_ = p.Close()
+	if err := os.Remove(p.Name()); err != nil && !os.IsNotExist(err) {
+		log.Printf("Warning: failed to remove partial download %s: %v", p.Name(), err)
+	}
+}
+
+// SweepPartialFiles removes temporary files left behind in dir by downloads that never finished and returns how many were removed
+func SweepPartialFiles(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Nothing has been downloaded here yet
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to list %s for partial downloads: %w", dir, err)
+	}
+	removed := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, partialFilePrefix) || !strings.HasSuffix(name, partialFileSuffix) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("failed to remove partial download %s: %w", name, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"context"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/storage"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPartialFile validates that aborted partial files are removed
+func TestPartialFile(t *testing.T) {
+	tempDir := t.TempDir()
+	storeFile, err := createPartialFile(tempDir)
+	if err != nil {
+		t.Fatalf("createPartialFile() returned an unexpected error: %v", err)
+	}
+	if filepath.Dir(storeFile.Name()) != tempDir {
+		t.Errorf("Expected the partial file in %s, but got %s", tempDir, storeFile.Name())
+	}
+	storeFile.abort()
+	if _, err := os.Stat(storeFile.Name()); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed after abort", storeFile.Name())
+	}
+}
+
+// TestSweepPartialFiles validates that only leftover partial files are removed
+func TestSweepPartialFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	keptFile := filepath.Join(tempDir, "MOCK_BOUND_BOOK.pdf")
+	leftoverFile := filepath.Join(tempDir, partialFilePrefix+"12345"+partialFileSuffix)
+	for _, path := range []string{keptFile, leftoverFile} {
+		if err := os.WriteFile(path, []byte("Guns. Lots of guns."), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	removed, err := SweepPartialFiles(tempDir)
+	if err != nil {
+		t.Fatalf("SweepPartialFiles() returned an unexpected error: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("Expected 1 partial file to be removed, but got %d", removed)
+	}
+	if _, err := os.Stat(leftoverFile); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed", leftoverFile)
+	}
+	if _, err := os.Stat(keptFile); err != nil {
+		t.Errorf("Expected %s to be kept: %v", keptFile, err)
+	}
+}
+
+// TestDownloadBoundBook_TruncatedDownload validates that a download cut off partway leaves nothing behind
+func TestDownloadBoundBook_TruncatedDownload(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && strings.Contains(r.URL.Path, "/api/Downloads/BoundBook") {
+			w.Header().Set("Content-Type", "application/json")
+			_, err := fmt.Fprintf(w, `{"url": "%s"}`, "http://"+r.Host+"/download/MOCK_BOUND_BOOK.pdf")
+			if err != nil {
+				t.Fatalf("Mock server failed to write response: %v", err)
+			}
+			return
+		}
+		// Promise more bytes than we send so the client sees the connection drop mid-file
+		w.Header().Set("Content-Length", "1000")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("Guns. Lots of"))
+	}))
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com",
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 1}), WithStagingDir(tempDir))
+	if _, err := testClient.DownloadBoundBook(context.Background(), storage.NewLocal(tempDir)); err == nil {
+		t.Fatalf("Expected an error for a truncated download, but got none")
+	}
+
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to list %s: %v", tempDir, err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected no files after a truncated download, but found %d", len(entries))
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// hashPrefixLength is how many hex characters of a file's SHA-256 are available to layouts as HashPrefix
+const hashPrefixLength = 12
+
+// BuiltInLayouts are the named layouts that can be used in place of a custom template
+var BuiltInLayouts = map[string]string{
+	"flat":        "{{.OriginalName}}",
+	"YYYY/":       "{{.Year}}/{{.OriginalName}}",
+	"YYYY/MM/":    "{{.Year}}/{{.Month}}/{{.OriginalName}}",
+	"YYYY/MM/DD/": "{{.Year}}/{{.Month}}/{{.Day}}/{{.OriginalName}}",
+}
+
+// LayoutValues The variables a layout template can use to build the path of a downloaded file
+type LayoutValues struct {
+	AccountNumber string // Fastbound account number
+	Date          string // Download date as YYYY-MM-DD in the layout's timezone
+	Year          string // Download year as YYYY
+	Month         string // Download month as MM
+	Day           string // Download day as DD
+	OriginalName  string // File name as served by Fastbound
+	BaseName      string // OriginalName without its extension
+	Ext           string // Extension of OriginalName, including the dot
+	HashPrefix    string // First 12 hex characters of the file's SHA-256
+}
+
+// Layout Decides where in a destination directory each downloaded file is saved
+type Layout struct {
+	template *template.Template
+	location *time.Location
+	usesHash bool
+}
+
+// DefaultLayout saves every file directly in the destination directory under the name Fastbound gave it
+var DefaultLayout = mustNewLayout("flat", "UTC")
+
+// NewLayout creates a Layout from the name of a built-in layout or a text/template using LayoutValues.
+// A template ending in "/" is treated as a directory and the original file name is appended to it.
+// Dates are calculated in timezone, an IANA name such as "America/Chicago".
+func NewLayout(templateText string, timezone string) (*Layout, error) {
+	if builtIn, ok := BuiltInLayouts[templateText]; ok {
+		templateText = builtIn
+	}
+	if templateText == "" {
+		templateText = BuiltInLayouts["flat"]
+	}
+	if strings.HasSuffix(templateText, "/") {
+		templateText += "{{.OriginalName}}"
+	}
+	if timezone == "" {
+		timezone = "UTC"
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid layout timezone %q: %w", timezone, err)
+	}
+	parsedTemplate, err := template.New("layout").Option("missingkey=error").Parse(templateText)
+	if err != nil {
+		return nil, fmt.Errorf("invalid layout template %q: %w", templateText, err)
+	}
+	layout := &Layout{
+		template: parsedTemplate,
+		location: location,
+		usesHash: strings.Contains(templateText, ".HashPrefix"),
+	}
+
+	// Render a sample so a template that can never produce a usable path fails at startup
+	sample := layout.values("123456", "BOUND_BOOK.pdf", time.Now(), strings.Repeat("0", hashPrefixLength))
+	if _, err := layout.render(sample); err != nil {
+		return nil, err
+	}
+	return layout, nil
+}
+
+// mustNewLayout is NewLayout for layouts known to be valid
+func mustNewLayout(templateText string, timezone string) *Layout {
+	layout, err := NewLayout(templateText, timezone)
+	if err != nil {
+		panic(err)
+	}
+	return layout
+}
+
+// WithLayout sets where in a destination directory downloaded files are saved. By default they are saved flat.
+func WithLayout(layout *Layout) ClientOption {
+	return func(c *Client) {
+		c.layout = layout
+	}
+}
+
+// values fills in the layout variables for a file downloaded at downloadedAt
+func (l *Layout) values(accountNumber string, originalName string, downloadedAt time.Time, sha256Hex string) LayoutValues {
+	localTime := downloadedAt.In(l.location)
+	extension := filepath.Ext(originalName)
+	hashPrefix := sha256Hex
+	if len(hashPrefix) > hashPrefixLength {
+		hashPrefix = hashPrefix[:hashPrefixLength]
+	}
+	return LayoutValues{
+		AccountNumber: accountNumber,
+		Date:          localTime.Format("2006-01-02"),
+		Year:          localTime.Format("2006"),
+		Month:         localTime.Format("01"),
+		Day:           localTime.Format("02"),
+		OriginalName:  originalName,
+		BaseName:      strings.TrimSuffix(originalName, extension),
+		Ext:           extension,
+		HashPrefix:    hashPrefix,
+	}
+}
+
+// render returns the slash separated path of a file relative to its destination directory
+func (l *Layout) render(values LayoutValues) (string, error) {
+	var rendered strings.Builder
+	if err := l.template.Execute(&rendered, values); err != nil {
+		return "", fmt.Errorf("failed to render layout: %w", err)
+	}
+	relativePath := path.Clean(strings.ReplaceAll(rendered.String(), "\\", "/"))
+	if relativePath == "." || strings.HasSuffix(rendered.String(), "/") {
+		return "", fmt.Errorf("layout rendered %q, which is not a file name", rendered.String())
+	}
+	if path.IsAbs(relativePath) || relativePath == ".." || strings.HasPrefix(relativePath, "../") {
+		return "", fmt.Errorf("layout rendered %q, which is outside the destination directory", rendered.String())
+	}
+	return relativePath, nil
+}
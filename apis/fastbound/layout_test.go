@@ -0,0 +1,134 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/storage"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLayoutRender validates built-in layouts, custom templates and timezones
+func TestLayoutRender(t *testing.T) {
+	// 03:30 UTC on January 1st is still December 31st in Chicago
+	downloadedAt := time.Date(2025, 1, 1, 3, 30, 0, 0, time.UTC)
+	sha256Hex := strings.Repeat("ab", 32)
+	tests := []struct {
+		name     string
+		template string
+		timezone string
+		want     string
+	}{
+		{name: "Default layout", template: "", timezone: "", want: "BOUND_BOOK.pdf"},
+		{name: "Flat layout", template: "flat", timezone: "UTC", want: "BOUND_BOOK.pdf"},
+		{name: "Monthly layout", template: "YYYY/MM/", timezone: "UTC", want: "2025/01/BOUND_BOOK.pdf"},
+		{name: "Daily layout in another timezone", template: "YYYY/MM/DD/", timezone: "America/Chicago", want: "2024/12/31/BOUND_BOOK.pdf"},
+		{name: "Custom directory", template: "{{.AccountNumber}}/{{.Year}}/", timezone: "UTC", want: "123456/2025/BOUND_BOOK.pdf"},
+		{
+			name:     "Custom file name",
+			template: "{{.AccountNumber}}/{{.Date}}_{{.BaseName}}_{{.HashPrefix}}{{.Ext}}",
+			timezone: "UTC",
+			want:     "123456/2025-01-01_BOUND_BOOK_abababababab.pdf",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			layout, err := NewLayout(test.template, test.timezone)
+			if err != nil {
+				t.Fatalf("NewLayout() returned an unexpected error: %v", err)
+			}
+			got, err := layout.render(layout.values("123456", "BOUND_BOOK.pdf", downloadedAt, sha256Hex))
+			if err != nil {
+				t.Fatalf("render() returned an unexpected error: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("render() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// TestNewLayout_Invalid validates that layouts that can't produce a safe file path are refused
+func TestNewLayout_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		timezone string
+	}{
+		{name: "Unknown timezone", template: "flat", timezone: "Mars/Olympus_Mons"},
+		{name: "Unparsable template", template: "{{.Year", timezone: "UTC"},
+		{name: "Unknown variable", template: "{{.Weekday}}/{{.OriginalName}}", timezone: "UTC"},
+		{name: "Escapes the destination", template: "../{{.OriginalName}}", timezone: "UTC"},
+		{name: "Absolute path", template: "/etc/{{.OriginalName}}", timezone: "UTC"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewLayout(test.template, test.timezone); err == nil {
+				t.Errorf("Expected NewLayout(%q, %q) to fail, but it did not", test.template, test.timezone)
+			}
+		})
+	}
+}
+
+// TestDownloadBoundBook_Layout validates that books are saved where the layout puts them and are still skipped once downloaded
+func TestDownloadBoundBook_Layout(t *testing.T) {
+	getCallCount := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && strings.Contains(r.URL.Path, "/api/Downloads/BoundBook") {
+			w.Header().Set("Content-Type", "application/json")
+			_, err := fmt.Fprintf(w, `{"url": "%s"}`, "http://"+r.Host+"/download/MOCK_BOUND_BOOK.pdf")
+			if err != nil {
+				t.Fatalf("Mock server failed to write response: %v", err)
+			}
+			return
+		}
+		if r.Method == "GET" {
+			getCallCount++
+		}
+		_, _ = w.Write(mockPDF)
+	}))
+	defer mockServer.Close()
+
+	// A layout that needs the hash can only be checked through the manifest
+	layout, err := NewLayout("{{.Year}}/{{.Month}}/{{.HashPrefix}}-{{.OriginalName}}", "UTC")
+	if err != nil {
+		t.Fatalf("NewLayout() returned an unexpected error: %v", err)
+	}
+	tempDir := t.TempDir()
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com", WithLayout(layout))
+
+	savedFilePath, err := testClient.DownloadBoundBook(context.Background(), storage.NewLocal(tempDir))
+	if err != nil {
+		t.Fatalf("DownloadBoundBook() returned an unexpected error: %v", err)
+	}
+	sum := sha256.Sum256(mockPDF)
+	now := time.Now().UTC()
+	expectedFile := filepath.Join(tempDir, now.Format("2006"), now.Format("01"), hex.EncodeToString(sum[:])[:hashPrefixLength]+"-MOCK_BOUND_BOOK.pdf")
+	if savedFilePath != expectedFile {
+		t.Errorf("Expected saved file path to be '%s', but got '%s'", expectedFile, savedFilePath)
+	}
+	if _, err := os.Stat(expectedFile + ChecksumFileSuffix); err != nil {
+		t.Errorf("Expected a checksum sidecar next to the saved file: %v", err)
+	}
+
+	// The second run should find the book through the manifest and skip it
+	savedFilePath, err = testClient.DownloadBoundBook(context.Background(), storage.NewLocal(tempDir))
+	if err != nil {
+		t.Fatalf("DownloadBoundBook() returned an unexpected error: %v", err)
+	}
+	if savedFilePath != "" || getCallCount != 1 {
+		t.Errorf("Expected the second download to be skipped, but got '%s' after %d download(s)", savedFilePath, getCallCount)
+	}
+}
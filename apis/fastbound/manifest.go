@@ -0,0 +1,200 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/ledger"
+	"github.com/route1337/fastbound-downloader/storage"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+)
+
+// ManifestFileName is the name of the manifest kept in every destination
+const ManifestFileName = "manifest.jsonl"
+
+// ChecksumFileSuffix is appended to a downloaded file's name to get its checksum sidecar
+const ChecksumFileSuffix = ".sha256"
+
+// ManifestEntry A record of one downloaded file, stored as a line of JSON in the manifest
+type ManifestEntry struct {
+	FileName      string    `json:"filename"` // Storage key relative to the manifest, using forward slashes
+	OriginalName  string    `json:"original-name,omitempty"`
+	FormID        string    `json:"form-id,omitempty"` // The 4473 the file was downloaded for, blank for a bound book
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256"`
+	ETag          string    `json:"etag,omitempty"` // As served by Fastbound, to tell whether the file changes later
+	DownloadedAt  time.Time `json:"downloaded-at"`
+	AccountNumber string    `json:"account-number"`
+	AuditUser     string    `json:"audit-user"`
+}
+
+// writeChecksumFile stores a sha256sum compatible sidecar next to the object stored under key
+func writeChecksumFile(ctx context.Context, destination storage.Backend, key string, sha256Hex string) error {
+	checksum := fmt.Sprintf("%s  %s\n", sha256Hex, path.Base(key))
+	if err := destination.Put(ctx, key+ChecksumFileSuffix, strings.NewReader(checksum), int64(len(checksum))); err != nil {
+		return fmt.Errorf("failed to write checksum for %s: %w", destination.Location(key), err)
+	}
+	return nil
+}
+
+// appendManifestEntry appends entry to the manifest in destination
+func appendManifestEntry(ctx context.Context, destination storage.Backend, entry ManifestEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest entry for %s: %w", entry.FileName, err)
+	}
+	if err := storage.Append(ctx, destination, ManifestFileName, append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to append to manifest: %w", err)
+	}
+	return nil
+}
+
+// originalName returns the name Fastbound served the file under. Entries written before layouts existed only have a file name.
+func (e ManifestEntry) originalName() string {
+	if e.OriginalName != "" {
+		return e.OriginalName
+	}
+	return path.Base(e.FileName)
+}
+
+// readManifest returns every entry in the manifest in destination, or none if there is no manifest yet
+func readManifest(ctx context.Context, destination storage.Backend) ([]ManifestEntry, error) {
+	manifestPath := destination.Location(ManifestFileName)
+	manifestFile, err := destination.Get(ctx, ManifestFileName)
+	if errors.Is(err, storage.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open manifest: %w", err)
+	}
+	defer func() {
+		if err := manifestFile.Close(); err != nil {
+			log.Printf("Warning: failed to close manifest %s: %v", manifestPath, err)
+		}
+	}()
+
+	var entries []ManifestEntry
+	scanner := bufio.NewScanner(manifestFile)
+	for scanner.Scan() {
+		var entry ManifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A damaged line should not stop us from finding the rest
+			log.Printf("Warning: skipping unreadable line in manifest %s: %v", manifestPath, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", manifestPath, err)
+	}
+	return entries, nil
+}
+
+// LedgerRecords returns every file listed in the manifest in destination, once with the SHA-256 in the manifest and once
+// with the SHA-256 in its checksum sidecar, so ledger.Verify can tell when entries were removed from the end of the ledger.
+// Sidecars for files missing from the manifest are not returned as they may predate the ledger.
+func LedgerRecords(ctx context.Context, destination storage.Backend) ([]ledger.Record, error) {
+	entries, err := readManifest(ctx, destination)
+	if err != nil {
+		return nil, err
+	}
+	var records []ledger.Record
+	for _, entry := range entries {
+		records = append(records, ledger.Record{
+			FileName:   entry.FileName,
+			SHA256:     entry.SHA256,
+			RecordedAt: entry.DownloadedAt,
+			Source:     ManifestFileName,
+		})
+		checksum, err := storage.ReadAll(ctx, destination, entry.FileName+ChecksumFileSuffix)
+		if errors.Is(err, storage.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read checksum for %s: %w", destination.Location(entry.FileName), err)
+		}
+		records = append(records, ledger.Record{
+			FileName:   entry.FileName,
+			SHA256:     parseChecksum(checksum),
+			RecordedAt: entry.DownloadedAt,
+			Source:     entry.FileName + ChecksumFileSuffix,
+		})
+	}
+	return records, nil
+}
+
+// VerifyChecksum checks the object stored under key in destination against the SHA-256 recorded in its checksum
+// sidecar, or in the manifest if it has no sidecar. An object with no recorded checksum is not checked.
+func VerifyChecksum(ctx context.Context, destination storage.Backend, key string) error {
+	expected, err := recordedChecksum(ctx, destination, key)
+	if err != nil || expected == "" {
+		return err
+	}
+	actual, err := hashObject(ctx, destination, key)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("%s has SHA-256 %s but %s was recorded for it", destination.Location(key), actual, expected)
+	}
+	return nil
+}
+
+// recordedChecksum returns the SHA-256 recorded for the object stored under key, or nothing if none was recorded
+func recordedChecksum(ctx context.Context, destination storage.Backend, key string) (string, error) {
+	checksum, err := storage.ReadAll(ctx, destination, key+ChecksumFileSuffix)
+	if err == nil {
+		return parseChecksum(checksum), nil
+	}
+	if !errors.Is(err, storage.ErrNotExist) {
+		return "", fmt.Errorf("failed to read checksum for %s: %w", destination.Location(key), err)
+	}
+	entries, err := readManifest(ctx, destination)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if entry.FileName == key {
+			return entry.SHA256, nil
+		}
+	}
+	return "", nil
+}
+
+// parseChecksum returns the SHA-256 in a checksum sidecar
+func parseChecksum(checksum []byte) string {
+	// sha256sum format is the hash followed by two spaces and the file name
+	sha256Hex, _, _ := strings.Cut(string(checksum), " ")
+	return strings.TrimSpace(sha256Hex)
+}
+
+// hashObject returns the SHA-256 of the object stored under key
+func hashObject(ctx context.Context, destination storage.Backend, key string) (string, error) {
+	object, err := destination.Get(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", destination.Location(key), err)
+	}
+	defer func() {
+		if err := object.Close(); err != nil {
+			log.Printf("Warning: failed to close %s: %v", destination.Location(key), err)
+		}
+	}()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, object); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", destination.Location(key), err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,210 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/storage"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDownloadBoundBook_ChecksumAndManifest validates that a saved book gets a checksum sidecar and a manifest entry
+func TestDownloadBoundBook_ChecksumAndManifest(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && strings.Contains(r.URL.Path, "/api/Downloads/BoundBook") {
+			w.Header().Set("Content-Type", "application/json")
+			_, err := fmt.Fprintf(w, `{"url": "%s"}`, "http://"+r.Host+"/download/MOCK_BOUND_BOOK.pdf")
+			if err != nil {
+				t.Fatalf("Mock server failed to write response: %v", err)
+			}
+			return
+		}
+		_, _ = w.Write(mockPDF)
+	}))
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com")
+	savedFilePath, err := testClient.DownloadBoundBook(context.Background(), storage.NewLocal(tempDir))
+	if err != nil {
+		t.Fatalf("DownloadBoundBook() returned an unexpected error: %v", err)
+	}
+	expectedHash := sha256.Sum256(mockPDF)
+	expectedHex := hex.EncodeToString(expectedHash[:])
+
+	// The sidecar should be in sha256sum format so it can be checked with standard tools
+	checksum, err := os.ReadFile(savedFilePath + ChecksumFileSuffix)
+	if err != nil {
+		t.Fatalf("Expected a checksum sidecar for %s: %v", savedFilePath, err)
+	}
+	if string(checksum) != expectedHex+"  MOCK_BOUND_BOOK.pdf\n" {
+		t.Errorf("Unexpected checksum sidecar content: %q", checksum)
+	}
+
+	// The manifest should have exactly one entry describing the download
+	manifestFile, err := os.Open(filepath.Join(tempDir, ManifestFileName))
+	if err != nil {
+		t.Fatalf("Expected a manifest in %s: %v", tempDir, err)
+	}
+	defer func() {
+		_ = manifestFile.Close()
+	}()
+	var entries []ManifestEntry
+	scanner := bufio.NewScanner(manifestFile)
+	for scanner.Scan() {
+		var entry ManifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Failed to decode manifest line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 manifest entry, but got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.FileName != "MOCK_BOUND_BOOK.pdf" || entry.Size != int64(len(mockPDF)) || entry.SHA256 != expectedHex {
+		t.Errorf("Unexpected manifest entry: %+v", entry)
+	}
+	if entry.AccountNumber != "123456" || entry.AuditUser != "pgibbons@initech.com" || entry.DownloadedAt.IsZero() {
+		t.Errorf("Expected the manifest entry to record who downloaded it and when: %+v", entry)
+	}
+}
+
+// failingRecordBackend fails to store anything but sidecars, like a destination that fills up part way through a download
+type failingRecordBackend struct {
+	storage.Backend
+}
+
+func (b failingRecordBackend) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if !strings.HasSuffix(key, ChecksumFileSuffix) {
+		return errors.New("no space left on device")
+	}
+	return b.Backend.Put(ctx, key, r, size)
+}
+
+// TestDownloadBoundBook_StoreFailed validates that the checksum sidecar is removed when the file it describes isn't stored
+func TestDownloadBoundBook_StoreFailed(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && strings.Contains(r.URL.Path, "/api/Downloads/BoundBook") {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"url": "%s"}`, "http://"+r.Host+"/download/MOCK_BOUND_BOOK.pdf")
+			return
+		}
+		_, _ = w.Write(mockPDF)
+	}))
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com")
+	if _, err := testClient.DownloadBoundBook(context.Background(), failingRecordBackend{storage.NewLocal(tempDir)}); err == nil {
+		t.Fatal("Expected DownloadBoundBook() to fail when the book can't be stored")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "MOCK_BOUND_BOOK.pdf"+ChecksumFileSuffix)); !os.IsNotExist(err) {
+		t.Errorf("Expected the checksum sidecar to be removed, but got: %v", err)
+	}
+}
+
+// TestVerifyChecksum validates that a stored file is checked against its sidecar, or the manifest without one
+func TestVerifyChecksum(t *testing.T) {
+	ctx := context.Background()
+	content := "Guns. Lots of guns."
+	sum := sha256.Sum256([]byte(content))
+	sha256Hex := hex.EncodeToString(sum[:])
+	manifestLine, err := json.Marshal(ManifestEntry{FileName: "2025/MANIFEST_ONLY.pdf", SHA256: sha256Hex})
+	if err != nil {
+		t.Fatalf("Failed to encode manifest entry: %v", err)
+	}
+
+	destination := storage.NewLocal(t.TempDir())
+	files := map[string]string{
+		"2025/BOOK.pdf":                         content,
+		"2025/BOOK.pdf" + ChecksumFileSuffix:    sha256Hex + "  BOOK.pdf\n",
+		"2025/ALTERED.pdf":                      content + " Tampered with.",
+		"2025/ALTERED.pdf" + ChecksumFileSuffix: sha256Hex + "  ALTERED.pdf\n",
+		"2025/MANIFEST_ONLY.pdf":                content,
+		"2025/UNRECORDED.pdf":                   content,
+		ManifestFileName:                        string(manifestLine) + "\n",
+	}
+	for key, file := range files {
+		if err := destination.Put(ctx, key, strings.NewReader(file), -1); err != nil {
+			t.Fatalf("Put() returned an unexpected error: %v", err)
+		}
+	}
+
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{key: "2025/BOOK.pdf", wantErr: false},
+		{key: "2025/ALTERED.pdf", wantErr: true},
+		{key: "2025/MANIFEST_ONLY.pdf", wantErr: false},
+		{key: "2025/UNRECORDED.pdf", wantErr: false},
+	}
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			if err := VerifyChecksum(ctx, destination, test.key); (err != nil) != test.wantErr {
+				t.Errorf("VerifyChecksum() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+// TestLedgerRecords validates that every manifest entry is returned, along with the hash in its checksum sidecar
+func TestLedgerRecords(t *testing.T) {
+	ctx := context.Background()
+	var manifest strings.Builder
+	for _, entry := range []ManifestEntry{
+		{FileName: "2025/BOOK.pdf", SHA256: "aaaa"},
+		{FileName: "2025/NO_SIDECAR.pdf", SHA256: "bbbb"},
+	} {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatalf("Failed to encode manifest entry: %v", err)
+		}
+		manifest.Write(append(line, '\n'))
+	}
+
+	destination := storage.NewLocal(t.TempDir())
+	files := map[string]string{
+		ManifestFileName:                         manifest.String(),
+		"2025/BOOK.pdf" + ChecksumFileSuffix:     "cccc  BOOK.pdf\n",
+		"2025/UNLISTED.pdf" + ChecksumFileSuffix: "dddd  UNLISTED.pdf\n",
+	}
+	for key, file := range files {
+		if err := destination.Put(ctx, key, strings.NewReader(file), -1); err != nil {
+			t.Fatalf("Put() returned an unexpected error: %v", err)
+		}
+	}
+
+	records, err := LedgerRecords(ctx, destination)
+	if err != nil {
+		t.Fatalf("LedgerRecords() returned an unexpected error: %v", err)
+	}
+	var got []string
+	for _, record := range records {
+		got = append(got, fmt.Sprintf("%s %s %s", record.FileName, record.SHA256, record.Source))
+	}
+	want := []string{
+		"2025/BOOK.pdf aaaa " + ManifestFileName,
+		"2025/BOOK.pdf cccc 2025/BOOK.pdf" + ChecksumFileSuffix,
+		"2025/NO_SIDECAR.pdf bbbb " + ManifestFileName,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected records:\n%s\nbut got:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,196 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/metrics"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// streamedDownload Describes a file that was fully streamed into a partial file
+type streamedDownload struct {
+	Size   int64
+	SHA256 string
+	ETag   string      // Strong ETag of the file, if the server sent one, to tell whether it changes later
+	Header http.Header // Content-Type and the full Content-Length of the file, for validation
+}
+
+// streamDownload streams downloadURL into storeFile, hashing it as it goes. If the connection drops partway through,
+// the download resumes from the last byte received with a Range request when the server supports it.
+func (c *Client) streamDownload(ctx context.Context, downloadURL string, storeFile *partialFile) (streamedDownload, error) {
+	var written int64
+	var validator string // ETag or Last-Modified of the first response, so a resume never stitches two different files together
+	var etag string
+	hasher := sha256.New()
+	contentType := ""
+	totalSize := int64(-1)
+	firstAttempt := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		resumeFrom := written
+		response, err := c.doWithRetry(ctx, func(attemptContext context.Context) (*http.Request, error) {
+			downloadRequest, err := http.NewRequestWithContext(attemptContext, "GET", downloadURL, nil)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create GET request for download: %w", err)
+			}
+			downloadRequest.Header.Set("User-Agent", c.userAgent)
+			if resumeFrom > 0 {
+				downloadRequest.Header.Set("Range", fmt.Sprintf("bytes=%d-", resumeFrom))
+				downloadRequest.Header.Set("If-Range", validator)
+			}
+			return downloadRequest, nil
+		})
+		if err != nil {
+			return streamedDownload{}, fmt.Errorf("failed to download file from URL: %w", err)
+		}
+
+		switch {
+		case response.StatusCode == http.StatusPartialContent && resumeFrom > 0:
+			start, total, ok := parseContentRange(response.Header.Get("Content-Range"))
+			if !ok || start != resumeFrom {
+				closeBody(response)
+				return streamedDownload{}, fmt.Errorf("server resumed the download at the wrong offset: %q", response.Header.Get("Content-Range"))
+			}
+			totalSize = total
+		case response.StatusCode == http.StatusOK:
+			// Either the first attempt, or the server ignored our Range request and is sending the whole file again
+			if written > 0 {
+				if err := restartPartialFile(storeFile, hasher); err != nil {
+					closeBody(response)
+					return streamedDownload{}, err
+				}
+				written = 0
+			}
+			totalSize = response.ContentLength
+			validator = resumeValidator(response.Header)
+			etag = strongETag(response.Header)
+		default:
+			closeBody(response)
+			return streamedDownload{}, &StatusError{Operation: "file download", StatusCode: response.StatusCode}
+		}
+		if contentType == "" {
+			contentType = response.Header.Get("Content-Type")
+		}
+
+		copied, copyErr := io.Copy(io.MultiWriter(storeFile, hasher), response.Body)
+		written += copied
+		closeBody(response)
+		if copyErr == nil {
+			break
+		}
+
+		// Decide whether what we have so far can be resumed
+		if ctx.Err() != nil {
+			return streamedDownload{}, fmt.Errorf("failed to write file: %w", copyErr)
+		}
+		resumable := validator != "" && (response.StatusCode == http.StatusPartialContent || acceptsRanges(response.Header))
+		if !resumable {
+			written, validator = 0, ""
+			if err := restartPartialFile(storeFile, hasher); err != nil {
+				return streamedDownload{}, err
+			}
+		}
+		delay := c.retryPolicy.backoff(attempt)
+		outOfTime := c.retryPolicy.MaxElapsedTime > 0 && time.Since(firstAttempt)+delay > c.retryPolicy.MaxElapsedTime
+		if attempt >= c.retryPolicy.MaxAttempts || outOfTime {
+			return streamedDownload{}, fmt.Errorf("failed to write file: %w", copyErr)
+		}
+		metrics.FastboundRetriesTotal.WithLabelValues(c.accountNumber).Inc()
+		log.Printf("Download interrupted after %d bytes (%v), resuming in %s (attempt %d of %d)\n",
+			written, copyErr, delay.Round(time.Millisecond), attempt+1, c.retryPolicy.MaxAttempts)
+		if err := sleepContext(ctx, delay); err != nil {
+			return streamedDownload{}, fmt.Errorf("failed to write file: %w", err)
+		}
+	}
+
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	if totalSize >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(totalSize, 10))
+	}
+	return streamedDownload{Size: written, SHA256: hex.EncodeToString(hasher.Sum(nil)), ETag: etag, Header: header}, nil
+}
+
+// restartPartialFile empties a partial file and its running hash so the download can start over
+func restartPartialFile(storeFile *partialFile, hasher hash.Hash) error {
+	if err := storeFile.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate %s: %w", storeFile.Name(), err)
+	}
+	if _, err := storeFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind %s: %w", storeFile.Name(), err)
+	}
+	hasher.Reset()
+	return nil
+}
+
+// resumeValidator returns the value to send as If-Range, preferring a strong ETag over Last-Modified
+func resumeValidator(header http.Header) string {
+	if etag := strongETag(header); etag != "" {
+		return etag
+	}
+	return header.Get("Last-Modified")
+}
+
+// strongETag returns the ETag of a response, or a blank string if it has none or only a weak one
+func strongETag(header http.Header) string {
+	if etag := header.Get("ETag"); !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return ""
+}
+
+// acceptsRanges reports whether a response advertised support for byte Range requests
+func acceptsRanges(header http.Header) bool {
+	return strings.EqualFold(strings.TrimSpace(header.Get("Accept-Ranges")), "bytes")
+}
+
+// parseContentRange reads the start offset and total size from a "bytes start-end/total" Content-Range header.
+// The total is -1 when the server does not know it.
+func parseContentRange(contentRange string) (int64, int64, bool) {
+	rangeSpec, found := strings.CutPrefix(contentRange, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	span, totalText, found := strings.Cut(rangeSpec, "/")
+	if !found {
+		return 0, 0, false
+	}
+	startText, _, found := strings.Cut(span, "-")
+	if !found {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(startText, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if totalText == "*" {
+		return start, -1, true
+	}
+	total, err := strconv.ParseInt(totalText, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, total, true
+}
+
+// closeBody closes a response body, logging rather than returning any error
+func closeBody(response *http.Response) {
+	if err := response.Body.Close(); err != nil {
+		log.Printf("Warning: failed to close response body: %v", err)
+	}
+}
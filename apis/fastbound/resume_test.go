@@ -0,0 +1,128 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/storage"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newResumeMockServer creates a mock Fastbound API whose first book download is cut off by interrupt, after which
+// the book is served with full Range support. It returns the server and the Range headers it received.
+func newResumeMockServer(t *testing.T, interrupt func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, *[]string) {
+	var ranges []string
+	getCallCount := 0
+	modTime := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && strings.Contains(r.URL.Path, "/api/Downloads/BoundBook") {
+			w.Header().Set("Content-Type", "application/json")
+			_, err := fmt.Fprintf(w, `{"url": "%s"}`, "http://"+r.Host+"/download/MOCK_BOUND_BOOK.pdf")
+			if err != nil {
+				t.Fatalf("Mock server failed to write response: %v", err)
+			}
+			return
+		}
+		getCallCount++
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", `"mock-bound-book-v1"`)
+		w.Header().Set("Content-Type", "application/pdf")
+		if getCallCount == 1 {
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", fmt.Sprint(len(mockPDF)))
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(mockPDF[:len(mockPDF)/2])
+			interrupt(w, r)
+			return
+		}
+		http.ServeContent(w, r, "MOCK_BOUND_BOOK.pdf", modTime, bytes.NewReader(mockPDF))
+	}))
+	return mockServer, &ranges
+}
+
+// TestDownloadBoundBook_ResumesDroppedConnection validates that a dropped download resumes where it left off
+func TestDownloadBoundBook_ResumesDroppedConnection(t *testing.T) {
+	// Returning early with a short body makes the client see the connection drop
+	mockServer, ranges := newResumeMockServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com",
+		WithRetryPolicy(testRetryPolicy))
+	savedFilePath, err := testClient.DownloadBoundBook(context.Background(), storage.NewLocal(tempDir))
+	if err != nil {
+		t.Fatalf("DownloadBoundBook() returned an unexpected error: %v", err)
+	}
+
+	expectedRanges := []string{"", fmt.Sprintf("bytes=%d-", len(mockPDF)/2)}
+	if strings.Join(*ranges, ",") != strings.Join(expectedRanges, ",") {
+		t.Errorf("Expected Range headers %q, but got %q", expectedRanges, *ranges)
+	}
+	content, err := os.ReadFile(savedFilePath)
+	if err != nil || !bytes.Equal(content, mockPDF) {
+		t.Errorf("Expected the resumed file to match the original (%v)", err)
+	}
+}
+
+// TestDownloadBoundBook_ResumesStalledDownload validates that a download that stops sending data is aborted and resumed
+func TestDownloadBoundBook_ResumesStalledDownload(t *testing.T) {
+	// Hang after sending half the file until the client gives up on us
+	mockServer, ranges := newResumeMockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com",
+		WithRetryPolicy(testRetryPolicy), WithStallTimeout(200*time.Millisecond))
+	started := time.Now()
+	savedFilePath, err := testClient.DownloadBoundBook(context.Background(), storage.NewLocal(tempDir))
+	if err != nil {
+		t.Fatalf("DownloadBoundBook() returned an unexpected error: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Errorf("Expected the stall to be detected quickly, but the download took %s", elapsed)
+	}
+	if len(*ranges) != 2 || (*ranges)[1] != fmt.Sprintf("bytes=%d-", len(mockPDF)/2) {
+		t.Errorf("Expected the second request to resume from the middle of the file, but got %q", *ranges)
+	}
+	content, err := os.ReadFile(savedFilePath)
+	if err != nil || !bytes.Equal(content, mockPDF) {
+		t.Errorf("Expected the resumed file to match the original (%v)", err)
+	}
+}
+
+// TestParseContentRange validates the parseContentRange function
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header    string
+		wantStart int64
+		wantTotal int64
+		wantOK    bool
+	}{
+		{header: "bytes 100-199/200", wantStart: 100, wantTotal: 200, wantOK: true},
+		{header: "bytes 100-199/*", wantStart: 100, wantTotal: -1, wantOK: true},
+		{header: "bytes */200", wantOK: false},
+		{header: "", wantOK: false},
+	}
+	for _, test := range tests {
+		start, total, ok := parseContentRange(test.header)
+		if ok != test.wantOK || (ok && (start != test.wantStart || total != test.wantTotal)) {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v", test.header, start, total, ok)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"context"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/metrics"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how failed Fastbound requests are retried
+type RetryPolicy struct {
+	MaxAttempts     int           // Total attempts including the first one. 1 disables retries.
+	MaxElapsedTime  time.Duration // Give up once this much time has passed since the first attempt
+	InitialInterval time.Duration // Backoff before the first retry, doubled on every retry after that
+	MaxInterval     time.Duration // Upper bound of any single backoff
+}
+
+// DefaultRetryPolicy is used unless overridden with WithRetryPolicy
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:     5,
+	MaxElapsedTime:  5 * time.Minute,
+	InitialInterval: 1 * time.Second,
+	MaxInterval:     30 * time.Second,
+}
+
+// WithRetryPolicy overrides how failed requests are retried
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+// retryableStatusCodes are HTTP statuses that indicate a temporary problem worth retrying
+var retryableStatusCodes = map[int]bool{
+	http.StatusRequestTimeout:      true,
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// doWithRetry sends the request built by newRequest, retrying temporary failures according to the Client's RetryPolicy.
+// Each attempt must connect and respond within the API timeout, after which the returned body must keep
+// delivering data within the stall timeout until it is closed.
+// The last response is returned as is, so callers still need to check its status code.
+func (c *Client) doWithRetry(ctx context.Context, newRequest func(context.Context) (*http.Request, error)) (*http.Response, error) {
+	policy := c.retryPolicy
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	firstAttempt := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		attemptContext, attemptWatchdog := newWatchdog(ctx, c.apiTimeout)
+		request, err := newRequest(attemptContext)
+		if err != nil {
+			attemptWatchdog.stop()
+			return nil, err
+		}
+
+		response, err := c.httpClient.Do(request)
+		err = attemptWatchdog.wrapErr(err)
+		if err == nil && !retryableStatusCodes[response.StatusCode] {
+			attemptWatchdog.switchTo(c.stallTimeout)
+			response.Body = progressBody{ReadCloser: response.Body, watchdog: attemptWatchdog}
+			return response, nil
+		}
+
+		// Work out why this attempt failed and how long the server asked us to wait
+		var failure string
+		var retryAfter time.Duration
+		if err != nil {
+			// A cancelled or expired parent context is never worth retrying
+			if ctx.Err() != nil {
+				attemptWatchdog.stop()
+				return nil, err
+			}
+			failure = err.Error()
+		} else {
+			failure = fmt.Sprintf("status %d", response.StatusCode)
+			retryAfter = parseRetryAfter(response.Header.Get("Retry-After"), time.Now())
+		}
+
+		delay := policy.backoff(attempt)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		outOfAttempts := attempt >= policy.MaxAttempts
+		outOfTime := policy.MaxElapsedTime > 0 && time.Since(firstAttempt)+delay > policy.MaxElapsedTime
+		if outOfAttempts || outOfTime {
+			if err != nil {
+				attemptWatchdog.stop()
+				return nil, err
+			}
+			// Hand the final response back so the caller can report its status and body
+			attemptWatchdog.switchTo(c.stallTimeout)
+			response.Body = progressBody{ReadCloser: response.Body, watchdog: attemptWatchdog}
+			return response, nil
+		}
+
+		// Release this attempt before waiting on the next one
+		if response != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+			if err := response.Body.Close(); err != nil {
+				log.Printf("Warning: failed to close retried response body: %v", err)
+			}
+		}
+		attemptWatchdog.stop()
+
+		metrics.FastboundRetriesTotal.WithLabelValues(c.accountNumber).Inc()
+		log.Printf("%s %s failed with %s, retrying in %s (attempt %d of %d)\n",
+			request.Method, request.URL.Redacted(), failure, delay.Round(time.Millisecond), attempt+1, policy.MaxAttempts)
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, fmt.Errorf("gave up retrying %s %s: %w", request.Method, request.URL.Redacted(), err)
+		}
+	}
+}
+
+// sleepContext waits for delay, returning early with the context's error if it is cancelled first
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// backoff returns a jittered exponential delay to wait before the retry following attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	if p.InitialInterval <= 0 {
+		return 0
+	}
+	delay := p.InitialInterval
+	for i := 1; i < attempt && (p.MaxInterval <= 0 || delay < p.MaxInterval); i++ {
+		delay *= 2
+	}
+	if p.MaxInterval > 0 && delay > p.MaxInterval {
+		delay = p.MaxInterval
+	}
+	// Wait at least half the delay, with the rest randomized so clients don't retry in lockstep
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// parseRetryAfter reads a Retry-After header in either delay-seconds or HTTP-date form
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if retryTime, err := http.ParseTime(header); err == nil {
+		if delay := retryTime.Sub(now); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
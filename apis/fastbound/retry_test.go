@@ -0,0 +1,154 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRetryPolicy retries quickly so tests don't wait on real backoff
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:     3,
+	MaxElapsedTime:  5 * time.Second,
+	InitialInterval: time.Millisecond,
+	MaxInterval:     5 * time.Millisecond,
+}
+
+// TestDoWithRetry_RecoversFromTemporaryFailures validates that 429 and 502 responses are retried until the API succeeds
+func TestDoWithRetry_RecoversFromTemporaryFailures(t *testing.T) {
+	postCallCount := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		postCallCount++
+		switch postCallCount {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			_, err := fmt.Fprint(w, `{"url": "https://storage.example.com/MOCK_BOUND_BOOK.pdf"}`)
+			if err != nil {
+				t.Fatalf("Mock server failed to write response: %v", err)
+			}
+		}
+	}))
+	defer mockServer.Close()
+
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com",
+		WithRetryPolicy(testRetryPolicy))
+	downloadURL, err := testClient.requestDownloadURL(context.Background(), "api/Downloads/BoundBook")
+	if err != nil {
+		t.Fatalf("requestDownloadURL() returned an unexpected error: %v", err)
+	}
+	if downloadURL != "https://storage.example.com/MOCK_BOUND_BOOK.pdf" {
+		t.Errorf("Expected the download URL from the API, but got '%s'", downloadURL)
+	}
+	if postCallCount != 3 {
+		t.Errorf("Expected 3 POST attempts, but got %d", postCallCount)
+	}
+}
+
+// TestDoWithRetry_GivesUp validates that retries stop after MaxAttempts and the last status is reported
+func TestDoWithRetry_GivesUp(t *testing.T) {
+	postCallCount := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		postCallCount++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer mockServer.Close()
+
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com",
+		WithRetryPolicy(testRetryPolicy))
+	_, err := testClient.requestDownloadURL(context.Background(), "api/Downloads/BoundBook")
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Expected a 503 error after giving up, but got: %v", err)
+	}
+	if postCallCount != testRetryPolicy.MaxAttempts {
+		t.Errorf("Expected %d POST attempts, but got %d", testRetryPolicy.MaxAttempts, postCallCount)
+	}
+}
+
+// TestDoWithRetry_DoesNotRetryClientErrors validates that a 401 fails immediately
+func TestDoWithRetry_DoesNotRetryClientErrors(t *testing.T) {
+	postCallCount := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		postCallCount++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer mockServer.Close()
+
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com",
+		WithRetryPolicy(testRetryPolicy))
+	if _, err := testClient.requestDownloadURL(context.Background(), "api/Downloads/BoundBook"); err == nil {
+		t.Errorf("Expected an error for a 401 response, but got none")
+	}
+	if postCallCount != 1 {
+		t.Errorf("Expected 1 POST attempt, but got %d", postCallCount)
+	}
+}
+
+// TestDoWithRetry_RetryAfterExceedsMaxElapsedTime validates that a Retry-After longer than the retry budget is not waited on
+func TestDoWithRetry_RetryAfterExceedsMaxElapsedTime(t *testing.T) {
+	postCallCount := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		postCallCount++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer mockServer.Close()
+
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com",
+		WithRetryPolicy(testRetryPolicy))
+	if _, err := testClient.requestDownloadURL(context.Background(), "api/Downloads/BoundBook"); err == nil {
+		t.Errorf("Expected an error for a 429 response, but got none")
+	}
+	if postCallCount != 1 {
+		t.Errorf("Expected 1 POST attempt, but got %d", postCallCount)
+	}
+}
+
+// TestParseRetryAfter validates both forms of the Retry-After header
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{name: "Blank header", header: "", want: 0},
+		{name: "Delay in seconds", header: "120", want: 2 * time.Minute},
+		{name: "HTTP date", header: now.Add(30 * time.Second).Format(http.TimeFormat), want: 30 * time.Second},
+		{name: "HTTP date in the past", header: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{name: "Garbage", header: "soon", want: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseRetryAfter(test.header, now); got != test.want {
+				t.Errorf("parseRetryAfter(%q) = %v, want %v", test.header, got, test.want)
+			}
+		})
+	}
+}
+
+// TestRetryPolicyBackoff validates that backoff grows exponentially, is jittered, and is capped
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialInterval: time.Second, MaxInterval: 8 * time.Second}
+	for attempt, ceiling := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: 8 * time.Second} {
+		for i := 0; i < 50; i++ {
+			delay := policy.backoff(attempt)
+			if delay < ceiling/2 || delay > ceiling {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", attempt, delay, ceiling/2, ceiling)
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/signature"
+	"github.com/route1337/fastbound-downloader/storage"
+	"io"
+)
+
+// WithSigner makes the Client write a detached signature next to every file it downloads. By default nothing is signed.
+func WithSigner(signer signature.Signer) ClientOption {
+	return func(c *Client) {
+		c.signer = signer
+	}
+}
+
+// writeSignatureFile signs the downloaded file in storeFile and stores the signature next to where key will be stored
+func (c *Client) writeSignatureFile(ctx context.Context, destination storage.Backend, key string, storeFile io.ReadSeeker) error {
+	if c.signer == nil {
+		return nil
+	}
+	if _, err := storeFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind the download of %s: %w", key, err)
+	}
+	signed, err := c.signer.Sign(storeFile)
+	if err != nil {
+		return fmt.Errorf("failed to sign %s: %w", destination.Location(key), err)
+	}
+	signatureKey := key + c.signer.FileSuffix()
+	if err := destination.Put(ctx, signatureKey, bytes.NewReader(signed), int64(len(signed))); err != nil {
+		return fmt.Errorf("failed to write signature for %s: %w", destination.Location(key), err)
+	}
+	return nil
+}
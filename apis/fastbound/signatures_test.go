@@ -0,0 +1,87 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/signature"
+	"github.com/route1337/fastbound-downloader/storage"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestSigningKeys writes a fresh Ed25519 key pair as PEM files and returns their paths
+func writeTestSigningKeys(t *testing.T) (string, string) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate a signing key: %v", err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to encode the signing key: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("Failed to encode the public key: %v", err)
+	}
+	keyDir := t.TempDir()
+	privateKeyPath, publicKeyPath := filepath.Join(keyDir, "signing.pem"), filepath.Join(keyDir, "signing.pub")
+	if err := os.WriteFile(privateKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0400); err != nil {
+		t.Fatalf("Failed to write the signing key: %v", err)
+	}
+	if err := os.WriteFile(publicKeyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0400); err != nil {
+		t.Fatalf("Failed to write the public key: %v", err)
+	}
+	return privateKeyPath, publicKeyPath
+}
+
+// TestDownloadBoundBook_Signed validates that a saved book gets a detached signature that verifies against the public key
+func TestDownloadBoundBook_Signed(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && strings.Contains(r.URL.Path, "/api/Downloads/BoundBook") {
+			w.Header().Set("Content-Type", "application/json")
+			_, err := fmt.Fprintf(w, `{"url": "%s"}`, "http://"+r.Host+"/download/MOCK_BOUND_BOOK.pdf")
+			if err != nil {
+				t.Fatalf("Mock server failed to write response: %v", err)
+			}
+			return
+		}
+		_, _ = w.Write(mockPDF)
+	}))
+	defer mockServer.Close()
+
+	privateKeyPath, publicKeyPath := writeTestSigningKeys(t)
+	signer, err := signature.NewSigner("ed25519", privateKeyPath, "")
+	if err != nil {
+		t.Fatalf("NewSigner() returned an unexpected error: %v", err)
+	}
+	tempDir := t.TempDir()
+	destination := storage.NewLocal(tempDir)
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com", WithSigner(signer))
+	if _, err := testClient.DownloadBoundBook(context.Background(), destination); err != nil {
+		t.Fatalf("DownloadBoundBook() returned an unexpected error: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDir, "MOCK_BOUND_BOOK.pdf"+signature.Ed25519FileSuffix)); err != nil {
+		t.Fatalf("Expected a signature next to the saved book: %v", err)
+	}
+	verifier, err := signature.NewVerifier(publicKeyPath)
+	if err != nil {
+		t.Fatalf("NewVerifier() returned an unexpected error: %v", err)
+	}
+	if err := signature.VerifyFile(context.Background(), destination, verifier, "MOCK_BOUND_BOOK.pdf"); err != nil {
+		t.Errorf("Expected the saved book to match its signature, but got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// WithAPITimeout overrides how long connecting and waiting for the response headers may take. The body is then read
+// under the stall timeout.
+func WithAPITimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.apiTimeout = timeout
+	}
+}
+
+// WithStallTimeout overrides how long a download may go without receiving any data before it is aborted
+func WithStallTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.stallTimeout = timeout
+	}
+}
+
+// watchdog cancels an attempt's context when it stops making progress. It starts on the API timeout and
+// switches to the stall timeout once the response body is being read, so a slow but steady download never times out.
+type watchdog struct {
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	fired   atomic.Bool
+	timeout atomic.Int64
+}
+
+// newWatchdog derives a cancellable context from ctx that is cancelled if the watchdog is not fed within timeout
+func newWatchdog(ctx context.Context, timeout time.Duration) (context.Context, *watchdog) {
+	attemptContext, cancel := context.WithCancel(ctx)
+	w := &watchdog{cancel: cancel}
+	// Start disarmed and let switchTo arm it, so a timeout of 0 never fires
+	w.timer = time.AfterFunc(time.Duration(math.MaxInt64), w.expire)
+	w.switchTo(timeout)
+	return attemptContext, w
+}
+
+// expire cancels the attempt because it made no progress in time
+func (w *watchdog) expire() {
+	w.fired.Store(true)
+	w.cancel()
+}
+
+// feed pushes the deadline out by the current timeout from now
+func (w *watchdog) feed() {
+	if timeout := time.Duration(w.timeout.Load()); timeout > 0 {
+		w.timer.Reset(timeout)
+	}
+}
+
+// switchTo changes the timeout used by the watchdog and restarts it. A timeout of 0 disables it.
+func (w *watchdog) switchTo(timeout time.Duration) {
+	w.timeout.Store(int64(timeout))
+	if timeout <= 0 {
+		w.timer.Stop()
+		return
+	}
+	w.timer.Reset(timeout)
+}
+
+// stop releases the watchdog and its context
+func (w *watchdog) stop() {
+	w.timer.Stop()
+	w.cancel()
+}
+
+// wrapErr explains an error caused by the watchdog firing
+func (w *watchdog) wrapErr(err error) error {
+	if err != nil && w.fired.Load() {
+		return fmt.Errorf("no progress within %s: %w", time.Duration(w.timeout.Load()), err)
+	}
+	return err
+}
+
+// progressBody feeds a watchdog every time data arrives and releases it when closed
+type progressBody struct {
+	io.ReadCloser
+	watchdog *watchdog
+}
+
+func (b progressBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.watchdog.feed()
+	}
+	return n, b.watchdog.wrapErr(err)
+}
+
+func (b progressBody) Close() error {
+	defer b.watchdog.stop()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,193 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/storage"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// minimumPDFSize is the smallest file we accept as a real bound book or 4473. Error pages and empty bodies fall below it.
+const minimumPDFSize = 1024
+
+// pdfMarkerWindow is how far from the start and end of a file the PDF header and trailer may appear
+const pdfMarkerWindow = 1024
+
+// acceptedContentTypes are the Content-Type values storage may serve a PDF with
+var acceptedContentTypes = map[string]bool{
+	"application/pdf":          true,
+	"application/x-pdf":        true,
+	"application/octet-stream": true,
+	"binary/octet-stream":      true,
+}
+
+// ValidationError A download that was rejected because it is not a complete PDF
+type ValidationError struct {
+	FileName       string // Name of the file as served by Fastbound
+	Reason         string // Why the download was rejected
+	QuarantinePath string // Where the rejected download was moved, blank if it could not be kept
+}
+
+func (e *ValidationError) Error() string {
+	if e.QuarantinePath == "" {
+		return fmt.Sprintf("download of %s was rejected: %s", e.FileName, e.Reason)
+	}
+	return fmt.Sprintf("download of %s was rejected and quarantined to %s: %s", e.FileName, e.QuarantinePath, e.Reason)
+}
+
+// WithQuarantineDir sets where rejected downloads are moved. By default they go to a quarantine folder in the staging directory.
+func WithQuarantineDir(dir string) ClientOption {
+	return func(c *Client) {
+		c.quarantineDir = dir
+	}
+}
+
+// WithQuarantineCipher encrypts rejected downloads with cipher as they are quarantined, so they are no more readable than
+// archived records. By default they are quarantined as they were downloaded.
+func WithQuarantineCipher(cipher storage.Cipher) ClientOption {
+	return func(c *Client) {
+		c.quarantineCipher = cipher
+	}
+}
+
+// validatePDF checks that a downloaded file of size bytes is a complete PDF and matches what the server said it was sending
+func validatePDF(file io.ReaderAt, size int64, header http.Header) error {
+	if contentType := header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || !acceptedContentTypes[mediaType] {
+			return fmt.Errorf("unexpected Content-Type %q", contentType)
+		}
+	}
+	if contentLength := header.Get("Content-Length"); contentLength != "" {
+		expectedSize, err := strconv.ParseInt(contentLength, 10, 64)
+		if err == nil && expectedSize != size {
+			return fmt.Errorf("received %d bytes but Content-Length was %d", size, expectedSize)
+		}
+	}
+	if size < minimumPDFSize {
+		return fmt.Errorf("file is %d bytes, smaller than the %d byte minimum", size, minimumPDFSize)
+	}
+
+	window := int64(pdfMarkerWindow)
+	if size < window {
+		window = size
+	}
+	head := make([]byte, window)
+	if _, err := file.ReadAt(head, 0); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read the file header: %w", err)
+	}
+	if !bytes.Contains(head, []byte("%PDF-")) {
+		return fmt.Errorf("missing %%PDF- header")
+	}
+	tail := make([]byte, window)
+	if _, err := file.ReadAt(tail, size-window); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to read the file trailer: %w", err)
+	}
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		return fmt.Errorf("missing %%%%EOF trailer")
+	}
+	return nil
+}
+
+// quarantine moves a rejected partial download out of the staging directory and describes why it was rejected
+func (c *Client) quarantine(storeFile *partialFile, fileName string, reason error) error {
+	validationErr := &ValidationError{FileName: fileName, Reason: reason.Error()}
+
+	quarantineDir := c.quarantineDir
+	if quarantineDir == "" {
+		quarantineDir = filepath.Join(c.stagingDir, "quarantine")
+	}
+	if err := os.MkdirAll(quarantineDir, 0750); err != nil {
+		log.Printf("Warning: failed to quarantine the rejected download of %s: %v\n", fileName, err)
+		return validationErr
+	}
+	_ = storeFile.Close()
+	quarantinePath := filepath.Join(quarantineDir, time.Now().UTC().Format("20060102T150405Z")+"-"+fileName)
+	if c.quarantineCipher != nil {
+		// The staged download is left for abort to remove once its encrypted copy is in quarantine
+		quarantinePath += storage.EncryptedFileSuffix
+		if err := copyFile(storeFile.Name(), quarantinePath, c.quarantineCipher); err != nil {
+			log.Printf("Warning: failed to quarantine the rejected download of %s to %s: %v\n", fileName, quarantinePath, err)
+			return validationErr
+		}
+		validationErr.QuarantinePath = quarantinePath
+		return validationErr
+	}
+	if err := moveFile(storeFile.Name(), quarantinePath); err != nil {
+		log.Printf("Warning: failed to quarantine the rejected download of %s to %s: %v\n", fileName, quarantinePath, err)
+		return validationErr
+	}
+	storeFile.done = true
+	validationErr.QuarantinePath = quarantinePath
+	return validationErr
+}
+
+// renameFile renames a file. Tests replace it to act like the staging and quarantine directories are on different filesystems.
+var renameFile = os.Rename
+
+// moveFile moves source to destination, copying it when they are on different filesystems and a rename is not possible
+func moveFile(source string, destination string) error {
+	err := renameFile(source, destination)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyFile(source, destination, nil); err != nil {
+		return err
+	}
+	return os.Remove(source)
+}
+
+// copyFile copies source to a new file at destination, encrypting it with cipher unless it is nil, and syncs it to disk.
+// Nothing is left at destination if it fails.
+func copyFile(source string, destination string, cipher storage.Cipher) (err error) {
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = sourceFile.Close()
+	}()
+	destinationFile, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = destinationFile.Close()
+			_ = os.Remove(destination)
+		}
+	}()
+	var writer io.WriteCloser = destinationFile
+	if cipher != nil {
+		if writer, err = cipher.Encrypt(destinationFile); err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", destination, err)
+		}
+	}
+	if _, err := io.Copy(writer, sourceFile); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", source, destination, err)
+	}
+	if cipher != nil {
+		// Finishing the encryption writes its last chunk but leaves the file open
+		if err := writer.Close(); err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", destination, err)
+		}
+	}
+	if err := destinationFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", destination, err)
+	}
+	return destinationFile.Close()
+}
@@ -0,0 +1,207 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package fastbound
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/storage"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// mockPDF is a small file that passes PDF validation, for mock servers to hand out as a bound book or 4473
+var mockPDF = []byte("%PDF-1.7\n" + strings.Repeat("% Guns. Lots of guns.\n", 64) + "%%EOF\n")
+
+// TestValidatePDF validates the validatePDF function
+func TestValidatePDF(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     []byte
+		contentType string
+		wantErr     bool
+	}{
+		{name: "Valid PDF", content: mockPDF, contentType: "application/pdf", wantErr: false},
+		{name: "Valid PDF served as octet-stream", content: mockPDF, contentType: "application/octet-stream", wantErr: false},
+		{name: "Valid PDF without a Content-Type", content: mockPDF, contentType: "", wantErr: false},
+		{name: "HTML error page", content: []byte("<html>" + strings.Repeat("Access Denied ", 100) + "</html>"), contentType: "text/html; charset=utf-8", wantErr: true},
+		{name: "HTML error page with a PDF Content-Type", content: []byte("<html>" + strings.Repeat("Access Denied ", 100) + "</html>"), contentType: "application/pdf", wantErr: true},
+		{name: "Empty body", content: []byte{}, contentType: "application/pdf", wantErr: true},
+		{name: "Truncated PDF", content: mockPDF[:len(mockPDF)-10], contentType: "application/pdf", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			if test.contentType != "" {
+				header.Set("Content-Type", test.contentType)
+			}
+			err := validatePDF(bytes.NewReader(test.content), int64(len(test.content)), header)
+			if (err != nil) != test.wantErr {
+				t.Errorf("validatePDF() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+
+	// A Content-Length that doesn't match what was received means the file is incomplete
+	t.Run("Mismatched Content-Length", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("Content-Length", fmt.Sprint(len(mockPDF)+100))
+		if err := validatePDF(bytes.NewReader(mockPDF), int64(len(mockPDF)), header); err == nil {
+			t.Errorf("Expected an error for a mismatched Content-Length, but got none")
+		}
+	})
+}
+
+// TestDownloadBoundBook_Quarantine validates that a download that is not a PDF is quarantined instead of saved
+func TestDownloadBoundBook_Quarantine(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && strings.Contains(r.URL.Path, "/api/Downloads/BoundBook") {
+			w.Header().Set("Content-Type", "application/json")
+			_, err := fmt.Fprintf(w, `{"url": "%s"}`, "http://"+r.Host+"/download/MOCK_BOUND_BOOK.pdf")
+			if err != nil {
+				t.Fatalf("Mock server failed to write response: %v", err)
+			}
+			return
+		}
+		// Storage answers 200 with an error page instead of the book
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><body>Signature expired</body></html>"))
+	}))
+	defer mockServer.Close()
+
+	tempDir := t.TempDir()
+	quarantineDir := filepath.Join(t.TempDir(), "quarantine")
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com",
+		WithQuarantineDir(quarantineDir))
+	_, err := testClient.DownloadBoundBook(context.Background(), storage.NewLocal(tempDir))
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError, but got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "MOCK_BOUND_BOOK.pdf")); !os.IsNotExist(err) {
+		t.Errorf("Expected the rejected download to not be saved as the bound book")
+	}
+	if filepath.Dir(validationErr.QuarantinePath) != quarantineDir {
+		t.Errorf("Expected the rejected download in %s, but got '%s'", quarantineDir, validationErr.QuarantinePath)
+	}
+	if _, err := os.Stat(validationErr.QuarantinePath); err != nil {
+		t.Errorf("Expected the rejected download to be kept in quarantine: %v", err)
+	}
+}
+
+// TestDownloadBoundBook_QuarantineAcrossFilesystems validates that a rejected download is copied into quarantine when
+// it can't be renamed there because the staging directory is on another filesystem
+func TestDownloadBoundBook_QuarantineAcrossFilesystems(t *testing.T) {
+	errorPage := []byte("<html><body>Signature expired</body></html>")
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && strings.Contains(r.URL.Path, "/api/Downloads/BoundBook") {
+			w.Header().Set("Content-Type", "application/json")
+			_, err := fmt.Fprintf(w, `{"url": "%s"}`, "http://"+r.Host+"/download/MOCK_BOUND_BOOK.pdf")
+			if err != nil {
+				t.Fatalf("Mock server failed to write response: %v", err)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write(errorPage)
+	}))
+	defer mockServer.Close()
+
+	// Refuse every rename like the kernel does between filesystems
+	renameFile = func(source string, destination string) error {
+		return &os.LinkError{Op: "rename", Old: source, New: destination, Err: syscall.EXDEV}
+	}
+	defer func() {
+		renameFile = os.Rename
+	}()
+
+	stagingDir := t.TempDir()
+	quarantineDir := filepath.Join(t.TempDir(), "quarantine")
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com",
+		WithStagingDir(stagingDir), WithQuarantineDir(quarantineDir))
+	_, err := testClient.DownloadBoundBook(context.Background(), storage.NewLocal(t.TempDir()))
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError, but got: %v", err)
+	}
+	if filepath.Dir(validationErr.QuarantinePath) != quarantineDir {
+		t.Fatalf("Expected the rejected download in %s, but got '%s'", quarantineDir, validationErr.QuarantinePath)
+	}
+	quarantined, err := os.ReadFile(validationErr.QuarantinePath)
+	if err != nil || !bytes.Equal(quarantined, errorPage) {
+		t.Errorf("Expected the rejected download to be copied into quarantine intact, but got %q: %v", quarantined, err)
+	}
+	if entries, _ := os.ReadDir(stagingDir); len(entries) != 0 {
+		t.Errorf("Expected the staging directory to be left empty, but it has %d file(s)", len(entries))
+	}
+}
+
+// TestDownloadBoundBook_QuarantineEncrypted validates that rejected downloads are encrypted when a quarantine cipher is set
+func TestDownloadBoundBook_QuarantineEncrypted(t *testing.T) {
+	errorPage := []byte("<html><body>Signature expired</body></html>")
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && strings.Contains(r.URL.Path, "/api/Downloads/BoundBook") {
+			w.Header().Set("Content-Type", "application/json")
+			_, err := fmt.Fprintf(w, `{"url": "%s"}`, "http://"+r.Host+"/download/MOCK_BOUND_BOOK.pdf")
+			if err != nil {
+				t.Fatalf("Mock server failed to write response: %v", err)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write(errorPage)
+	}))
+	defer mockServer.Close()
+
+	keyFile := filepath.Join(t.TempDir(), "books.key")
+	if err := os.WriteFile(keyFile, []byte(strings.Repeat("ab", 32)), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	cipher, err := storage.NewAESGCMCipher(keyFile)
+	if err != nil {
+		t.Fatalf("NewAESGCMCipher() returned an unexpected error: %v", err)
+	}
+
+	stagingDir := t.TempDir()
+	testClient := NewClient(mockServer.URL, "123456", "kkJ4K3dHoHqZzNvoDJ", "pgibbons@initech.com",
+		WithStagingDir(stagingDir), WithQuarantineDir(filepath.Join(t.TempDir(), "quarantine")), WithQuarantineCipher(cipher))
+	_, err = testClient.DownloadBoundBook(context.Background(), storage.NewLocal(t.TempDir()))
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected a ValidationError, but got: %v", err)
+	}
+	if !strings.HasSuffix(validationErr.QuarantinePath, storage.EncryptedFileSuffix) {
+		t.Fatalf("Expected the rejected download to be quarantined encrypted, but got '%s'", validationErr.QuarantinePath)
+	}
+	quarantinedFile, err := os.Open(validationErr.QuarantinePath)
+	if err != nil {
+		t.Fatalf("Failed to open the quarantined download: %v", err)
+	}
+	defer func() {
+		_ = quarantinedFile.Close()
+	}()
+	plaintext, err := cipher.Decrypt(quarantinedFile)
+	if err != nil {
+		t.Fatalf("Failed to decrypt the quarantined download: %v", err)
+	}
+	if decrypted, err := io.ReadAll(plaintext); err != nil || !bytes.Equal(decrypted, errorPage) {
+		t.Errorf("Expected the rejected download to decrypt intact, but got %q: %v", decrypted, err)
+	}
+	if entries, _ := os.ReadDir(stagingDir); len(entries) != 0 {
+		t.Errorf("Expected the staging directory to be left empty, but it has %d file(s)", len(entries))
+	}
+}
@@ -9,57 +9,435 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 )
 
+// FastboundCredentials The credentials and audit user for one Fastbound account
+type FastboundCredentials struct {
+	AccountNumber string `json:"account-number"`
+	ApiKey        string `json:"api-key"`
+	AuditUser     string `json:"audit-user"`
+}
+
+// QuarantineDirName and StagingDirName name the default quarantine and staging folders inside the bound book path
+const (
+	QuarantineDirName = "quarantine"
+	StagingDirName    = ".staging"
+)
+
+// AccountPaths Where one account's downloads are saved
+type AccountPaths struct {
+	BoundBooks       string `json:"bound-books"`
+	BackgroundChecks string `json:"background-checks"`
+	Quarantine       string `json:"quarantine,omitempty"`
+	Staging          string `json:"staging,omitempty"`
+}
+
+// S3Settings Where and how to connect to an S3 compatible bucket
+type S3Settings struct {
+	Endpoint             string `json:"endpoint,omitempty"`
+	Bucket               string `json:"bucket"`
+	Prefix               string `json:"prefix,omitempty"`
+	Region               string `json:"region,omitempty"`
+	PathStyle            bool   `json:"path-style,omitempty"`
+	AccessKeyID          string `json:"access-key-id,omitempty"`
+	SecretAccessKey      string `json:"secret-access-key,omitempty"`
+	ServerSideEncryption string `json:"server-side-encryption,omitempty"`
+	KMSKeyID             string `json:"kms-key-id,omitempty"`
+	PartSizeInMB         uint   `json:"part-size,omitempty"`
+	ObjectLock           struct {
+		Mode            string `json:"mode,omitempty"`
+		RetentionInDays uint   `json:"retention-days,omitempty"`
+		LegalHold       bool   `json:"legal-hold,omitempty"`
+	} `json:"object-lock,omitempty"`
+}
+
+// SFTPSettings Where and how to connect to an SFTP server
+type SFTPSettings struct {
+	Address              string `json:"address"`
+	User                 string `json:"user"`
+	PrivateKey           string `json:"private-key"`
+	PrivateKeyPassphrase string `json:"private-key-passphrase,omitempty"`
+	KnownHosts           string `json:"known-hosts"`
+	RemoteDir            string `json:"remote-dir"`
+}
+
+// WebDAVSettings Where and how to connect to a WebDAV share such as Nextcloud
+type WebDAVSettings struct {
+	URL         string `json:"url"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	BearerToken string `json:"bearer-token,omitempty"`
+	CAFile      string `json:"ca-file,omitempty"`
+}
+
+// AzureSettings Where and how to connect to an Azure Blob Storage container
+type AzureSettings struct {
+	ServiceURL    string `json:"service-url,omitempty"`
+	AccountName   string `json:"account-name,omitempty"`
+	AccountKey    string `json:"account-key,omitempty"`
+	SASToken      string `json:"sas-token,omitempty"`
+	Container     string `json:"container"`
+	Prefix        string `json:"prefix,omitempty"`
+	BlockSizeInMB uint   `json:"block-size,omitempty"`
+	Immutability  struct {
+		Mode            string `json:"mode,omitempty"`
+		RetentionInDays uint   `json:"retention-days,omitempty"`
+		LegalHold       bool   `json:"legal-hold,omitempty"`
+	} `json:"immutability,omitempty"`
+}
+
+// StorageSettings Where an account's bound books are archived
+type StorageSettings struct {
+	Name   string         `json:"name,omitempty"` // Tells destinations apart in logs and metrics
+	Type   string         `json:"type,omitempty"`
+	Path   string         `json:"path,omitempty"` // Where a local destination stores bound books instead of the bound book path
+	S3     S3Settings     `json:"s3"`
+	SFTP   SFTPSettings   `json:"sftp"`
+	WebDAV WebDAVSettings `json:"webdav"`
+	Azure  AzureSettings  `json:"azure"`
+}
+
+// EncryptionSettings How archived records are encrypted before they are stored, with either age or a key file
+type EncryptionSettings struct {
+	AgeRecipients    []string `json:"age-recipients,omitempty"`
+	AgeIdentityFile  string   `json:"age-identity-file,omitempty"` // Decrypts records to verify the ledger and rotate keys
+	KeyFile          string   `json:"key-file,omitempty"`
+	PreviousKeyFiles []string `json:"previous-key-files,omitempty"` // Decrypt records encrypted before the key file was rotated
+}
+
+// SigningSettings Which private key signs every downloaded file, either an ed25519 PEM key or an armored openpgp key
+type SigningSettings struct {
+	Type       string `json:"type,omitempty"`
+	PrivateKey string `json:"private-key,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"` // Unlocks an openpgp private key protected by a passphrase
+}
+
+// PushgatewaySettings Where metrics are pushed at the end of each cycle in cron mode, when there is no metrics server to scrape
+type PushgatewaySettings struct {
+	URL      string            `json:"url,omitempty"`
+	Job      string            `json:"job,omitempty"`
+	Grouping map[string]string `json:"grouping,omitempty"` // Labels telling apart several deployments pushing to the same job
+	Username string            `json:"username,omitempty"`
+	Password string            `json:"password,omitempty"`
+}
+
+// TextfileCollectorSettings Where metrics are written after each cycle for the node_exporter textfile collector
+type TextfileCollectorSettings struct {
+	Directory string `json:"directory,omitempty"`
+	FileName  string `json:"file-name,omitempty"`
+}
+
+// ReplicationSettings How to decide a bound book was archived when it is copied to several destinations
+type ReplicationSettings struct {
+	Policy string `json:"policy,omitempty"`
+}
+
+// Account A Fastbound account to back up and where its downloads are saved
+type Account struct {
+	Fastbound    FastboundCredentials `json:"fastbound"`
+	Paths        AccountPaths         `json:"paths"`
+	Storage      StorageSettings      `json:"storage"`                // The primary destination once settings are read
+	Destinations []StorageSettings    `json:"destinations,omitempty"` // Every destination bound books are copied to, primary first
+	Replication  ReplicationSettings  `json:"replication,omitempty"`
+}
+
 // FBDConfig A struct to keep track of known values in settings.json
 type FBDConfig struct {
-	Fastbound struct {
-		AccountNumber string `json:"account-number"`
-		ApiKey        string `json:"api-key"`
-		AuditUser     string `json:"audit-user"`
-	} `json:"fastbound"`
-	Paths struct {
-		BoundBooks       string `json:"bound-books"`
-		BackgroundChecks string `json:"background-checks"`
-	} `json:"paths"`
-	IsCron                    bool   `json:"is-cron,omitempty"`
-	DisableMetrics            bool   `json:"disable-metrics,omitempty"`
-	MetricsPort               string `json:"metrics-port,omitempty"`
-	ScanningIntervalInMinutes uint   `json:"scanning-interval,omitempty"`
+	// Fastbound and Paths configure a single account. They are folded into Accounts when Accounts is not used.
+	Fastbound                    FastboundCredentials      `json:"fastbound"`
+	Paths                        AccountPaths              `json:"paths"`
+	Storage                      StorageSettings           `json:"storage"`                // Used by every account that does not set its own
+	Destinations                 []StorageSettings         `json:"destinations,omitempty"` // Used by every account that does not set its own
+	Replication                  ReplicationSettings       `json:"replication,omitempty"`
+	Encryption                   EncryptionSettings        `json:"encryption,omitempty"`
+	Signing                      SigningSettings           `json:"signing,omitempty"`
+	Accounts                     []Account                 `json:"accounts,omitempty"`
+	MaxConcurrentAccounts        uint                      `json:"max-concurrent-accounts,omitempty"`
+	IsCron                       bool                      `json:"is-cron,omitempty"`
+	DisableMetrics               bool                      `json:"disable-metrics,omitempty"`
+	MetricsPort                  string                    `json:"metrics-port,omitempty"`
+	Pushgateway                  PushgatewaySettings       `json:"pushgateway,omitempty"`
+	TextfileCollector            TextfileCollectorSettings `json:"textfile-collector,omitempty"`
+	ScanningIntervalInMinutes    uint                      `json:"scanning-interval,omitempty"`
+	ShutdownGracePeriodInSeconds uint                      `json:"shutdown-grace-period,omitempty"`
+	Retry                        struct {
+		MaxAttempts             uint `json:"max-attempts,omitempty"`
+		MaxElapsedTimeInSeconds uint `json:"max-elapsed-time,omitempty"`
+	} `json:"retry,omitempty"`
+	Timeouts struct {
+		APIInSeconds   uint `json:"api,omitempty"`
+		StallInSeconds uint `json:"stall,omitempty"`
+	} `json:"timeouts,omitempty"`
+	Layout struct {
+		Template string `json:"template,omitempty"`
+		Timezone string `json:"timezone,omitempty"`
+	} `json:"layout,omitempty"`
+	Health struct {
+		MaxCycleDurationInMinutes uint `json:"max-cycle-duration,omitempty"`
+		MaxFailedCycles           uint `json:"max-failed-cycles,omitempty"`
+	} `json:"health,omitempty"`
 }
 
 // CheckForSettingsFile Check if the settings file exists and has the correct mode
 func CheckForSettingsFile(settingsFilePath string) {
+	if err := StatSettingsFile(settingsFilePath); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// StatSettingsFile Return why the settings file is missing or does not have the correct mode, if it is or does not
+func StatSettingsFile(settingsFilePath string) error {
 	settingsFile, err := os.Stat(settingsFilePath)
 	if err != nil {
 		// If the error is not nil, check if this is because the file doesn't exist
 		if os.IsNotExist(err) {
-			log.Fatalf("Unable to find settings file: %v", err)
-		} else {
-			log.Fatalf("Unable to read settings file: %v", err)
+			return fmt.Errorf("unable to find settings file: %w", err)
 		}
+		return fmt.Errorf("unable to read settings file: %w", err)
 	}
-	// If the mode is incorrect then we exit with warning to rotate credentials
+	// If the mode is incorrect then the credentials in it should be rotated
 	if settingsFile.Mode() != 0400 {
-		log.Fatalf("Settings file detected but mode is not 0400!\n" +
-			"You SHOULD rotate any credentials in the file after fixing mode.")
+		return fmt.Errorf("settings file detected but mode is not 0400!\n" +
+			"You SHOULD rotate any credentials in the file after fixing mode")
 	}
+	return nil
 }
 
 // validateSettingsFile Validate that the contents of the settings file are sane
 func validateSettingsFile(settings FBDConfig) error {
-	if len(settings.Fastbound.AccountNumber) < 6 {
+	accounts := settings.Accounts
+	if len(accounts) == 0 {
+		accounts = []Account{{Fastbound: settings.Fastbound, Paths: settings.Paths}}
+	}
+	if err := validateEncryption(settings.Encryption); err != nil {
+		return err
+	}
+	if err := validateSigning(settings.Signing); err != nil {
+		return err
+	}
+	if err := validatePushgateway(settings.Pushgateway); err != nil {
+		return err
+	}
+	if err := validateTextfileCollector(settings.TextfileCollector); err != nil {
+		return err
+	}
+
+	// Accounts are told apart by account number in logs and metrics, and must not share a folder or
+	// their manifests and ledgers would be mixed together
+	seenAccounts := make(map[string]bool)
+	seenPaths := make(map[string]string)
+	for _, account := range accounts {
+		if err := validateAccount(account); err != nil {
+			return err
+		}
+		if seenAccounts[account.Fastbound.AccountNumber] {
+			return fmt.Errorf("fastbound account %s is configured more than once", account.Fastbound.AccountNumber)
+		}
+		seenAccounts[account.Fastbound.AccountNumber] = true
+		paths := []string{account.Paths.BoundBooks, account.Paths.BackgroundChecks}
+		for _, destination := range account.Destinations {
+			if destination.Type == "local" {
+				paths = append(paths, destination.Path)
+			}
+		}
+		for _, path := range paths {
+			if path == "" {
+				continue
+			}
+			path = filepath.Clean(path)
+			if owner, ok := seenPaths[path]; ok && owner != account.Fastbound.AccountNumber {
+				return fmt.Errorf("path %s is used by both fastbound accounts %s and %s", path, owner, account.Fastbound.AccountNumber)
+			}
+			seenPaths[path] = account.Fastbound.AccountNumber
+		}
+	}
+	return nil
+}
+
+// validateEncryption Validate that records are encrypted one way, and that the keys to decrypt them match it
+func validateEncryption(encryption EncryptionSettings) error {
+	if len(encryption.AgeRecipients) != 0 && encryption.KeyFile != "" {
+		return fmt.Errorf("encryption must use either age recipients or a key file, not both")
+	}
+	if encryption.AgeIdentityFile != "" && len(encryption.AgeRecipients) == 0 {
+		return fmt.Errorf("encryption age identity file needs age recipients to encrypt to")
+	}
+	if len(encryption.PreviousKeyFiles) != 0 && encryption.KeyFile == "" {
+		return fmt.Errorf("encryption previous key files need a key file to encrypt with")
+	}
+	return nil
+}
+
+// validateSigning Validate that a signing key of a known type is configured whenever signing is
+func validateSigning(signing SigningSettings) error {
+	switch strings.ToLower(signing.Type) {
+	case "":
+		if signing.PrivateKey != "" || signing.Passphrase != "" {
+			return fmt.Errorf("signing type must be set to ed25519 or openpgp")
+		}
+	case "ed25519", "openpgp":
+		if signing.PrivateKey == "" {
+			return fmt.Errorf("signing %s needs a private key", signing.Type)
+		}
+		if signing.Passphrase != "" && strings.ToLower(signing.Type) != "openpgp" {
+			return fmt.Errorf("signing passphrase only applies to openpgp keys")
+		}
+	default:
+		return fmt.Errorf("signing type %q is not ed25519 or openpgp", signing.Type)
+	}
+	return nil
+}
+
+// labelNamePattern matches a valid Prometheus label name
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validatePushgateway Validate that the Pushgateway URL and grouping labels are usable when pushing is configured
+func validatePushgateway(pushgateway PushgatewaySettings) error {
+	if pushgateway.URL == "" {
+		if pushgateway.Username != "" || len(pushgateway.Grouping) != 0 {
+			return fmt.Errorf("pushgateway url must be set to push metrics")
+		}
+		return nil
+	}
+	pushURL, err := url.Parse(pushgateway.URL)
+	if err != nil || (pushURL.Scheme != "http" && pushURL.Scheme != "https") || pushURL.Host == "" {
+		return fmt.Errorf("pushgateway url %q must be an http or https URL", pushgateway.URL)
+	}
+	for name := range pushgateway.Grouping {
+		if !labelNamePattern.MatchString(name) || name == "job" {
+			return fmt.Errorf("pushgateway grouping label %q is not a valid label name other than job", name)
+		}
+	}
+	if pushgateway.Password != "" && pushgateway.Username == "" {
+		return fmt.Errorf("pushgateway password needs a username")
+	}
+	return nil
+}
+
+// validateTextfileCollector Validate that metrics are written to a .prom file directly inside the collector directory
+func validateTextfileCollector(textfile TextfileCollectorSettings) error {
+	if textfile.Directory == "" {
+		if textfile.FileName != "" {
+			return fmt.Errorf("textfile-collector directory must be set to write metrics")
+		}
+		return nil
+	}
+	if filepath.Base(textfile.FileName) != textfile.FileName || filepath.Ext(textfile.FileName) != ".prom" {
+		return fmt.Errorf("textfile-collector file name %q must be a file name ending in .prom, which node_exporter reads", textfile.FileName)
+	}
+	return nil
+}
+
+// validateAccount Validate that the credentials and paths of a single account are sane
+func validateAccount(account Account) error {
+	if len(account.Fastbound.AccountNumber) < 6 {
 		return fmt.Errorf("fastbound account number appears to be in the wrong format")
 	}
-	if len(settings.Fastbound.ApiKey) == 0 {
-		return fmt.Errorf("fastbound API key appears to be blank")
+	if len(account.Fastbound.ApiKey) == 0 {
+		return fmt.Errorf("fastbound API key for account %s appears to be blank", account.Fastbound.AccountNumber)
 	}
-	if settings.Paths.BackgroundChecks == "" {
-		return fmt.Errorf("bound book path seems to be invalid")
+	destinations := account.Destinations
+	if len(destinations) == 0 {
+		destinations = []StorageSettings{account.Storage}
 	}
-	if settings.Paths.BackgroundChecks == "" {
-		return fmt.Errorf("4473s path seems to be invalid")
+	seenNames := make(map[string]bool)
+	for _, destination := range destinations {
+		if seenNames[destination.Name] {
+			return fmt.Errorf("destination %s of account %s is configured more than once", destination.Name, account.Fastbound.AccountNumber)
+		}
+		seenNames[destination.Name] = true
+		// Name the destination in errors only when there is more than one to choose from
+		owner := "account " + account.Fastbound.AccountNumber
+		if len(destinations) > 1 {
+			owner = fmt.Sprintf("destination %s of account %s", destination.Name, account.Fastbound.AccountNumber)
+		}
+		if err := validateStorage(destination, account.Paths, owner); err != nil {
+			return err
+		}
+	}
+	switch account.Replication.Policy {
+	case "", "all", "quorum", "primary":
+	default:
+		return fmt.Errorf("replication policy %q for account %s is not all, quorum or primary", account.Replication.Policy, account.Fastbound.AccountNumber)
+	}
+	if account.Paths.BackgroundChecks == "" {
+		return fmt.Errorf("4473s path for account %s seems to be invalid", account.Fastbound.AccountNumber)
+	}
+	return nil
+}
+
+// validateStorage Validate that the settings of a single storage destination are sane
+func validateStorage(destination StorageSettings, paths AccountPaths, owner string) error {
+	switch destination.Type {
+	case "", "local":
+		if destination.Path == "" && paths.BoundBooks == "" {
+			return fmt.Errorf("bound book path for %s seems to be invalid", owner)
+		}
+	case "s3":
+		if destination.S3.Bucket == "" {
+			return fmt.Errorf("s3 bucket for %s appears to be blank", owner)
+		}
+		objectLock := destination.S3.ObjectLock
+		switch strings.ToLower(objectLock.Mode) {
+		case "":
+		case "governance", "compliance":
+			if objectLock.RetentionInDays == 0 {
+				return fmt.Errorf("s3 object lock for %s needs retention-days", owner)
+			}
+		default:
+			return fmt.Errorf("s3 object lock mode %q for %s is not governance or compliance", objectLock.Mode, owner)
+		}
+	case "sftp":
+		sftpSettings := destination.SFTP
+		if sftpSettings.Address == "" || sftpSettings.User == "" {
+			return fmt.Errorf("sftp address and user for %s must both be set", owner)
+		}
+		if sftpSettings.PrivateKey == "" {
+			return fmt.Errorf("sftp private key for %s appears to be blank", owner)
+		}
+		// Connecting to a server that can't be verified would let anyone in the middle collect the records
+		if sftpSettings.KnownHosts == "" {
+			return fmt.Errorf("sftp known-hosts file for %s appears to be blank", owner)
+		}
+		if sftpSettings.RemoteDir == "" {
+			return fmt.Errorf("sftp remote directory for %s appears to be blank", owner)
+		}
+	case "webdav":
+		webDAVSettings := destination.WebDAV
+		if !strings.HasPrefix(webDAVSettings.URL, "https://") && !strings.HasPrefix(webDAVSettings.URL, "http://") {
+			return fmt.Errorf("webdav url for %s must be an http or https url", owner)
+		}
+		if webDAVSettings.BearerToken != "" && (webDAVSettings.Username != "" || webDAVSettings.Password != "") {
+			return fmt.Errorf("webdav for %s must use either a username and password or a bearer token, not both", owner)
+		}
+	case "azure":
+		azureSettings := destination.Azure
+		if azureSettings.Container == "" {
+			return fmt.Errorf("azure container for %s appears to be blank", owner)
+		}
+		if azureSettings.AccountName == "" && azureSettings.ServiceURL == "" {
+			return fmt.Errorf("azure account name or service url for %s must be set", owner)
+		}
+		if (azureSettings.AccountKey == "") == (azureSettings.SASToken == "") {
+			return fmt.Errorf("azure for %s must use either an account key or a sas token", owner)
+		}
+		immutability := azureSettings.Immutability
+		switch strings.ToLower(immutability.Mode) {
+		case "":
+		case "unlocked", "locked":
+			if immutability.RetentionInDays == 0 {
+				return fmt.Errorf("azure immutability for %s needs retention-days", owner)
+			}
+		default:
+			return fmt.Errorf("azure immutability mode %q for %s is not unlocked or locked", immutability.Mode, owner)
+		}
+	default:
+		return fmt.Errorf("storage type %q for %s is not local, s3, sftp, webdav or azure", destination.Type, owner)
 	}
 	return nil
 }
@@ -87,11 +465,135 @@ func ReadSettingsFile(settingsFilePath string) (*FBDConfig, error) {
 		}
 	}
 
+	// Set default Pushgateway job name if left unconfigured
+	if outputConfig.Pushgateway.URL != "" && outputConfig.Pushgateway.Job == "" {
+		outputConfig.Pushgateway.Job = "fastbound_downloader"
+	}
+
+	// Set default textfile collector file name if left unconfigured
+	if outputConfig.TextfileCollector.Directory != "" && outputConfig.TextfileCollector.FileName == "" {
+		outputConfig.TextfileCollector.FileName = "fastbound_downloader.prom"
+	}
+
 	// Set default scanning interval to 1440 minutes (1 day) if left unconfigured
 	if outputConfig.ScanningIntervalInMinutes == 0 {
 		outputConfig.ScanningIntervalInMinutes = 1440
 	}
 
+	// Treat a settings file with a single top level account as a list of one
+	if len(outputConfig.Accounts) == 0 {
+		outputConfig.Accounts = []Account{{Fastbound: outputConfig.Fastbound, Paths: outputConfig.Paths, Storage: outputConfig.Storage}}
+	} else if outputConfig.Fastbound != (FastboundCredentials{}) || outputConfig.Paths != (AccountPaths{}) {
+		return nil, fmt.Errorf("configure accounts either with fastbound and paths or with accounts, not both")
+	}
+
+	if outputConfig.Storage.Type != "" && len(outputConfig.Destinations) != 0 {
+		return nil, fmt.Errorf("configure bound book storage either with storage or with destinations, not both")
+	}
+
+	for i := range outputConfig.Accounts {
+		account := &outputConfig.Accounts[i]
+
+		// Set default destinations for bound books to the top level destinations or storage, or else the local bound
+		// book path, if left unconfigured
+		if len(account.Destinations) == 0 {
+			switch {
+			case account.Storage.Type != "":
+				account.Destinations = []StorageSettings{account.Storage}
+			case len(outputConfig.Destinations) != 0:
+				account.Destinations = append([]StorageSettings(nil), outputConfig.Destinations...)
+			default:
+				account.Destinations = []StorageSettings{outputConfig.Storage}
+			}
+		} else if account.Storage.Type != "" {
+			return nil, fmt.Errorf("configure bound book storage for account %s either with storage or with destinations, not both", account.Fastbound.AccountNumber)
+		}
+		seenNames := make(map[string]int)
+		for j := range account.Destinations {
+			destination := &account.Destinations[j]
+			if destination.Type == "" {
+				destination.Type = "local"
+			}
+			if destination.Type == "local" && destination.Path == "" {
+				destination.Path = account.Paths.BoundBooks
+			}
+
+			// Set default destination name to its type, numbered when several destinations share a type
+			if destination.Name == "" {
+				seenNames[destination.Type]++
+				destination.Name = destination.Type
+				if seenNames[destination.Type] > 1 {
+					destination.Name = fmt.Sprintf("%s-%d", destination.Type, seenNames[destination.Type])
+				}
+			}
+
+			// Set default S3 part size and Azure block size to 16 MB if left unconfigured
+			if destination.S3.PartSizeInMB == 0 {
+				destination.S3.PartSizeInMB = 16
+			}
+			if destination.Azure.BlockSizeInMB == 0 {
+				destination.Azure.BlockSizeInMB = 16
+			}
+		}
+		account.Storage = account.Destinations[0]
+
+		// Set default replication policy to the top level policy, or else requiring every destination, if left unconfigured
+		if account.Replication.Policy == "" {
+			account.Replication.Policy = outputConfig.Replication.Policy
+		}
+		if account.Replication.Policy == "" {
+			account.Replication.Policy = "all"
+		}
+
+		// Set default quarantine path for rejected downloads, and staging path for downloads in progress, to folders inside
+		// the bound book path, or the 4473s path when bound books are not stored locally, if left unconfigured. Keeping
+		// them on the same filesystem as the downloads lets finished and rejected files be moved instead of copied.
+		localPath := account.Paths.BoundBooks
+		if localPath == "" {
+			localPath = account.Paths.BackgroundChecks
+		}
+		if account.Paths.Quarantine == "" && localPath != "" {
+			account.Paths.Quarantine = filepath.Join(localPath, QuarantineDirName)
+		}
+		if account.Paths.Staging == "" && localPath != "" {
+			account.Paths.Staging = filepath.Join(localPath, StagingDirName)
+		}
+	}
+
+	// Set default number of accounts processed at the same time to 4 if left unconfigured
+	if outputConfig.MaxConcurrentAccounts == 0 {
+		outputConfig.MaxConcurrentAccounts = 4
+	}
+
+	// Set default shutdown grace period to 25 seconds, which fits inside the default Kubernetes termination grace period
+	if outputConfig.ShutdownGracePeriodInSeconds == 0 {
+		outputConfig.ShutdownGracePeriodInSeconds = 25
+	}
+
+	// Set default retry policy to 5 attempts within 300 seconds (5 minutes) if left unconfigured
+	if outputConfig.Retry.MaxAttempts == 0 {
+		outputConfig.Retry.MaxAttempts = 5
+	}
+	if outputConfig.Retry.MaxElapsedTimeInSeconds == 0 {
+		outputConfig.Retry.MaxElapsedTimeInSeconds = 300
+	}
+
+	// Set default timeouts to 60 seconds to connect and get a response, and 60 seconds without progress on a download
+	if outputConfig.Timeouts.APIInSeconds == 0 {
+		outputConfig.Timeouts.APIInSeconds = 60
+	}
+	if outputConfig.Timeouts.StallInSeconds == 0 {
+		outputConfig.Timeouts.StallInSeconds = 60
+	}
+
+	// Set default health thresholds to a cycle running for 360 minutes (6 hours) and 3 failed cycles in a row
+	if outputConfig.Health.MaxCycleDurationInMinutes == 0 {
+		outputConfig.Health.MaxCycleDurationInMinutes = 360
+	}
+	if outputConfig.Health.MaxFailedCycles == 0 {
+		outputConfig.Health.MaxFailedCycles = 3
+	}
+
 	// Validate settings config
 	err = validateSettingsFile(outputConfig)
 	if err != nil {
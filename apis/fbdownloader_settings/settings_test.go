@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -59,6 +60,8 @@ func TestValidateSettingsFile(t *testing.T) {
 				Paths: struct {
 					BoundBooks       string `json:"bound-books"`
 					BackgroundChecks string `json:"background-checks"`
+					Quarantine       string `json:"quarantine,omitempty"`
+					Staging          string `json:"staging,omitempty"`
 				}{
 					BoundBooks:       "/books/",
 					BackgroundChecks: "/4473s/",
@@ -85,6 +88,8 @@ func TestValidateSettingsFile(t *testing.T) {
 				Paths: struct {
 					BoundBooks       string `json:"bound-books"`
 					BackgroundChecks string `json:"background-checks"`
+					Quarantine       string `json:"quarantine,omitempty"`
+					Staging          string `json:"staging,omitempty"`
 				}{
 					BoundBooks:       "/books/",
 					BackgroundChecks: "/4473s/",
@@ -135,6 +140,8 @@ func TestReadSettingsFile(t *testing.T) {
 		Paths: struct {
 			BoundBooks       string `json:"bound-books"`
 			BackgroundChecks string `json:"background-checks"`
+			Quarantine       string `json:"quarantine,omitempty"`
+			Staging          string `json:"staging,omitempty"`
 		}{
 			BoundBooks:       "/books/",
 			BackgroundChecks: "/4473s/",
@@ -155,4 +162,407 @@ func TestReadSettingsFile(t *testing.T) {
 			t.Errorf("Expected no error but got: %v", err)
 		}
 	})
+
+	// Validate that unconfigured optional settings receive their defaults
+	t.Run("Test default settings", func(t *testing.T) {
+		settings, err := ReadSettingsFile(tempFile.Name())
+		if err != nil {
+			t.Fatalf("Expected no error but got: %v", err)
+		}
+		if len(settings.Accounts) != 1 || settings.Accounts[0].Fastbound.AccountNumber != "123456" {
+			t.Fatalf("Expected the top level account to become the only account but got: %+v", settings.Accounts)
+		}
+		if settings.Accounts[0].Paths.Quarantine != filepath.Join("/books/", "quarantine") {
+			t.Errorf("Expected default quarantine path inside the bound book path but got: %s", settings.Accounts[0].Paths.Quarantine)
+		}
+		if settings.Accounts[0].Paths.Staging != filepath.Join("/books/", ".staging") {
+			t.Errorf("Expected default staging path inside the bound book path but got: %s", settings.Accounts[0].Paths.Staging)
+		}
+		if settings.MaxConcurrentAccounts != 4 {
+			t.Errorf("Expected default max-concurrent-accounts of 4 but got: %d", settings.MaxConcurrentAccounts)
+		}
+		if settings.ShutdownGracePeriodInSeconds != 25 {
+			t.Errorf("Expected default shutdown-grace-period of 25 but got: %d", settings.ShutdownGracePeriodInSeconds)
+		}
+		if settings.Retry.MaxAttempts != 5 {
+			t.Errorf("Expected default retry max-attempts of 5 but got: %d", settings.Retry.MaxAttempts)
+		}
+		if settings.Retry.MaxElapsedTimeInSeconds != 300 {
+			t.Errorf("Expected default retry max-elapsed-time of 300 but got: %d", settings.Retry.MaxElapsedTimeInSeconds)
+		}
+		if settings.Timeouts.APIInSeconds != 60 || settings.Timeouts.StallInSeconds != 60 {
+			t.Errorf("Expected default api and stall timeouts of 60 but got: %d and %d", settings.Timeouts.APIInSeconds, settings.Timeouts.StallInSeconds)
+		}
+		if settings.Health.MaxCycleDurationInMinutes != 360 || settings.Health.MaxFailedCycles != 3 {
+			t.Errorf("Expected default health max-cycle-duration of 360 and max-failed-cycles of 3 but got: %d and %d", settings.Health.MaxCycleDurationInMinutes, settings.Health.MaxFailedCycles)
+		}
+	})
+}
+
+// TestReadSettingsFile_Accounts validate that ReadSettingsFile handles a list of accounts
+func TestReadSettingsFile_Accounts(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		wantErr  bool
+	}{
+		{
+			name: "Multiple accounts",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/123456/", "background-checks": "/4473s/123456/"}},
+				{"fastbound": {"account-number": "654321", "api-key": "DJovNzZqoHHd3K4Jkk", "audit-user": "mbolton@initech.com"},
+				 "paths": {"bound-books": "/books/654321/", "background-checks": "/4473s/654321/"}}
+			]}`,
+			wantErr: false,
+		},
+		{
+			name: "Accounts mixed with a top level account",
+			settings: `{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				"accounts": [
+				{"fastbound": {"account-number": "654321", "api-key": "DJovNzZqoHHd3K4Jkk", "audit-user": "mbolton@initech.com"},
+				 "paths": {"bound-books": "/books/654321/", "background-checks": "/4473s/654321/"}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Duplicate account",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/a/", "background-checks": "/4473s/a/"}},
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "mbolton@initech.com"},
+				 "paths": {"bound-books": "/books/b/", "background-checks": "/4473s/b/"}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Accounts sharing a path",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/123456/"}},
+				{"fastbound": {"account-number": "654321", "api-key": "DJovNzZqoHHd3K4Jkk", "audit-user": "mbolton@initech.com"},
+				 "paths": {"bound-books": "/books", "background-checks": "/4473s/654321/"}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Account storing bound books in S3",
+			settings: `{"storage": {"type": "s3", "s3": {"bucket": "books"}}, "accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"background-checks": "/4473s/123456/"}}
+			]}`,
+			wantErr: false,
+		},
+		{
+			name: "S3 storage without a bucket",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"background-checks": "/4473s/"}, "storage": {"type": "s3"}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "S3 object lock without retention",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"background-checks": "/4473s/"}, "storage": {"type": "s3", "s3": {"bucket": "books", "object-lock": {"mode": "compliance"}}}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Account storing bound books over SFTP",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"background-checks": "/4473s/"}, "storage": {"type": "sftp", "sftp": {"address": "backup.initech.com",
+				 "user": "pgibbons", "private-key": "/keys/id_ed25519", "known-hosts": "/keys/known_hosts", "remote-dir": "/books"}}}
+			]}`,
+			wantErr: false,
+		},
+		{
+			name: "SFTP storage without known hosts",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"background-checks": "/4473s/"}, "storage": {"type": "sftp", "sftp": {"address": "backup.initech.com",
+				 "user": "pgibbons", "private-key": "/keys/id_ed25519", "remote-dir": "/books"}}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Account storing bound books on a WebDAV share",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"background-checks": "/4473s/"}, "storage": {"type": "webdav", "webdav": {
+				 "url": "https://cloud.initech.com/remote.php/dav/files/pgibbons/books", "username": "pgibbons", "password": "PC LOAD LETTER"}}}
+			]}`,
+			wantErr: false,
+		},
+		{
+			name: "WebDAV storage with both kinds of credentials",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"background-checks": "/4473s/"}, "storage": {"type": "webdav", "webdav": {
+				 "url": "https://cloud.initech.com/books", "username": "pgibbons", "bearer-token": "kkJ4K3dHoHqZzNvoDJ"}}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Account storing bound books in Azure",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"background-checks": "/4473s/"}, "storage": {"type": "azure", "azure": {"account-name": "initech",
+				 "sas-token": "sv=2024-08-04&sig=bW9jaw%3D%3D", "container": "books", "immutability": {"mode": "locked", "retention-days": 1826}}}}
+			]}`,
+			wantErr: false,
+		},
+		{
+			name: "Azure storage with both kinds of credentials",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"background-checks": "/4473s/"}, "storage": {"type": "azure", "azure": {"account-name": "initech",
+				 "account-key": "bW9jaw==", "sas-token": "sig=bW9jaw%3D%3D", "container": "books"}}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Azure immutability without retention",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"background-checks": "/4473s/"}, "storage": {"type": "azure", "azure": {"account-name": "initech",
+				 "account-key": "bW9jaw==", "container": "books", "immutability": {"mode": "unlocked"}}}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Account replicating bound books to several destinations",
+			settings: `{"replication": {"policy": "quorum"}, "destinations": [
+				{"type": "local"}, {"type": "local", "path": "/mnt/nas/books/"}, {"name": "offsite", "type": "s3", "s3": {"bucket": "books"}}
+			], "accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}}
+			]}`,
+			wantErr: false,
+		},
+		{
+			name: "Account with both storage and destinations",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}, "storage": {"type": "local"},
+				 "destinations": [{"type": "s3", "s3": {"bucket": "books"}}]}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Destinations sharing a name",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}, "destinations": [
+				 {"name": "offsite", "type": "s3", "s3": {"bucket": "books"}}, {"name": "offsite", "type": "s3", "s3": {"bucket": "more-books"}}]}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Invalid second destination",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}, "destinations": [{"type": "local"}, {"type": "s3"}]}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Unknown replication policy",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}, "replication": {"policy": "most"},
+				 "destinations": [{"type": "local"}, {"type": "s3", "s3": {"bucket": "books"}}]}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Local destination sharing a path with another account",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/123456/", "background-checks": "/4473s/123456/"}},
+				{"fastbound": {"account-number": "654321", "api-key": "DJovNzZqoHHd3K4Jkk", "audit-user": "mbolton@initech.com"},
+				 "paths": {"bound-books": "/books/654321/", "background-checks": "/4473s/654321/"},
+				 "destinations": [{"type": "local"}, {"type": "local", "path": "/books/123456"}]}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Records encrypted with age",
+			settings: `{"encryption": {"age-recipients": ["age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"],
+				"age-identity-file": "/keys/identity.txt"}, "accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}}
+			]}`,
+			wantErr: false,
+		},
+		{
+			name: "Records encrypted both ways",
+			settings: `{"encryption": {"age-recipients": ["age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"],
+				"key-file": "/keys/books.key"}, "accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Previous key files without a key file",
+			settings: `{"encryption": {"previous-key-files": ["/keys/old.key"]}, "accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Downloads signed with an OpenPGP key",
+			settings: `{"signing": {"type": "openpgp", "private-key": "/keys/signing.asc", "passphrase": "TPS reports"}, "accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}}
+			]}`,
+			wantErr: false,
+		},
+		{
+			name: "Signing without a private key",
+			settings: `{"signing": {"type": "ed25519"}, "accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Unknown signing type",
+			settings: `{"signing": {"type": "rsa", "private-key": "/keys/signing.pem"}, "accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Metrics pushed to a Pushgateway",
+			settings: `{"is-cron": true, "pushgateway": {"url": "https://pushgateway.initech.com", "grouping": {"instance": "store-1"},
+				"username": "pgibbons", "password": "kkJ4K3dHoHqZzNvoDJ"}, "accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}}
+			]}`,
+			wantErr: false,
+		},
+		{
+			name: "Pushgateway URL without a scheme",
+			settings: `{"is-cron": true, "pushgateway": {"url": "pushgateway.initech.com:9091"}, "accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Pushgateway grouping by job",
+			settings: `{"is-cron": true, "pushgateway": {"url": "http://pushgateway:9091", "grouping": {"job": "books"}}, "accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Pushgateway password without a username",
+			settings: `{"is-cron": true, "pushgateway": {"url": "http://pushgateway:9091", "password": "kkJ4K3dHoHqZzNvoDJ"}, "accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Metrics written for the textfile collector",
+			settings: `{"is-cron": true, "textfile-collector": {"directory": "/var/lib/node_exporter/textfile_collector"}, "accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}}
+			]}`,
+			wantErr: false,
+		},
+		{
+			name: "Textfile collector file node_exporter won't read",
+			settings: `{"is-cron": true, "textfile-collector": {"directory": "/var/lib/node_exporter", "file-name": "fbdownloader.txt"}, "accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Textfile collector file outside the directory",
+			settings: `{"is-cron": true, "textfile-collector": {"directory": "/var/lib/node_exporter", "file-name": "../fbdownloader.prom"}, "accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Unknown storage type",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}, "storage": {"type": "floppy"}}
+			]}`,
+			wantErr: true,
+		},
+		{
+			name: "Account missing an API key",
+			settings: `{"accounts": [
+				{"fastbound": {"account-number": "123456", "audit-user": "pgibbons@initech.com"},
+				 "paths": {"bound-books": "/books/", "background-checks": "/4473s/"}}
+			]}`,
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settingsPath := filepath.Join(t.TempDir(), "settings.json")
+			if err := os.WriteFile(settingsPath, []byte(test.settings), 0400); err != nil {
+				t.Fatalf("Failed to write settings file: %v", err)
+			}
+			settings, err := ReadSettingsFile(settingsPath)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ReadSettingsFile() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if settings.Pushgateway.URL != "" && settings.Pushgateway.Job != "fastbound_downloader" {
+				t.Errorf("Expected the default Pushgateway job name but got: %s", settings.Pushgateway.Job)
+			}
+			if settings.TextfileCollector.Directory != "" && settings.TextfileCollector.FileName != "fastbound_downloader.prom" {
+				t.Errorf("Expected the default textfile collector file name but got: %s", settings.TextfileCollector.FileName)
+			}
+			for _, account := range settings.Accounts {
+				if account.Storage.Type == "" {
+					t.Errorf("Expected account %s to get a storage type", account.Fastbound.AccountNumber)
+				}
+				if len(account.Destinations) == 0 || account.Storage.Name != account.Destinations[0].Name || account.Replication.Policy == "" {
+					t.Errorf("Expected account %s to get a primary destination and replication policy but got: %+v", account.Fastbound.AccountNumber, account)
+				}
+				if len(account.Destinations) > 1 {
+					names := []string{account.Destinations[0].Name, account.Destinations[1].Name, account.Destinations[2].Name}
+					if names[0] != "local" || names[1] != "local-2" || names[2] != "offsite" || account.Replication.Policy != "quorum" {
+						t.Errorf("Expected account %s to inherit named destinations but got: %v (%s)", account.Fastbound.AccountNumber, names, account.Replication.Policy)
+					}
+					if account.Destinations[0].Path != "/books/" || account.Destinations[1].Path != "/mnt/nas/books/" || account.Destinations[2].S3.PartSizeInMB != 16 {
+						t.Errorf("Expected account %s to get destination defaults but got: %+v", account.Fastbound.AccountNumber, account.Destinations)
+					}
+				}
+				if account.Storage.Type == "s3" {
+					if account.Storage.S3.Bucket != "books" || account.Storage.S3.PartSizeInMB != 16 {
+						t.Errorf("Expected account %s to inherit the top level S3 storage with defaults but got: %+v", account.Fastbound.AccountNumber, account.Storage)
+					}
+					continue
+				}
+				if account.Storage.Type == "azure" && account.Storage.Azure.BlockSizeInMB != 16 {
+					t.Errorf("Expected account %s to get the default Azure block size but got: %d", account.Fastbound.AccountNumber, account.Storage.Azure.BlockSizeInMB)
+				}
+				if account.Storage.Type != "local" {
+					continue
+				}
+				if account.Paths.Quarantine != filepath.Join(account.Paths.BoundBooks, "quarantine") {
+					t.Errorf("Expected account %s to get a default quarantine path but got: %s", account.Fastbound.AccountNumber, account.Paths.Quarantine)
+				}
+			}
+		})
+	}
 }
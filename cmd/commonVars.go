@@ -11,7 +11,7 @@ import (
 )
 
 // The version string should be updated before any merge to main
-var shortVersion = "0.2.1"
+var shortVersion = "1.23.1"
 var projectMaintainer = "Route 1337 LLC"
 var projectLicense = "MIT"
 var functionHelpShort = "An automated way to keep compliant Fastbound A&D book downloads"
@@ -20,3 +20,4 @@ Fastbound A&D books locally using Docker/K8s vs the PowerShell script Fastbound
 var buildArch = runtime.GOARCH
 var SettingsFilePath, _ = filepath.Abs("/config/settings.json")
 var fastboundAPIBaseURL = "https://cloud.fastbound.com"
+var userAgent = "fbdownloader/" + shortVersion
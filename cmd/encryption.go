@@ -0,0 +1,204 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/apis/fbdownloader_settings"
+	"github.com/route1337/fastbound-downloader/storage"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// decryptIdentityFile, decryptKeyFiles and decryptOutputDir hold the flags passed to the decrypt command
+var decryptIdentityFile string
+var decryptKeyFiles []string
+var decryptOutputDir string
+
+// decryptCmd represents the decrypt command
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt FILE...",
+	Short: "Decrypt archived records for inspection.",
+	Long: fmt.Sprintf(`Decrypt bound books and 4473s that were encrypted before they were archived.
+
+Each FILE must end in %s and is decrypted next to itself without it, or into --output. Use --identity for records encrypted
+to age recipients, or --key-file for records encrypted with a key file. A decrypted file is never overwritten, and
+nothing is left behind if a record fails to decrypt because it was damaged or altered.`, storage.EncryptedFileSuffix),
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cipher, err := cipherFromFlags(decryptIdentityFile, decryptKeyFiles)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if cipher == nil {
+			log.Fatal("Decrypting needs --identity or --key-file")
+		}
+
+		failed := false
+		for _, encryptedPath := range args {
+			decryptedPath, err := decryptFile(cipher, encryptedPath, decryptOutputDir)
+			if err != nil {
+				fmt.Printf("FAILED %s: %v\n", encryptedPath, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("OK %s: decrypted to %s\n", encryptedPath, decryptedPath)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// rekeyCmd represents the rekey command
+var rekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Encrypt archived records again after rotating encryption keys.",
+	Long: `Decrypt every encrypted record in the bound book destinations and 4473 path of every account in the settings file
+and encrypt it again for the current encryption settings.
+
+To rotate age recipients, replace encryption.age-recipients and keep the identity that decrypts the old records in
+encryption.age-identity-file until this has finished. To rotate a key file, set encryption.key-file to the new key and
+list the old one in encryption.previous-key-files until this has finished.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := pullSettings()
+		cipher, err := newCipher(settings)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if cipher == nil {
+			log.Fatal("Encryption is not configured in the settings file")
+		}
+
+		failed := false
+		for _, account := range settings.Accounts {
+			books, err := newBookStorage(account, cipher)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, records := range []storage.Backend{books, newLocal(account, account.Paths.BackgroundChecks)} {
+				encrypted := storage.NewEncrypted(records, storage.EncryptedConfig{Cipher: cipher, IsRecord: isRecord})
+				location := records.Location("")
+				rekeyed, err := encrypted.Rekey(context.Background())
+				if err != nil {
+					fmt.Printf("FAILED %s: %v (%d records re-encrypted)\n", location, err, rekeyed)
+					failed = true
+					continue
+				}
+				fmt.Printf("OK %s: %d records re-encrypted\n", location, rekeyed)
+			}
+			closeStorage(books)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// newCipher Create the cipher records are encrypted with, or nil if encryption is not configured
+func newCipher(settings fbdownloader_settings.FBDConfig) (storage.Cipher, error) {
+	encryption := settings.Encryption
+	switch {
+	case len(encryption.AgeRecipients) != 0:
+		ageCipher, err := storage.NewAgeCipher(encryption.AgeRecipients, encryption.AgeIdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		return ageCipher, nil
+	case encryption.KeyFile != "":
+		aesCipher, err := storage.NewAESGCMCipher(encryption.KeyFile, encryption.PreviousKeyFiles...)
+		if err != nil {
+			return nil, err
+		}
+		return aesCipher, nil
+	default:
+		return nil, nil
+	}
+}
+
+// cipherFromFlags Create a cipher that decrypts with an age identity file or key files passed on the command line,
+// or nil if neither was passed
+func cipherFromFlags(identityFile string, keyFiles []string) (storage.Cipher, error) {
+	switch {
+	case identityFile != "" && len(keyFiles) != 0:
+		return nil, fmt.Errorf("use either --identity or --key-file, not both")
+	case identityFile != "":
+		ageCipher, err := storage.NewAgeCipher(nil, identityFile)
+		if err != nil {
+			return nil, err
+		}
+		return ageCipher, nil
+	case len(keyFiles) != 0:
+		aesCipher, err := storage.NewAESGCMCipher(keyFiles[0], keyFiles[1:]...)
+		if err != nil {
+			return nil, err
+		}
+		return aesCipher, nil
+	default:
+		return nil, nil
+	}
+}
+
+// encryptRecords Encrypt the records stored in backend with cipher in stagingDir, or store them as they are if cipher is
+// nil. A blank stagingDir is only meant for reading records.
+func encryptRecords(backend storage.Backend, cipher storage.Cipher, stagingDir string) storage.Backend {
+	if cipher == nil {
+		return backend
+	}
+	return storage.NewEncrypted(backend, storage.EncryptedConfig{Cipher: cipher, IsRecord: isRecord, StagingDir: stagingDir})
+}
+
+// decryptFile Decrypt a single encrypted record and return where the plaintext was written
+func decryptFile(cipher storage.Cipher, encryptedPath string, outputDir string) (string, error) {
+	decryptedPath, ok := strings.CutSuffix(encryptedPath, storage.EncryptedFileSuffix)
+	if !ok {
+		return "", fmt.Errorf("does not end in %s", storage.EncryptedFileSuffix)
+	}
+	if outputDir != "" {
+		decryptedPath = filepath.Join(outputDir, filepath.Base(decryptedPath))
+	}
+
+	encryptedFile, err := os.Open(encryptedPath)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = encryptedFile.Close()
+	}()
+	plaintext, err := cipher.Decrypt(encryptedFile)
+	if err != nil {
+		return "", err
+	}
+	decryptedFile, err := os.OpenFile(decryptedPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(decryptedFile, plaintext)
+	if closeErr := decryptedFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if removeErr := os.Remove(decryptedPath); removeErr != nil {
+			log.Printf("Warning: failed to remove %s: %v", decryptedPath, removeErr)
+		}
+		return "", err
+	}
+	return decryptedPath, nil
+}
+
+func init() {
+	decryptCmd.Flags().StringVar(&decryptIdentityFile, "identity", "", "OPTIONAL: An age identity file to decrypt records encrypted to age recipients.")
+	decryptCmd.Flags().StringSliceVar(&decryptKeyFiles, "key-file", nil, "OPTIONAL: A key file to decrypt records encrypted with a key file. May be repeated.")
+	decryptCmd.Flags().StringVar(&decryptOutputDir, "output", "", "OPTIONAL: Write decrypted records to this directory instead of next to each file.")
+	rootCmd.AddCommand(decryptCmd)
+	rootCmd.AddCommand(rekeyCmd)
+}
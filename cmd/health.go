@@ -0,0 +1,228 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/apis/fbdownloader_settings"
+	"github.com/route1337/fastbound-downloader/storage"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// readyCheckTTL is how long /readyz reuses its settings and destination checks, so frequent probes don't keep re-reading
+// the settings file and writing to every destination
+const readyCheckTTL = time.Minute
+
+// schedulerSlack is how late a scheduled cycle may start before /healthz fails. It covers the wait before the first cycle.
+const schedulerSlack = 10 * time.Minute
+
+// cycleResult The outcome of a cycle as reported by the health endpoints
+type cycleResult struct {
+	StartedAt  time.Time `json:"started-at"`
+	FinishedAt time.Time `json:"finished-at,omitzero"` // Unset while the cycle is running
+	Succeeded  bool      `json:"succeeded"`
+}
+
+// healthReport The JSON body served by /healthz and /readyz
+type healthReport struct {
+	Status              string            `json:"status"` // "ok" or "failing"
+	Checks              map[string]string `json:"checks"` // "ok" or why each check failed
+	CycleRunning        bool              `json:"cycle-running"`
+	LastCycle           *cycleResult      `json:"last-cycle,omitempty"` // Unset until the first cycle starts
+	ConsecutiveFailures uint              `json:"consecutive-failures"`
+}
+
+// cycleHealth Tracks the scheduler's cycles so the health endpoints can tell a wedged downloader from a healthy one
+type cycleHealth struct {
+	interval            time.Duration
+	maxCycleDuration    time.Duration
+	maxFailedCycles     uint
+	settingsPath        string
+	localDirs           []string
+	mutex               sync.Mutex
+	idleSince           time.Time // When the scheduler last started waiting for the next cycle
+	running             bool
+	lastCycle           *cycleResult
+	consecutiveFailures uint
+	checkMutex          sync.Mutex // Held while the settings and destinations are checked, separately from mutex as it is slow
+	checkedAt           time.Time  // When the settings and destinations were last checked, unset until the first check
+	settingsCheck       string
+	destinationsCheck   string
+}
+
+// newCycleHealth Start tracking cycles scheduled with the settings loaded from settingsPath, waiting for the first one from now
+func newCycleHealth(settings fbdownloader_settings.FBDConfig, settingsPath string, now time.Time) *cycleHealth {
+	return &cycleHealth{
+		interval:         time.Duration(settings.ScanningIntervalInMinutes) * time.Minute,
+		maxCycleDuration: time.Duration(settings.Health.MaxCycleDurationInMinutes) * time.Minute,
+		maxFailedCycles:  settings.Health.MaxFailedCycles,
+		settingsPath:     settingsPath,
+		localDirs:        localDirs(settings),
+		idleSince:        now,
+	}
+}
+
+// cycleStarted Record that a cycle started at now
+func (h *cycleHealth) cycleStarted(now time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.running = true
+	h.lastCycle = &cycleResult{StartedAt: now}
+}
+
+// cycleFinished Record the outcome of the running cycle, which finished at now
+func (h *cycleHealth) cycleFinished(succeeded bool, now time.Time) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.running = false
+	h.idleSince = now
+	h.lastCycle.FinishedAt = now
+	h.lastCycle.Succeeded = succeeded
+	if succeeded {
+		h.consecutiveFailures = 0
+	} else {
+		h.consecutiveFailures++
+	}
+}
+
+// live Check that the scheduler is still ticking: a running cycle has not exceeded max-cycle-duration, and otherwise
+// the next cycle is not overdue
+func (h *cycleHealth) live(now time.Time) healthReport {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	checks := map[string]string{"scheduler": "ok"}
+	switch {
+	case h.running && now.Sub(h.lastCycle.StartedAt) > h.maxCycleDuration:
+		checks["scheduler"] = fmt.Sprintf("the cycle started at %s has run for longer than %s", h.lastCycle.StartedAt.Format(time.RFC3339), h.maxCycleDuration)
+	case !h.running && now.Sub(h.idleSince) > h.interval+schedulerSlack:
+		checks["scheduler"] = fmt.Sprintf("no cycle has started since %s", h.idleSince.Format(time.RFC3339))
+	}
+	return h.report(checks)
+}
+
+// ready Check that downloads can succeed: the settings file can still be loaded, local destinations are writable and
+// the last max-failed-cycles cycles did not all fail
+func (h *cycleHealth) ready(now time.Time) healthReport {
+	settingsCheck, destinationsCheck := h.checkFiles(now)
+	checks := map[string]string{"settings": settingsCheck, "destinations": destinationsCheck, "cycles": "ok"}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.consecutiveFailures >= h.maxFailedCycles {
+		checks["cycles"] = fmt.Sprintf("the last %d cycles failed", h.consecutiveFailures)
+	}
+	return h.report(checks)
+}
+
+// checkFiles Return the results of checking the settings file and local destinations, checking them again only once
+// readyCheckTTL has passed since they were last checked
+func (h *cycleHealth) checkFiles(now time.Time) (string, string) {
+	h.checkMutex.Lock()
+	defer h.checkMutex.Unlock()
+	if !h.checkedAt.IsZero() && now.Sub(h.checkedAt) < readyCheckTTL {
+		return h.settingsCheck, h.destinationsCheck
+	}
+	h.settingsCheck, h.destinationsCheck = "ok", "ok"
+	if err := checkSettings(h.settingsPath); err != nil {
+		h.settingsCheck = err.Error()
+	}
+	if err := checkWritable(h.localDirs); err != nil {
+		h.destinationsCheck = err.Error()
+	}
+	h.checkedAt = now
+	return h.settingsCheck, h.destinationsCheck
+}
+
+// report Build the JSON body for checks and the last cycle. Callers must hold the mutex.
+func (h *cycleHealth) report(checks map[string]string) healthReport {
+	report := healthReport{Status: "ok", Checks: checks, CycleRunning: h.running, ConsecutiveFailures: h.consecutiveFailures}
+	for _, result := range checks {
+		if result != "ok" {
+			report.Status = "failing"
+		}
+	}
+	if h.lastCycle != nil {
+		lastCycle := *h.lastCycle
+		report.LastCycle = &lastCycle
+	}
+	return report
+}
+
+// checkSettings Make sure the settings file still has the correct mode and still loads and validates, so a restart
+// would not fail on settings that were changed or removed since they were loaded
+func checkSettings(settingsPath string) error {
+	if err := fbdownloader_settings.StatSettingsFile(settingsPath); err != nil {
+		return err
+	}
+	_, err := fbdownloader_settings.ReadSettingsFile(settingsPath)
+	return err
+}
+
+// checkWritable Make sure a file can be created in every local directory downloads are saved to. A directory that
+// does not exist yet is left for the first download to create, and its nearest existing parent is checked instead.
+// Remote destinations were checked at startup, and failing to write to them later fails the cycle.
+func checkWritable(dirs []string) error {
+	var errs []error
+	for _, dir := range dirs {
+		existing, err := nearestExistingDir(dir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s is not writable: %w", dir, err))
+			continue
+		}
+		// Named like a partial download so it is swept up if it is ever left behind
+		probe, err := os.CreateTemp(existing, storage.PartialFilePrefix+"*"+storage.PartialFileSuffix)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s is not writable: %w", dir, err))
+			continue
+		}
+		if err := probe.Close(); err != nil {
+			log.Printf("Warning: failed to close %s: %v\n", probe.Name(), err)
+		}
+		if err := os.Remove(probe.Name()); err != nil {
+			log.Printf("Warning: failed to remove %s: %v\n", probe.Name(), err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// nearestExistingDir Return dir, or its closest parent if it does not exist yet, without creating anything
+func nearestExistingDir(dir string) (string, error) {
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return "", fmt.Errorf("%s is not a directory", dir)
+			}
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if !os.IsNotExist(err) || parent == dir {
+			return "", err
+		}
+		dir = parent
+	}
+}
+
+// healthHandler Serve the report of check as JSON, with a 503 status when it is failing
+func healthHandler(check func(now time.Time) healthReport) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := check(time.Now())
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			log.Printf("Warning: failed to write the health report: %v\n", err)
+		}
+	})
+}
@@ -0,0 +1,213 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSettingsFile writes a valid settings file saving to dir into a temp directory with the required 0400 mode
+func writeSettingsFile(t *testing.T, dir string) string {
+	settingsPath := filepath.Join(t.TempDir(), "settings.json")
+	settings := `{
+		"fastbound": {"account-number": "123456", "api-key": "kkJ4K3dHoHqZzNvoDJ", "audit-user": "pgibbons@initech.com"},
+		"paths": {"bound-books": "` + dir + `", "background-checks": "` + dir + `"}
+	}`
+	if err := os.WriteFile(settingsPath, []byte(settings), 0400); err != nil {
+		t.Fatalf("Failed to create test settings file: %v", err)
+	}
+	return settingsPath
+}
+
+// TestCycleHealth validates the /healthz and /readyz status codes as cycles start, finish and fail
+func TestCycleHealth(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	booksDir := t.TempDir()
+	settingsPath := writeSettingsFile(t, booksDir)
+
+	tests := []struct {
+		name        string
+		cycles      func(h *cycleHealth) // Cycles run before the check
+		checkAt     time.Duration        // How long after start the endpoints are checked
+		wantLive    int
+		wantReady   int
+		wantFailing map[string]bool // Checks expected to fail on either endpoint
+	}{
+		{
+			name:      "Waiting for the first cycle",
+			cycles:    func(h *cycleHealth) {},
+			checkAt:   5 * time.Minute,
+			wantLive:  http.StatusOK,
+			wantReady: http.StatusOK,
+		},
+		{
+			name:        "First cycle overdue",
+			cycles:      func(h *cycleHealth) {},
+			checkAt:     time.Hour + schedulerSlack + time.Second,
+			wantLive:    http.StatusServiceUnavailable,
+			wantReady:   http.StatusOK,
+			wantFailing: map[string]bool{"scheduler": true},
+		},
+		{
+			name: "Cycle running",
+			cycles: func(h *cycleHealth) {
+				h.cycleStarted(start.Add(time.Minute))
+			},
+			checkAt:   20 * time.Minute,
+			wantLive:  http.StatusOK,
+			wantReady: http.StatusOK,
+		},
+		{
+			name: "Cycle running too long",
+			cycles: func(h *cycleHealth) {
+				h.cycleStarted(start.Add(time.Minute))
+			},
+			checkAt:     time.Minute + 30*time.Minute + time.Second,
+			wantLive:    http.StatusServiceUnavailable,
+			wantReady:   http.StatusOK,
+			wantFailing: map[string]bool{"scheduler": true},
+		},
+		{
+			name: "Cycle failed once",
+			cycles: func(h *cycleHealth) {
+				h.cycleStarted(start)
+				h.cycleFinished(false, start.Add(time.Minute))
+			},
+			checkAt:   2 * time.Minute,
+			wantLive:  http.StatusOK,
+			wantReady: http.StatusOK,
+		},
+		{
+			name: "Too many failed cycles",
+			cycles: func(h *cycleHealth) {
+				h.cycleStarted(start)
+				h.cycleFinished(false, start.Add(time.Minute))
+				h.cycleStarted(start.Add(2 * time.Minute))
+				h.cycleFinished(false, start.Add(3*time.Minute))
+			},
+			checkAt:     4 * time.Minute,
+			wantLive:    http.StatusOK,
+			wantReady:   http.StatusServiceUnavailable,
+			wantFailing: map[string]bool{"cycles": true},
+		},
+		{
+			name: "Recovered after a successful cycle",
+			cycles: func(h *cycleHealth) {
+				h.cycleStarted(start)
+				h.cycleFinished(false, start.Add(time.Minute))
+				h.cycleStarted(start.Add(2 * time.Minute))
+				h.cycleFinished(false, start.Add(3*time.Minute))
+				h.cycleStarted(start.Add(4 * time.Minute))
+				h.cycleFinished(true, start.Add(5*time.Minute))
+			},
+			checkAt:   6 * time.Minute,
+			wantLive:  http.StatusOK,
+			wantReady: http.StatusOK,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			health := &cycleHealth{
+				interval:         time.Hour,
+				maxCycleDuration: 30 * time.Minute,
+				maxFailedCycles:  2,
+				settingsPath:     settingsPath,
+				localDirs:        []string{booksDir},
+				idleSince:        start,
+			}
+			test.cycles(health)
+			now := start.Add(test.checkAt)
+
+			for endpoint, check := range map[string]func(time.Time) healthReport{"/healthz": health.live, "/readyz": health.ready} {
+				want := test.wantLive
+				if endpoint == "/readyz" {
+					want = test.wantReady
+				}
+				recorder := httptest.NewRecorder()
+				var report healthReport
+				healthHandler(func(time.Time) healthReport {
+					report = check(now)
+					return report
+				}).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, endpoint, nil))
+				if recorder.Code != want {
+					t.Errorf("Expected %s to return %d but got %d: %s", endpoint, want, recorder.Code, recorder.Body.String())
+				}
+				for name, result := range report.Checks {
+					if failing := result != "ok"; failing != test.wantFailing[name] {
+						t.Errorf("Unexpected result for the %s check on %s: %s", name, endpoint, result)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestCycleHealth_Ready validates that /readyz checks the settings file and local destinations without changing them
+func TestCycleHealth_Ready(t *testing.T) {
+	booksDir := t.TempDir()
+	notADir := filepath.Join(booksDir, "BOOK.pdf")
+	if err := os.WriteFile(notADir, []byte("Guns. Lots of guns."), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	validSettings := writeSettingsFile(t, booksDir)
+	writableSettings := filepath.Join(t.TempDir(), "settings.json")
+	if err := os.WriteFile(writableSettings, []byte("{}"), 0600); err != nil {
+		t.Fatalf("Failed to create test settings file: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		settingsPath string
+		localDir     string
+		wantFailing  string // The check expected to fail, if any
+	}{
+		{name: "Existing directory", settingsPath: validSettings, localDir: booksDir},
+		{name: "Directory not created yet", settingsPath: validSettings, localDir: filepath.Join(booksDir, "2025", "01")},
+		{name: "Destination is a file", settingsPath: validSettings, localDir: filepath.Join(notADir, "2025"), wantFailing: "destinations"},
+		{name: "Settings file removed", settingsPath: filepath.Join(booksDir, "missing.json"), localDir: booksDir, wantFailing: "settings"},
+		{name: "Settings file mode changed", settingsPath: writableSettings, localDir: booksDir, wantFailing: "settings"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			health := &cycleHealth{maxFailedCycles: 1, settingsPath: test.settingsPath, localDirs: []string{test.localDir}}
+			report := health.ready(time.Now())
+			for name, result := range report.Checks {
+				if failing := result != "ok"; failing != (name == test.wantFailing) {
+					t.Errorf("Unexpected result for the %s check: %s", name, result)
+				}
+			}
+			if _, err := os.Stat(test.localDir); test.localDir != booksDir && err == nil {
+				t.Errorf("Expected %s not to be created", test.localDir)
+			}
+		})
+	}
+}
+
+// TestCycleHealth_ReadyCached validates that /readyz reuses its settings and destination checks until readyCheckTTL passes
+func TestCycleHealth_ReadyCached(t *testing.T) {
+	booksDir := t.TempDir()
+	settingsPath := writeSettingsFile(t, booksDir)
+	health := &cycleHealth{maxFailedCycles: 1, settingsPath: settingsPath, localDirs: []string{booksDir}}
+	start := time.Now()
+	if report := health.ready(start); report.Status != "ok" {
+		t.Fatalf("Expected /readyz to pass but got: %+v", report)
+	}
+
+	if err := os.Remove(settingsPath); err != nil {
+		t.Fatalf("Failed to remove the test settings file: %v", err)
+	}
+	if report := health.ready(start.Add(readyCheckTTL - time.Second)); report.Status != "ok" {
+		t.Errorf("Expected /readyz to reuse its last check within %s but got: %+v", readyCheckTTL, report)
+	}
+	if report := health.ready(start.Add(readyCheckTTL)); report.Checks["settings"] == "ok" {
+		t.Errorf("Expected /readyz to check the settings file again after %s but got: %+v", readyCheckTTL, report)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"github.com/route1337/fastbound-downloader/apis/fbdownloader_settings"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// healthcheckTimeout is how long the health endpoint may take to answer before the check fails
+const healthcheckTimeout = 10 * time.Second
+
+// healthcheckReady and healthcheckURL hold the flags passed to the healthcheck command
+var healthcheckReady bool
+var healthcheckURL string
+
+// healthcheckCmd represents the healthcheck command
+var healthcheckCmd = &cobra.Command{
+	Use:   "healthcheck",
+	Short: "Check that a running Fastbound Downloader is healthy.",
+	Long: `Query /healthz, or /readyz with --ready, on the metrics server of the Fastbound Downloader running in this
+container, print the JSON report and exit non-zero unless it is healthy. This is meant for a Docker HEALTHCHECK.
+
+The metrics port is read from the settings file unless --url is given. The endpoints are only served when is-cron
+and disable-metrics are both false, so otherwise the check passes without querying anything.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		baseURL := healthcheckURL
+		if baseURL == "" {
+			fbdownloader_settings.CheckForSettingsFile(SettingsFilePath)
+			settings, err := fbdownloader_settings.ReadSettingsFile(SettingsFilePath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			// The image always runs this check, so a container that serves no endpoints has nothing to fail
+			if settings.IsCron || settings.DisableMetrics {
+				fmt.Println("Health endpoints are not served with is-cron or disable-metrics, nothing to check")
+				return
+			}
+			baseURL = "http://127.0.0.1" + settings.MetricsPort
+		}
+		endpoint := "/healthz"
+		if healthcheckReady {
+			endpoint = "/readyz"
+		}
+		if err := queryHealth(strings.TrimRight(baseURL, "/") + endpoint); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	healthcheckCmd.Flags().BoolVar(&healthcheckReady, "ready", false, "OPTIONAL: Check readiness on /readyz instead of health on /healthz.")
+	healthcheckCmd.Flags().StringVar(&healthcheckURL, "url", "", "OPTIONAL: The base URL of the metrics server, such as http://127.0.0.1:9090.")
+	rootCmd.AddCommand(healthcheckCmd)
+}
+
+// queryHealth Print the report served by a health endpoint and return an error unless it reported healthy
+func queryHealth(endpointURL string) error {
+	client := &http.Client{Timeout: healthcheckTimeout}
+	response, err := client.Get(endpointURL)
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", endpointURL, err)
+	}
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			log.Printf("Warning: failed to close the health report: %v\n", err)
+		}
+	}()
+	report, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read the health report from %s: %w", endpointURL, err)
+	}
+	fmt.Print(string(report))
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered with status %d", endpointURL, response.StatusCode)
+	}
+	return nil
+}
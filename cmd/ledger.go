@@ -0,0 +1,91 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/apis/fastbound"
+	"github.com/route1337/fastbound-downloader/ledger"
+	"github.com/route1337/fastbound-downloader/storage"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// ledgerDirs holds the directories passed with --dir to override the ones in the settings file
+var ledgerDirs []string
+
+// ledgerIdentityFile and ledgerKeyFiles hold the keys passed to decrypt records in the directories passed with --dir
+var ledgerIdentityFile string
+var ledgerKeyFiles []string
+
+// ledgerCmd represents the ledger command
+var ledgerCmd = &cobra.Command{
+	Use:   "ledger",
+	Short: "Work with the tamper-evident download ledger.",
+	Long: `Work with the tamper-evident download ledger.
+
+Every download is linked into a hash-chained ledger.jsonl in its destination directory.`,
+}
+
+// ledgerVerifyCmd represents the ledger verify command
+var ledgerVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the download ledgers have not been tampered with.",
+	Long: `Walk each download ledger from its first entry, checking every link in the hash chain and that every
+archived file still matches its recorded hash. Every file in the manifest and its checksum sidecar must also have a
+ledger entry, so entries removed from the end of a ledger are found too. The first broken link is reported and the command exits non-zero.
+
+By default every bound book destination and the 4473 path of every account in the settings file are checked. Use --dir to check other directories.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cipher, err := cipherFromFlags(ledgerIdentityFile, ledgerKeyFiles)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var backends []storage.Backend
+		for _, dir := range ledgerDirs {
+			backends = append(backends, encryptRecords(storage.NewLocal(dir), cipher, ""))
+		}
+		if len(backends) == 0 {
+			if backends, err = accountStorages(pullSettings()); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		failed := false
+		for _, backend := range backends {
+			location := backend.Location("")
+			records, err := fastbound.LedgerRecords(context.Background(), backend)
+			if err != nil {
+				closeStorage(backend)
+				fmt.Printf("FAILED %s: %v\n", location, err)
+				failed = true
+				continue
+			}
+			verified, err := ledger.Verify(context.Background(), backend, records)
+			closeStorage(backend)
+			if err != nil {
+				fmt.Printf("FAILED %s: %v (%d entries verified before the break)\n", location, err, verified)
+				failed = true
+				continue
+			}
+			fmt.Printf("OK %s: %d entries verified\n", location, verified)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	ledgerVerifyCmd.Flags().StringSliceVar(&ledgerDirs, "dir", nil, "OPTIONAL: Verify the ledger in this directory instead of the configured paths. May be repeated.")
+	ledgerVerifyCmd.Flags().StringVar(&ledgerIdentityFile, "identity", "", "OPTIONAL: An age identity file to decrypt encrypted records in the directories passed with --dir.")
+	ledgerVerifyCmd.Flags().StringSliceVar(&ledgerKeyFiles, "key-file", nil, "OPTIONAL: A key file to decrypt encrypted records in the directories passed with --dir. May be repeated.")
+	ledgerCmd.AddCommand(ledgerVerifyCmd)
+	rootCmd.AddCommand(ledgerCmd)
+}
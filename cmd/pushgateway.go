@@ -0,0 +1,124 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/route1337/fastbound-downloader/apis/fbdownloader_settings"
+	"github.com/route1337/fastbound-downloader/metrics"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// pushTimeout is how long pushing metrics to the Pushgateway may take before it is abandoned
+const pushTimeout = 30 * time.Second
+
+// pushMetrics Replace the metrics the Pushgateway holds for this job and grouping with everything in gatherer, so cron
+// runs that exit before they could be scraped are still observable. Gauges only some runs set, such as the last success,
+// are carried forward from what the Pushgateway holds so a run that doesn't set them doesn't replace them with nothing.
+func pushMetrics(settings fbdownloader_settings.PushgatewaySettings, gatherer prometheus.Gatherer) error {
+	// Push even when the cycle was cut short by shutting down, so its outcome is still reported
+	pushContext, cancel := context.WithTimeout(context.Background(), pushTimeout)
+	defer cancel()
+	client := &http.Client{Timeout: pushTimeout}
+	previous, err := pushedMetrics(pushContext, client, settings)
+	if err != nil {
+		log.Printf("Warning: %v, the last values of gauges this run didn't set will be dropped\n", err)
+	}
+
+	pusher := push.New(settings.URL, settings.Job).
+		Gatherer(metrics.CarryForward(gatherer, previous)).
+		Client(client)
+	for name, value := range settings.Grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	if settings.Username != "" {
+		pusher = pusher.BasicAuth(settings.Username, settings.Password)
+	}
+	if err := pusher.PushContext(pushContext); err != nil {
+		return fmt.Errorf("failed to push metrics to %s: %w", settings.URL, err)
+	}
+	log.Printf("Pushed metrics to %s\n", settings.URL)
+	return nil
+}
+
+// pushedMetrics Fetch the metrics the Pushgateway holds for this job and grouping, without the job and grouping labels
+// it adds to them
+func pushedMetrics(ctx context.Context, client *http.Client, settings fbdownloader_settings.PushgatewaySettings) ([]*dto.MetricFamily, error) {
+	metricsURL := strings.TrimRight(settings.URL, "/") + "/metrics"
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, metricsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics from %s: %w", metricsURL, err)
+	}
+	request.Header.Set("Accept", "text/plain")
+	if settings.Username != "" {
+		request.SetBasicAuth(settings.Username, settings.Password)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics from %s: %w", metricsURL, err)
+	}
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			log.Printf("Warning: failed to close the metrics from %s: %v\n", metricsURL, err)
+		}
+	}()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read metrics from %s: status %d", metricsURL, response.StatusCode)
+	}
+	families, err := metrics.ParseText(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics from %s: %w", metricsURL, err)
+	}
+
+	// The Pushgateway labels every metric with its job and grouping, adding a blank instance unless grouped by one
+	grouping := map[string]string{"job": settings.Job, "instance": ""}
+	for name, value := range settings.Grouping {
+		grouping[name] = value
+	}
+	for _, family := range families {
+		var ours []*dto.Metric
+		for _, metric := range family.Metric {
+			if labels, ok := withoutGrouping(metric.Label, grouping); ok {
+				metric.Label = labels
+				ours = append(ours, metric)
+			}
+		}
+		family.Metric = ours
+	}
+	return families, nil
+}
+
+// withoutGrouping Return labels without the grouping labels, and whether they belong to exactly that grouping. Only
+// the account label of the carried gauges may be left, so metrics pushed with extra grouping labels, such as by another
+// deployment, are not mistaken for ours.
+func withoutGrouping(labels []*dto.LabelPair, grouping map[string]string) ([]*dto.LabelPair, bool) {
+	values := make(map[string]string, len(grouping))
+	var remaining []*dto.LabelPair
+	for _, label := range labels {
+		if _, grouped := grouping[label.GetName()]; grouped {
+			values[label.GetName()] = label.GetValue()
+			continue
+		}
+		if label.GetName() != "account" {
+			return nil, false
+		}
+		remaining = append(remaining, label)
+	}
+	// A missing label is the same as a blank one
+	for name, value := range grouping {
+		if values[name] != value {
+			return nil, false
+		}
+	}
+	return remaining, true
+}
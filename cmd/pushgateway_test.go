@@ -0,0 +1,81 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package cmd
+
+import (
+	"errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/route1337/fastbound-downloader/apis/fbdownloader_settings"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestPushMetrics validates that a failed cron run pushes the last success and book size held for its own grouping
+func TestPushMetrics(t *testing.T) {
+	// What the Pushgateway holds after a successful run of this deployment and of another one grouped differently
+	held := `# TYPE fastbound_downloader_last_success_timestamp_seconds gauge
+fastbound_downloader_last_success_timestamp_seconds{account="123456",instance="store-1",job="fastbound_downloader"} 1000
+fastbound_downloader_last_success_timestamp_seconds{account="654321",instance="store-2",job="fastbound_downloader"} 1500
+# TYPE fastbound_downloader_last_book_size_bytes gauge
+fastbound_downloader_last_book_size_bytes{account="123456",instance="store-1",job="fastbound_downloader"} 1337
+`
+	pushed := make(map[string]*dto.MetricFamily)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/metrics":
+			_, _ = io.WriteString(w, held)
+		case r.Method == http.MethodPut && r.URL.Path == "/metrics/job/fastbound_downloader/instance/store-1":
+			decoder := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+			for {
+				family := &dto.MetricFamily{}
+				if err := decoder.Decode(family); errors.Is(err, io.EOF) {
+					break
+				} else if err != nil {
+					t.Errorf("Failed to decode pushed metrics: %v", err)
+					break
+				}
+				pushed[family.GetName()] = family
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("Unexpected %s request to %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mockServer.Close()
+
+	settings := fbdownloader_settings.PushgatewaySettings{
+		URL:      mockServer.URL,
+		Job:      "fastbound_downloader",
+		Grouping: map[string]string{"instance": "store-1"},
+	}
+	if err := pushMetrics(settings, cronRunRegistry(false, 2000)); err != nil {
+		t.Fatalf("pushMetrics() returned an unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		value float64
+	}{
+		{name: "fastbound_downloader_last_attempt_timestamp_seconds", value: 2000},
+		{name: "fastbound_downloader_last_success_timestamp_seconds", value: 1000},
+		{name: "fastbound_downloader_last_book_size_bytes", value: 1337},
+	}
+	for _, test := range tests {
+		family, ok := pushed[test.name]
+		if !ok || len(family.Metric) != 1 {
+			t.Errorf("Expected one %s series to be pushed but got: %v", test.name, family)
+			continue
+		}
+		metric := family.Metric[0]
+		if len(metric.Label) != 1 || metric.Label[0].GetValue() != "123456" || metric.GetGauge().GetValue() != test.value {
+			t.Errorf("Expected %s{account=\"123456\"} %v to be pushed but got: %v", test.name, test.value, metric)
+		}
+	}
+}
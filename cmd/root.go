@@ -6,13 +6,15 @@ This file is part of Fastbound Downloader.
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/route1337/fastbound-downloader/apis/fastbound"
 	"github.com/route1337/fastbound-downloader/apis/fbdownloader_settings"
 	"github.com/route1337/fastbound-downloader/metrics"
 	"log"
-	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -28,33 +30,73 @@ Version: %s`, functionHelpLong, shortVersion),
 	// Run root's command normally
 	Run: func(cmd *cobra.Command, args []string) {
 		settings := pullSettings()
+		sweepPartialFiles(settings)
+		for _, account := range settings.Accounts {
+			metrics.InitAccount(account.Fastbound.AccountNumber)
+			for _, destination := range account.Destinations {
+				metrics.InitDestination(account.Fastbound.AccountNumber, destination.Name)
+			}
+		}
+
+		// Stop scheduling new cycles as soon as we are asked to shut down, but give a cycle that is
+		// already running the grace period to finish its downloads before they are aborted and cleaned up
+		shutdownContext, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+		defer stop()
+		workContext, cancelWork := withGracePeriod(shutdownContext, time.Duration(settings.ShutdownGracePeriodInSeconds)*time.Second)
+		defer cancelWork()
+		checkStorage(shutdownContext, settings)
+		health := newCycleHealth(settings, SettingsFilePath, time.Now())
+
+		if !settings.IsCron && settings.Pushgateway.URL != "" {
+			log.Printf("Warning: the Pushgateway is only used when is-cron is true, metrics are served on %s instead\n", settings.MetricsPort)
+		}
 
 		// Start the Prometheus metrics server only if not disabled by one or more flags that prevent the functionality
 		if !settings.IsCron && !settings.DisableMetrics {
-			log.Printf("Metrics server starting on %s\n", settings.MetricsPort)
-			go func() {
-				http.Handle("/metrics", promhttp.HandlerFor(metrics.MetricsRegistry, promhttp.HandlerOpts{}))
-				log.Fatal(http.ListenAndServe(settings.MetricsPort, nil))
-			}()
+			metricsServer, err := startMetricsServer(settings.MetricsPort, health)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer stopMetricsServer(metricsServer)
 			log.Printf("Waiting 5 minutes before scanning\n")
-			time.Sleep(5 * time.Minute)
+			if !sleepUntilShutdown(shutdownContext, 5*time.Minute) {
+				log.Printf("Shutting down\n")
+				return
+			}
 		}
 
 		if settings.IsCron {
-			// Run a cycle and exit
-			rotationCycle(settings)
-			os.Exit(0)
-		} else {
-			// Run an initial cycle immediately
-			now := time.Now().Format("2006-01-02 15:04 MST")
-			log.Printf("Running a cycle at %s\n", now)
-			rotationCycle(settings)
-			// Run future cycles only AFTER the interval has occurred
-			ticker := time.NewTicker(time.Duration(settings.ScanningIntervalInMinutes) * time.Minute)
-			for range ticker.C {
+			// Run a cycle, push its metrics if a Pushgateway is configured since nothing will scrape them, and exit non-zero
+			// if it failed so the cron scheduler sees the failure too
+			succeeded := rotationCycle(shutdownContext, workContext, settings, health)
+			if settings.Pushgateway.URL != "" && !settings.DisableMetrics {
+				if err := pushMetrics(settings.Pushgateway, metrics.MetricsRegistry); err != nil {
+					log.Printf("Warning: %v\n", err)
+				}
+			}
+			if !succeeded {
+				log.Printf("The cycle did not back up every account without a failed or rejected download\n")
+				os.Exit(1)
+			}
+			return
+		}
+
+		// Run an initial cycle immediately
+		now := time.Now().Format("2006-01-02 15:04 MST")
+		log.Printf("Running a cycle at %s\n", now)
+		rotationCycle(shutdownContext, workContext, settings, health)
+		// Run future cycles only AFTER the interval has occurred
+		ticker := time.NewTicker(time.Duration(settings.ScanningIntervalInMinutes) * time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-shutdownContext.Done():
+				log.Printf("Shutting down\n")
+				return
+			case <-ticker.C:
 				now := time.Now().Format("2006-01-02 15:04 MST")
 				log.Printf("Running a cycle at %s\n", now)
-				rotationCycle(settings)
+				rotationCycle(shutdownContext, workContext, settings, health)
 			}
 		}
 	},
@@ -81,5 +123,32 @@ func pullSettings() fbdownloader_settings.FBDConfig {
 	if err != nil {
 		log.Fatal(err)
 	}
+	// Refuse to start with a layout, storage or signing key that can't be used rather than failing every download
+	newLayout(*Settings)
+	if _, err := accountStorages(*Settings); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := newSigner(*Settings); err != nil {
+		log.Fatal(err)
+	}
 	return *Settings
 }
+
+// sweepPartialFiles Remove temporary files left behind by downloads that were interrupted before they finished,
+// both in every account's staging directory and in every destination. The shared system temporary directory is left alone.
+func sweepPartialFiles(settings fbdownloader_settings.FBDConfig) {
+	dirs := localDirs(settings)
+	for _, account := range settings.Accounts {
+		dirs = append(dirs, account.Paths.Staging)
+	}
+	for _, dir := range dirs {
+		removed, err := fastbound.SweepPartialFiles(dir)
+		if err != nil {
+			log.Printf("Warning: %v\n", err)
+			continue
+		}
+		if removed > 0 {
+			log.Printf("Removed %d partial download(s) from %s\n", removed, dir)
+		}
+	}
+}
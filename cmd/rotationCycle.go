@@ -6,25 +6,200 @@ This file is part of Fastbound Downloader.
 package cmd
 
 import (
+	"context"
+	"errors"
 	"github.com/route1337/fastbound-downloader/apis/fastbound"
 	"github.com/route1337/fastbound-downloader/apis/fbdownloader_settings"
 	"github.com/route1337/fastbound-downloader/metrics"
+	"github.com/route1337/fastbound-downloader/signature"
+	"github.com/route1337/fastbound-downloader/storage"
 	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// rotationCycle This function runs the core logic of the Fastbound Downloader
-func rotationCycle(settings fbdownloader_settings.FBDConfig) {
-	log.Printf("Downloading the latest bound book for account %s\n", settings.Fastbound.AccountNumber)
+// rotationCycle This function runs the core logic of the Fastbound Downloader. Accounts are processed concurrently by
+// up to max-concurrent-accounts workers so a slow or failing account does not hold up the rest. Once shutdown is done
+// no more accounts are started, and cancelling ctx aborts any in-flight download. It reports whether every account was
+// processed without a failed or rejected download, and records the outcome in health.
+func rotationCycle(shutdown context.Context, ctx context.Context, settings fbdownloader_settings.FBDConfig, health *cycleHealth) bool {
+	health.cycleStarted(time.Now())
+	accounts := make(chan fbdownloader_settings.Account)
+	var workers sync.WaitGroup
+	var failed atomic.Bool
+	for range min(int(settings.MaxConcurrentAccounts), len(settings.Accounts)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for account := range accounts {
+				accountNumber := account.Fastbound.AccountNumber
+				metrics.LastAttemptTimestampSeconds.WithLabelValues(accountNumber).SetToCurrentTime()
+				if !processAccount(ctx, settings, account) {
+					failed.Store(true)
+					continue
+				}
+				metrics.LastSuccessTimestampSeconds.WithLabelValues(accountNumber).SetToCurrentTime()
+			}
+		}()
+	}
+
+	// Only accounts already being processed get the grace period, so stop handing out accounts as soon as shutdown starts
+	dispatched := 0
+dispatch:
+	for _, account := range settings.Accounts {
+		if shutdown.Err() != nil {
+			break
+		}
+		select {
+		case <-shutdown.Done():
+			break dispatch
+		case accounts <- account:
+			dispatched++
+		}
+	}
+	close(accounts)
+	workers.Wait()
+
+	// A cycle cut short by shutting down did not back up every account
+	succeeded := !failed.Load() && dispatched == len(settings.Accounts) && ctx.Err() == nil
+	finishedAt := time.Now()
+	metrics.RecordRun(succeeded, finishedAt)
+	health.cycleFinished(succeeded, finishedAt)
+	if settings.TextfileCollector.Directory != "" && !settings.DisableMetrics {
+		if err := writeTextfile(settings.TextfileCollector, metrics.MetricsRegistry); err != nil {
+			log.Printf("Warning: %v\n", err)
+		}
+	}
+	return succeeded
+}
+
+// processAccount Download the bound book and 4473s for a single account and report whether nothing failed
+func processAccount(ctx context.Context, settings fbdownloader_settings.FBDConfig, account fbdownloader_settings.Account) bool {
+	accountNumber := account.Fastbound.AccountNumber
+	cipher, err := newCipher(settings)
+	if err != nil {
+		log.Printf("Failed to load the encryption keys for account %s: %v\n", accountNumber, err)
+		metrics.FailuresTotal.WithLabelValues(accountNumber, fastbound.FailureReason(err)).Inc()
+		metrics.FailedBookDownloadsTotal.WithLabelValues(accountNumber).Inc()
+		metrics.FailedBackgroundCheckDownloadsTotal.WithLabelValues(accountNumber).Inc()
+		return false
+	}
+	signer, err := newSigner(settings)
+	if err != nil {
+		log.Printf("Failed to load the signing key for account %s: %v\n", accountNumber, err)
+		metrics.FailuresTotal.WithLabelValues(accountNumber, fastbound.FailureReason(err)).Inc()
+		metrics.FailedBookDownloadsTotal.WithLabelValues(accountNumber).Inc()
+		metrics.FailedBackgroundCheckDownloadsTotal.WithLabelValues(accountNumber).Inc()
+		return false
+	}
+	client := newFastboundClient(settings, account, signer, cipher)
+	succeeded := false
+	books, err := newBookStorage(account, cipher)
+	if err != nil {
+		log.Printf("Failed to open bound book storage for account %s: %v\n", client.AccountNumber(), err)
+		metrics.FailuresTotal.WithLabelValues(client.AccountNumber(), fastbound.FailureReason(err)).Inc()
+		metrics.FailedBookDownloadsTotal.WithLabelValues(client.AccountNumber()).Inc()
+	} else {
+		catchUpDestinations(ctx, client, books)
+		succeeded = downloadBoundBook(ctx, client, encryptRecords(books, cipher, account.Paths.Staging))
+		closeStorage(books)
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	return downloadBackgroundChecks(ctx, client, encryptRecords(newLocal(account, account.Paths.BackgroundChecks), cipher, account.Paths.Staging)) && succeeded
+}
+
+// newFastboundClient Create a Fastbound API client for an account, signing what it downloads with signer and encrypting
+// what it quarantines with cipher unless they are nil
+func newFastboundClient(settings fbdownloader_settings.FBDConfig, account fbdownloader_settings.Account, signer signature.Signer, cipher storage.Cipher) *fastbound.Client {
+	return fastbound.NewClient(
+		fastboundAPIBaseURL,
+		account.Fastbound.AccountNumber,
+		account.Fastbound.ApiKey,
+		account.Fastbound.AuditUser,
+		fastbound.WithUserAgent(userAgent),
+		fastbound.WithQuarantineDir(account.Paths.Quarantine),
+		fastbound.WithQuarantineCipher(cipher),
+		fastbound.WithStagingDir(account.Paths.Staging),
+		fastbound.WithLayout(newLayout(settings)),
+		fastbound.WithSigner(signer),
+		fastbound.WithAPITimeout(time.Duration(settings.Timeouts.APIInSeconds)*time.Second),
+		fastbound.WithStallTimeout(time.Duration(settings.Timeouts.StallInSeconds)*time.Second),
+		fastbound.WithRetryPolicy(fastbound.RetryPolicy{
+			MaxAttempts:     int(settings.Retry.MaxAttempts),
+			MaxElapsedTime:  time.Duration(settings.Retry.MaxElapsedTimeInSeconds) * time.Second,
+			InitialInterval: fastbound.DefaultRetryPolicy.InitialInterval,
+			MaxInterval:     fastbound.DefaultRetryPolicy.MaxInterval,
+		}),
+	)
+}
+
+// newLayout Build the configured layout for saved files, exiting if it is invalid
+func newLayout(settings fbdownloader_settings.FBDConfig) *fastbound.Layout {
+	layout, err := fastbound.NewLayout(settings.Layout.Template, settings.Layout.Timezone)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return layout
+}
+
+// catchUpDestinations Copy anything a destination missed during an earlier cycle, such as while it was unreachable
+func catchUpDestinations(ctx context.Context, client *fastbound.Client, books *storage.Replicated) {
+	copied, err := books.CatchUp(ctx)
+	if copied > 0 {
+		log.Printf("Copied %d missed file(s) to the bound book destinations for account %s\n", copied, client.AccountNumber())
+	}
+	if err != nil {
+		log.Printf("Warning: failed to catch up the bound book destinations for account %s: %v\n", client.AccountNumber(), err)
+	}
+}
+
+// downloadBoundBook Download the daily bound book, record the outcome and report whether it was archived or already had been
+func downloadBoundBook(ctx context.Context, client *fastbound.Client, books storage.Backend) bool {
+	log.Printf("Downloading the latest bound book for account %s\n", client.AccountNumber())
 	// Download the daily Bound Book
-	downloadedBook, err := fastbound.DownloadBoundBook(fastboundAPIBaseURL, settings)
+	downloadedBook, err := client.DownloadBoundBook(ctx, books)
+	var validationErr *fastbound.ValidationError
+	if errors.As(err, &validationErr) {
+		log.Printf("Rejected the bound book for account %s: %v\n", client.AccountNumber(), err)
+		metrics.RejectedBookDownloadsTotal.WithLabelValues(client.AccountNumber()).Inc()
+		return false
+	}
 	if err != nil {
-		metrics.FailedBookDownloadsTotal.Inc()
-		return
+		log.Printf("Failed to download the bound book for account %s: %v\n", client.AccountNumber(), err)
+		metrics.FailedBookDownloadsTotal.WithLabelValues(client.AccountNumber()).Inc()
+		return false
 	}
 	if downloadedBook != "" {
-		metrics.DownloadedBooksTotal.Inc()
+		metrics.DownloadedBooksTotal.WithLabelValues(client.AccountNumber()).Inc()
 		log.Printf("Downloaded the bound book %s\n", downloadedBook)
 	} else {
-		metrics.SkippedBookDownloadsTotal.Inc()
+		metrics.SkippedBookDownloadsTotal.WithLabelValues(client.AccountNumber()).Inc()
+	}
+	return true
+}
+
+// downloadBackgroundChecks Back up any completed 4473s, record the outcome and report whether every one was archived
+func downloadBackgroundChecks(ctx context.Context, client *fastbound.Client, forms storage.Backend) bool {
+	log.Printf("Downloading completed 4473s for account %s\n", client.AccountNumber())
+	results, err := client.DownloadBackgroundChecks(ctx, forms)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Failed to list completed 4473s for account %s: %v\n", client.AccountNumber(), err)
+		metrics.FailedBackgroundCheckDownloadsTotal.WithLabelValues(client.AccountNumber()).Inc()
+		return false
+	}
+	for _, downloadedForm := range results.Downloaded {
+		metrics.DownloadedBackgroundChecksTotal.WithLabelValues(client.AccountNumber()).Inc()
+		log.Printf("Downloaded the 4473 %s\n", downloadedForm)
+	}
+	metrics.SkippedBackgroundCheckDownloadsTotal.WithLabelValues(client.AccountNumber()).Add(float64(results.Skipped))
+	metrics.FailedBackgroundCheckDownloadsTotal.WithLabelValues(client.AccountNumber()).Add(float64(results.Failed))
+	metrics.RejectedBackgroundCheckDownloadsTotal.WithLabelValues(client.AccountNumber()).Add(float64(results.Rejected))
+	if ctx.Err() != nil {
+		log.Printf("Stopped downloading 4473s for account %s to shut down\n", client.AccountNumber())
+		return false
 	}
+	return results.Failed == 0 && results.Rejected == 0
 }
@@ -0,0 +1,88 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/route1337/fastbound-downloader/metrics"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// metricsShutdownTimeout is how long open scrapes get to finish when the metrics server shuts down
+const metricsShutdownTimeout = 5 * time.Second
+
+// withGracePeriod returns a context for in-flight work that is only cancelled once gracePeriod has passed after shutdown is
+// cancelled, giving downloads a chance to finish. Calling the returned cancel function releases it early.
+func withGracePeriod(shutdown context.Context, gracePeriod time.Duration) (context.Context, context.CancelFunc) {
+	work, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-work.Done():
+			return
+		case <-shutdown.Done():
+		}
+		log.Printf("Shutdown requested, giving any in-flight downloads %s to finish\n", gracePeriod)
+		timer := time.NewTimer(gracePeriod)
+		defer timer.Stop()
+		select {
+		case <-work.Done():
+		case <-timer.C:
+			log.Printf("Grace period expired, aborting in-flight downloads\n")
+			cancel()
+		}
+	}()
+	return work, cancel
+}
+
+// sleepUntilShutdown waits for duration and reports whether it finished without a shutdown being requested
+func sleepUntilShutdown(shutdown context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-shutdown.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// startMetricsServer serves the Prometheus metrics, and the health and readiness of the cycles tracked by health, on port
+// in the background. The port is bound before it returns so a port that can't be listened on fails startup.
+func startMetricsServer(port string, health *cycleHealth) (*http.Server, error) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metrics.MetricsRegistry, promhttp.HandlerOpts{}))
+	mux.Handle("/healthz", healthHandler(health.live))
+	mux.Handle("/readyz", healthHandler(health.ready))
+	server := &http.Server{Addr: port, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	listener, err := net.Listen("tcp", port)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the metrics server on %s: %w", port, err)
+	}
+	log.Printf("Metrics server starting on %s\n", port)
+	go func() {
+		// Downloads carry on without the metrics server, and the health probes notice it has stopped answering
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Warning: the metrics server on %s stopped: %v\n", port, err)
+		}
+	}()
+	return server, nil
+}
+
+// stopMetricsServer gracefully shuts the metrics server down, letting in-progress scrapes finish
+func stopMetricsServer(server *http.Server) {
+	shutdownContext, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownContext); err != nil {
+		log.Printf("Warning: failed to shut down the metrics server: %v\n", err)
+	}
+}
@@ -0,0 +1,37 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package cmd
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestStartMetricsServer validates that a port that is already in use is returned as an error instead of exiting
+func TestStartMetricsServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen on a test port: %v", err)
+	}
+	defer func() {
+		if err := listener.Close(); err != nil {
+			t.Logf("Warning: failed to close test listener: %v", err)
+		}
+	}()
+
+	health := &cycleHealth{interval: time.Hour, idleSince: time.Now()}
+	if server, err := startMetricsServer(listener.Addr().String(), health); err == nil {
+		stopMetricsServer(server)
+		t.Fatal("Expected an error starting the metrics server on a port in use")
+	}
+
+	server, err := startMetricsServer("127.0.0.1:0", health)
+	if err != nil {
+		t.Fatalf("startMetricsServer() returned an unexpected error: %v", err)
+	}
+	stopMetricsServer(server)
+}
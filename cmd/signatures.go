@@ -0,0 +1,121 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/apis/fbdownloader_settings"
+	"github.com/route1337/fastbound-downloader/signature"
+	"github.com/route1337/fastbound-downloader/storage"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// verifyPublicKey, verifyIdentityFile and verifyKeyFiles hold the flags passed to the verify-signature command
+var verifyPublicKey string
+var verifyIdentityFile string
+var verifyKeyFiles []string
+
+// verifySignatureCmd represents the verify-signature command
+var verifySignatureCmd = &cobra.Command{
+	Use:   "verify-signature PATH...",
+	Short: "Verify downloaded files against their detached signatures.",
+	Long: fmt.Sprintf(`Check that downloaded bound books and 4473s match the detached signatures written next to them.
+
+Each PATH is either a single downloaded file or a directory, in which case every signature in it and below it is
+checked. --public-key is the Ed25519 PEM public key or armored OpenPGP public key matching the signing key, which is
+told apart by its contents. Ed25519 signatures end in %s and OpenPGP signatures end in %s.
+
+Files archived before signing was turned on are listed as unsigned without failing, while a file that does not match
+its signature or a signature whose file is missing fails the command. Use --identity or --key-file to check records
+that were encrypted before they were archived.`, signature.Ed25519FileSuffix, signature.OpenPGPFileSuffix),
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if verifyPublicKey == "" {
+			log.Fatal("Verifying signatures needs --public-key")
+		}
+		verifier, err := signature.NewVerifier(verifyPublicKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cipher, err := cipherFromFlags(verifyIdentityFile, verifyKeyFiles)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		failed := false
+		for _, target := range args {
+			if !verifySignatures(context.Background(), verifier, cipher, target) {
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// newSigner Create the signer downloads are signed with, or nil if signing is not configured
+func newSigner(settings fbdownloader_settings.FBDConfig) (signature.Signer, error) {
+	if settings.Signing.Type == "" {
+		return nil, nil
+	}
+	return signature.NewSigner(settings.Signing.Type, settings.Signing.PrivateKey, settings.Signing.Passphrase)
+}
+
+// verifySignatures Check a single file or every signature in a directory, print the outcome and report whether it passed
+func verifySignatures(ctx context.Context, verifier signature.Verifier, cipher storage.Cipher, target string) bool {
+	info, err := os.Stat(target)
+	if err != nil {
+		fmt.Printf("FAILED %s: %v\n", target, err)
+		return false
+	}
+
+	if !info.IsDir() {
+		// Accept the signature or the encrypted record in place of the file itself
+		dir, key := filepath.Split(target)
+		key = strings.TrimSuffix(key, verifier.FileSuffix())
+		if cipher != nil {
+			key = strings.TrimSuffix(key, storage.EncryptedFileSuffix)
+		}
+		if err := signature.VerifyFile(ctx, encryptRecords(storage.NewLocal(dir), cipher, ""), verifier, key); err != nil {
+			fmt.Printf("FAILED %s: %v\n", target, err)
+			return false
+		}
+		fmt.Printf("OK %s: signature verified\n", target)
+		return true
+	}
+
+	report, err := signature.VerifyAll(ctx, encryptRecords(storage.NewLocal(target), cipher, ""), verifier, isRecord)
+	if err != nil {
+		fmt.Printf("FAILED %s: %v\n", target, err)
+		return false
+	}
+	for _, failure := range report.Failed {
+		fmt.Printf("FAILED %s: %v\n", filepath.Join(target, failure.Key), failure.Err)
+	}
+	for _, key := range report.Unsigned {
+		fmt.Printf("UNSIGNED %s\n", filepath.Join(target, key))
+	}
+	if len(report.Failed) != 0 {
+		fmt.Printf("FAILED %s: %d signatures verified, %d failed, %d files unsigned\n", target, len(report.Verified), len(report.Failed), len(report.Unsigned))
+		return false
+	}
+	fmt.Printf("OK %s: %d signatures verified, %d files unsigned\n", target, len(report.Verified), len(report.Unsigned))
+	return true
+}
+
+func init() {
+	verifySignatureCmd.Flags().StringVar(&verifyPublicKey, "public-key", "", "The Ed25519 or OpenPGP public key matching the signing key.")
+	verifySignatureCmd.Flags().StringVar(&verifyIdentityFile, "identity", "", "OPTIONAL: An age identity file to decrypt records encrypted to age recipients.")
+	verifySignatureCmd.Flags().StringSliceVar(&verifyKeyFiles, "key-file", nil, "OPTIONAL: A key file to decrypt records encrypted with a key file. May be repeated.")
+	rootCmd.AddCommand(verifySignatureCmd)
+}
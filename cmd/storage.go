@@ -0,0 +1,211 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/apis/fastbound"
+	"github.com/route1337/fastbound-downloader/apis/fbdownloader_settings"
+	"github.com/route1337/fastbound-downloader/ledger"
+	"github.com/route1337/fastbound-downloader/metrics"
+	"github.com/route1337/fastbound-downloader/signature"
+	"github.com/route1337/fastbound-downloader/storage"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+)
+
+// newBookStorage Create the storage an account's bound books are archived to, which copies every book to each of the
+// account's destinations and counts the outcome for each one. Copies are checked against their recorded checksums
+// before they are read, decrypting encrypted copies with cipher.
+func newBookStorage(account fbdownloader_settings.Account, cipher storage.Cipher) (*storage.Replicated, error) {
+	var destinations []storage.Destination
+	for _, destinationSettings := range account.Destinations {
+		backend, err := newDestination(account, destinationSettings)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open destination %s for account %s: %w", destinationSettings.Name, account.Fastbound.AccountNumber, err)
+		}
+		destinations = append(destinations, storage.Destination{Name: destinationSettings.Name, Backend: backend})
+	}
+	return storage.NewReplicated(storage.ReplicatedConfig{
+		Destinations: destinations,
+		Policy:       storage.ReplicationPolicy(account.Replication.Policy),
+		IsRecord:     isRecord,
+		Verify:       verifyRecord(cipher),
+		OnWrite: func(destination string, err error) {
+			if err != nil {
+				metrics.DestinationFailedUploadsTotal.WithLabelValues(account.Fastbound.AccountNumber, destination).Inc()
+				return
+			}
+			metrics.DestinationUploadsTotal.WithLabelValues(account.Fastbound.AccountNumber, destination).Inc()
+		},
+	})
+}
+
+// isRecord Whether a key holds an archived bound book rather than a checksum, a signature, the manifest or the ledger,
+// so copies made to catch up a destination are protected by its retention settings like the original upload was
+func isRecord(key string) bool {
+	return !strings.HasSuffix(key, fastbound.ChecksumFileSuffix) && !signature.IsSignatureFile(key) &&
+		key != fastbound.ManifestFileName && key != ledger.FileName && !isWorkingFile(key)
+}
+
+// isWorkingFile Whether a key holds an unfinished download, or a download in the default quarantine or staging folder,
+// rather than anything that was archived
+func isWorkingFile(key string) bool {
+	name := path.Base(key)
+	if strings.HasPrefix(name, storage.PartialFilePrefix) && strings.HasSuffix(name, storage.PartialFileSuffix) {
+		return true
+	}
+	dir, _, _ := strings.Cut(key, "/")
+	return dir == fbdownloader_settings.QuarantineDirName || dir == fbdownloader_settings.StagingDirName
+}
+
+// newLocal Create a local storage backend for one of an account's directories, leaving the account's quarantine and
+// staging folders out of its listings when they are inside it
+func newLocal(account fbdownloader_settings.Account, dir string) *storage.Local {
+	return storage.NewLocal(dir, account.Paths.Quarantine, account.Paths.Staging)
+}
+
+// verifyRecord Check a copy of a record against the checksum recorded next to it. Encrypted copies are decrypted with
+// cipher first, and trusted if there is no cipher to decrypt them with.
+func verifyRecord(cipher storage.Cipher) func(ctx context.Context, backend storage.Backend, key string) error {
+	return func(ctx context.Context, backend storage.Backend, key string) error {
+		original, encrypted := strings.CutSuffix(key, storage.EncryptedFileSuffix)
+		if !encrypted {
+			return fastbound.VerifyChecksum(ctx, backend, key)
+		}
+		if cipher == nil {
+			return nil
+		}
+		return fastbound.VerifyChecksum(ctx, encryptRecords(backend, cipher, ""), original)
+	}
+}
+
+// newDestination Create the storage backend for one of an account's bound book destinations
+func newDestination(account fbdownloader_settings.Account, destination fbdownloader_settings.StorageSettings) (storage.Backend, error) {
+	switch destination.Type {
+	case "s3":
+		s3Settings := destination.S3
+		return storage.NewS3(storage.S3Config{
+			Endpoint:             s3Settings.Endpoint,
+			Bucket:               s3Settings.Bucket,
+			Prefix:               s3Settings.Prefix,
+			Region:               s3Settings.Region,
+			PathStyle:            s3Settings.PathStyle,
+			AccessKeyID:          s3Settings.AccessKeyID,
+			SecretAccessKey:      s3Settings.SecretAccessKey,
+			ServerSideEncryption: s3Settings.ServerSideEncryption,
+			KMSKeyID:             s3Settings.KMSKeyID,
+			PartSize:             uint64(s3Settings.PartSizeInMB) * 1024 * 1024,
+			ObjectLockMode:       s3Settings.ObjectLock.Mode,
+			RetentionPeriod:      time.Duration(s3Settings.ObjectLock.RetentionInDays) * 24 * time.Hour,
+			LegalHold:            s3Settings.ObjectLock.LegalHold,
+		})
+	case "sftp":
+		sftpSettings := destination.SFTP
+		return storage.NewSFTP(storage.SFTPConfig{
+			Address:        sftpSettings.Address,
+			User:           sftpSettings.User,
+			PrivateKeyPath: sftpSettings.PrivateKey,
+			Passphrase:     sftpSettings.PrivateKeyPassphrase,
+			KnownHostsPath: sftpSettings.KnownHosts,
+			RemoteDir:      sftpSettings.RemoteDir,
+		})
+	case "webdav":
+		webDAVSettings := destination.WebDAV
+		return storage.NewWebDAV(storage.WebDAVConfig{
+			URL:         webDAVSettings.URL,
+			Username:    webDAVSettings.Username,
+			Password:    webDAVSettings.Password,
+			BearerToken: webDAVSettings.BearerToken,
+			CAFile:      webDAVSettings.CAFile,
+		})
+	case "azure":
+		azureSettings := destination.Azure
+		return storage.NewAzure(storage.AzureConfig{
+			ServiceURL:       azureSettings.ServiceURL,
+			AccountName:      azureSettings.AccountName,
+			AccountKey:       azureSettings.AccountKey,
+			SASToken:         azureSettings.SASToken,
+			Container:        azureSettings.Container,
+			Prefix:           azureSettings.Prefix,
+			BlockSize:        int64(azureSettings.BlockSizeInMB) * 1024 * 1024,
+			ImmutabilityMode: azureSettings.Immutability.Mode,
+			RetentionPeriod:  time.Duration(azureSettings.Immutability.RetentionInDays) * 24 * time.Hour,
+			LegalHold:        azureSettings.Immutability.LegalHold,
+		})
+	default:
+		return newLocal(account, destination.Path), nil
+	}
+}
+
+// checkStorage Make sure every account's bound book storage is usable, such as an S3 bucket having Object Lock or an Azure
+// container having version-level immutability enabled when retention is configured, and exit if the destinations its
+// replication policy requires are not
+func checkStorage(ctx context.Context, settings fbdownloader_settings.FBDConfig) {
+	for _, account := range settings.Accounts {
+		// Checking storage reads no records, so there is nothing to decrypt
+		books, err := newBookStorage(account, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = storage.Check(ctx, books)
+		closeStorage(books)
+		if err != nil {
+			log.Fatalf("Bound book storage for account %s is not usable: %v", account.Fastbound.AccountNumber, err)
+		}
+	}
+}
+
+// closeStorage Disconnect from a storage backend that holds a connection open, such as an SFTP server
+func closeStorage(backend storage.Backend) {
+	closer, ok := backend.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		log.Printf("Warning: failed to disconnect from %s: %v", backend.Location(""), err)
+	}
+}
+
+// accountStorages Every storage backend records are archived to across all configured accounts, decrypting records
+// when encryption is configured
+func accountStorages(settings fbdownloader_settings.FBDConfig) ([]storage.Backend, error) {
+	cipher, err := newCipher(settings)
+	if err != nil {
+		return nil, err
+	}
+	var backends []storage.Backend
+	for _, account := range settings.Accounts {
+		// Every destination keeps its own ledger, so each one is checked separately
+		for _, destination := range account.Destinations {
+			books, err := newDestination(account, destination)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open destination %s for account %s: %w", destination.Name, account.Fastbound.AccountNumber, err)
+			}
+			backends = append(backends, encryptRecords(books, cipher, account.Paths.Staging))
+		}
+		backends = append(backends, encryptRecords(newLocal(account, account.Paths.BackgroundChecks), cipher, account.Paths.Staging))
+	}
+	return backends, nil
+}
+
+// localDirs Every local directory records are archived to across all configured accounts
+func localDirs(settings fbdownloader_settings.FBDConfig) []string {
+	var dirs []string
+	for _, account := range settings.Accounts {
+		for _, destination := range account.Destinations {
+			if destination.Type == "local" {
+				dirs = append(dirs, destination.Path)
+			}
+		}
+		dirs = append(dirs, account.Paths.BackgroundChecks)
+	}
+	return dirs
+}
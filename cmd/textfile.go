@@ -0,0 +1,55 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/route1337/fastbound-downloader/apis/fbdownloader_settings"
+	"github.com/route1337/fastbound-downloader/metrics"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// writeTextfile Write everything gatherer collects to a .prom file for the node_exporter textfile collector. Gauges
+// only some cycles set, such as the last success, are carried forward from the file the last run wrote so a cron run that
+// doesn't set them keeps their old values. The file is written under a temporary name and renamed into place, so the
+// collector never reads it half written.
+func writeTextfile(settings fbdownloader_settings.TextfileCollectorSettings, gatherer prometheus.Gatherer) error {
+	textfilePath := filepath.Join(settings.Directory, settings.FileName)
+	previous, err := readTextfile(textfilePath)
+	if err != nil {
+		log.Printf("Warning: %v, the last values of gauges this cycle didn't set will be dropped\n", err)
+	}
+	if err := prometheus.WriteToTextfile(textfilePath, metrics.CarryForward(gatherer, previous)); err != nil {
+		return fmt.Errorf("failed to write metrics to %s: %w", textfilePath, err)
+	}
+	return nil
+}
+
+// readTextfile Read the metrics written to textfilePath by the last run, or none if there is no file yet
+func readTextfile(textfilePath string) ([]*dto.MetricFamily, error) {
+	textfile, err := os.Open(textfilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", textfilePath, err)
+	}
+	defer func() {
+		if err := textfile.Close(); err != nil {
+			log.Printf("Warning: failed to close %s: %v\n", textfilePath, err)
+		}
+	}()
+	families, err := metrics.ParseText(textfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics from %s: %w", textfilePath, err)
+	}
+	return families, nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package cmd
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/route1337/fastbound-downloader/apis/fbdownloader_settings"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// cronRunRegistry builds the registry a cron run starts with, setting the gauges a run sets for an account that succeeded
+// and downloaded a new book, or only the attempt for one that failed
+func cronRunRegistry(succeeded bool, ranAt float64) *prometheus.Registry {
+	newGauge := func(name string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: name}, []string{"account"})
+	}
+	attempt := newGauge("fastbound_downloader_last_attempt_timestamp_seconds")
+	success := newGauge("fastbound_downloader_last_success_timestamp_seconds")
+	bookSize := newGauge("fastbound_downloader_last_book_size_bytes")
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(attempt, success, bookSize)
+
+	attempt.WithLabelValues("123456").Set(ranAt)
+	if succeeded {
+		success.WithLabelValues("123456").Set(ranAt)
+		bookSize.WithLabelValues("123456").Set(1337)
+	}
+	return registry
+}
+
+// TestWriteTextfile validates that a failed cron run keeps the last success and book size written by the run before it
+func TestWriteTextfile(t *testing.T) {
+	settings := fbdownloader_settings.TextfileCollectorSettings{Directory: t.TempDir(), FileName: "fastbound_downloader.prom"}
+	if err := writeTextfile(settings, cronRunRegistry(true, 1000)); err != nil {
+		t.Fatalf("writeTextfile() returned an unexpected error: %v", err)
+	}
+	if err := writeTextfile(settings, cronRunRegistry(false, 2000)); err != nil {
+		t.Fatalf("writeTextfile() returned an unexpected error: %v", err)
+	}
+
+	textfile, err := os.ReadFile(filepath.Join(settings.Directory, settings.FileName))
+	if err != nil {
+		t.Fatalf("Failed to read the textfile: %v", err)
+	}
+	for _, want := range []string{
+		`fastbound_downloader_last_attempt_timestamp_seconds{account="123456"} 2000`,
+		`fastbound_downloader_last_success_timestamp_seconds{account="123456"} 1000`,
+		`fastbound_downloader_last_book_size_bytes{account="123456"} 1337`,
+	} {
+		if !strings.Contains(string(textfile), want+"\n") {
+			t.Errorf("Expected the textfile to contain %q but got:\n%s", want, textfile)
+		}
+	}
+}
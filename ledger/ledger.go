@@ -0,0 +1,237 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package ledger
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/route1337/fastbound-downloader/storage"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// FileName is the name of the ledger kept in every destination
+const FileName = "ledger.jsonl"
+
+// genesisHash is the previous hash of the first entry in a ledger
+var genesisHash = strings.Repeat("0", sha256.Size*2)
+
+// Entry A single link in the hash chain describing one archived file
+type Entry struct {
+	Sequence      uint64    `json:"sequence"`
+	RecordedAt    time.Time `json:"recorded-at"`
+	FileName      string    `json:"filename"`
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256"`
+	AccountNumber string    `json:"account-number"`
+	AuditUser     string    `json:"audit-user"`
+	PreviousHash  string    `json:"previous-hash"`
+	Hash          string    `json:"hash"`
+}
+
+// Record A file recorded outside the ledger, such as in the manifest or a checksum sidecar, which must have an entry
+type Record struct {
+	FileName   string
+	SHA256     string
+	RecordedAt time.Time // When the file was downloaded, so files archived before the ledger was started are not expected in it
+	Source     string    // Where the file is recorded, for errors
+}
+
+// BrokenLinkError Describes the first place a ledger fails verification
+type BrokenLinkError struct {
+	Line     int    // Line in the ledger file, starting at 1
+	Sequence uint64 // Sequence of the entry on that line, 0 if it could not be read
+	Reason   string
+}
+
+func (e *BrokenLinkError) Error() string {
+	return fmt.Sprintf("ledger broken at line %d (sequence %d): %s", e.Line, e.Sequence, e.Reason)
+}
+
+// computeHash returns the hash of an entry, which covers every field except the hash itself
+func computeHash(entry Entry) (string, error) {
+	entry.Hash = ""
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lastEntry returns the final entry of the ledger in backend, or nil if the ledger is empty or missing
+func lastEntry(ctx context.Context, backend storage.Backend) (*Entry, error) {
+	ledgerFile, err := backend.Get(ctx, FileName)
+	if errors.Is(err, storage.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger: %w", err)
+	}
+	ledgerPath := backend.Location(FileName)
+	defer func() {
+		if err := ledgerFile.Close(); err != nil {
+			log.Printf("Warning: failed to close ledger %s: %v", ledgerPath, err)
+		}
+	}()
+
+	var last []byte
+	scanner := bufio.NewScanner(ledgerFile)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			last = append(last[:0], line...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ledger %s: %w", ledgerPath, err)
+	}
+	if last == nil {
+		return nil, nil
+	}
+	var entry Entry
+	if err := json.Unmarshal(last, &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode the last entry in ledger %s: %w", ledgerPath, err)
+	}
+	return &entry, nil
+}
+
+// Append links entry to the end of the ledger in backend and returns it with its sequence and hashes filled in
+func Append(ctx context.Context, backend storage.Backend, entry Entry) (Entry, error) {
+	previous, err := lastEntry(ctx, backend)
+	if err != nil {
+		return entry, err
+	}
+	entry.Sequence = 1
+	entry.PreviousHash = genesisHash
+	if previous != nil {
+		entry.Sequence = previous.Sequence + 1
+		entry.PreviousHash = previous.Hash
+	}
+	if entry.RecordedAt.IsZero() {
+		entry.RecordedAt = time.Now()
+	}
+	entry.RecordedAt = entry.RecordedAt.UTC()
+	if entry.Hash, err = computeHash(entry); err != nil {
+		return entry, fmt.Errorf("failed to hash ledger entry for %s: %w", entry.FileName, err)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return entry, fmt.Errorf("failed to encode ledger entry for %s: %w", entry.FileName, err)
+	}
+	if err := storage.Append(ctx, backend, FileName, append(line, '\n')); err != nil {
+		return entry, fmt.Errorf("failed to append to ledger: %w", err)
+	}
+	return entry, nil
+}
+
+// Verify walks the ledger in backend from the first entry, checking every link in the chain and that every archived file
+// still matches its recorded hash. Removing entries from the end of the ledger leaves a chain that still links, so each
+// of records archived since the ledger was started must also have an entry with the same hash. It returns the number of
+// entries verified and a *BrokenLinkError for the first problem found.
+func Verify(ctx context.Context, backend storage.Backend, records []Record) (int, error) {
+	ledgerFile, err := backend.Get(ctx, FileName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open ledger: %w", err)
+	}
+	ledgerPath := backend.Location(FileName)
+	defer func() {
+		if err := ledgerFile.Close(); err != nil {
+			log.Printf("Warning: failed to close ledger %s: %v", ledgerPath, err)
+		}
+	}()
+
+	verified := 0
+	previousHash := genesisHash
+	expectedSequence := uint64(1)
+	var started time.Time
+	linked := make(map[string]bool)
+	lineNumber := 1
+	scanner := bufio.NewScanner(ledgerFile)
+	for ; scanner.Scan(); lineNumber++ {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return verified, &BrokenLinkError{Line: lineNumber, Reason: fmt.Sprintf("entry could not be decoded: %v", err)}
+		}
+		broken := func(reason string, args ...any) error {
+			return &BrokenLinkError{Line: lineNumber, Sequence: entry.Sequence, Reason: fmt.Sprintf(reason, args...)}
+		}
+
+		if entry.Sequence != expectedSequence {
+			return verified, broken("expected sequence %d, an entry was removed or reordered", expectedSequence)
+		}
+		if entry.PreviousHash != previousHash {
+			return verified, broken("previous hash does not match the entry before it")
+		}
+		recomputed, err := computeHash(entry)
+		if err != nil {
+			return verified, broken("entry could not be hashed: %v", err)
+		}
+		if entry.Hash != recomputed {
+			return verified, broken("entry hash does not match its contents, the entry was modified")
+		}
+		if err := verifyFile(ctx, backend, entry); err != nil {
+			return verified, broken("%v", err)
+		}
+
+		if verified == 0 {
+			started = entry.RecordedAt
+		}
+		linked[entry.FileName+" "+entry.SHA256] = true
+		previousHash = entry.Hash
+		expectedSequence++
+		verified++
+	}
+	if err := scanner.Err(); err != nil {
+		return verified, fmt.Errorf("failed to read ledger %s: %w", ledgerPath, err)
+	}
+
+	for _, record := range records {
+		if verified > 0 && record.RecordedAt.Before(started) {
+			continue
+		}
+		if !linked[record.FileName+" "+record.SHA256] {
+			return verified, &BrokenLinkError{Line: lineNumber, Sequence: expectedSequence, Reason: fmt.Sprintf(
+				"%s is recorded in %s with SHA-256 %s but has no ledger entry, entries were removed from the end or never written",
+				record.FileName, record.Source, record.SHA256)}
+		}
+	}
+	return verified, nil
+}
+
+// verifyFile checks that the archived file an entry describes still exists and still has the recorded hash
+func verifyFile(ctx context.Context, backend storage.Backend, entry Entry) error {
+	archivedFile, err := backend.Get(ctx, entry.FileName)
+	if errors.Is(err, storage.ErrNotExist) {
+		return fmt.Errorf("%s was deleted", entry.FileName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", entry.FileName, err)
+	}
+	defer func() {
+		if err := archivedFile.Close(); err != nil {
+			log.Printf("Warning: failed to close %s: %v", entry.FileName, err)
+		}
+	}()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, archivedFile)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", entry.FileName, err)
+	}
+	if size != entry.Size || hex.EncodeToString(hasher.Sum(nil)) != entry.SHA256 {
+		return fmt.Errorf("%s no longer matches its recorded hash, the file was altered", entry.FileName)
+	}
+	return nil
+}
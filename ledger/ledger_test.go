@@ -0,0 +1,170 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package ledger
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/route1337/fastbound-downloader/storage"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createLedger archives three test files in a temp directory and links each of them into a new ledger, returning the
+// records the manifest would hold for them
+func createLedger(t *testing.T) (string, []Record) {
+	tempDir := t.TempDir()
+	var records []Record
+	for _, name := range []string{"BOOK_1.pdf", "BOOK_2.pdf", "BOOK_3.pdf"} {
+		content := []byte("Guns. Lots of guns. " + name)
+		if err := os.WriteFile(filepath.Join(tempDir, name), content, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		sum := sha256.Sum256(content)
+		entry, err := Append(context.Background(), storage.NewLocal(tempDir), Entry{
+			FileName:      name,
+			Size:          int64(len(content)),
+			SHA256:        hex.EncodeToString(sum[:]),
+			AccountNumber: "123456",
+			AuditUser:     "pgibbons@initech.com",
+		})
+		if err != nil {
+			t.Fatalf("Append() returned an unexpected error: %v", err)
+		}
+		records = append(records, Record{FileName: name, SHA256: entry.SHA256, RecordedAt: entry.RecordedAt, Source: "manifest.jsonl"})
+	}
+	return tempDir, records
+}
+
+// TestAppend validates that entries are sequenced and chained to the one before them
+func TestAppend(t *testing.T) {
+	tempDir, _ := createLedger(t)
+	last, err := lastEntry(context.Background(), storage.NewLocal(tempDir))
+	if err != nil || last == nil {
+		t.Fatalf("lastEntry() returned an unexpected result: %v, %v", last, err)
+	}
+	if last.Sequence != 3 {
+		t.Errorf("Expected the last entry to have sequence 3, but got %d", last.Sequence)
+	}
+	if last.PreviousHash == genesisHash || last.Hash == "" {
+		t.Errorf("Expected the last entry to be chained to the one before it: %+v", last)
+	}
+}
+
+// TestVerify validates that Verify accepts an untouched ledger and reports the first broken link otherwise
+func TestVerify(t *testing.T) {
+	t.Run("Test untouched ledger", func(t *testing.T) {
+		tempDir, records := createLedger(t)
+		verified, err := Verify(context.Background(), storage.NewLocal(tempDir), records)
+		if err != nil {
+			t.Errorf("Expected no error but got: %v", err)
+		}
+		if verified != 3 {
+			t.Errorf("Expected 3 verified entries but got %d", verified)
+		}
+	})
+
+	t.Run("Test records from before the ledger was started", func(t *testing.T) {
+		tempDir, records := createLedger(t)
+		legacy := Record{FileName: "BOOK_0.pdf", SHA256: genesisHash, RecordedAt: records[0].RecordedAt.Add(-time.Hour), Source: "manifest.jsonl"}
+		verified, err := Verify(context.Background(), storage.NewLocal(tempDir), append([]Record{legacy}, records...))
+		if err != nil || verified != 3 {
+			t.Errorf("Expected 3 verified entries and no error but got %d: %v", verified, err)
+		}
+	})
+
+	t.Run("Test truncated ledger", func(t *testing.T) {
+		tempDir, records := createLedger(t)
+		rewriteLedger(t, tempDir, func(lines []string) []string {
+			return lines[:2]
+		})
+
+		verified, err := Verify(context.Background(), storage.NewLocal(tempDir), records)
+		var brokenLink *BrokenLinkError
+		if !errors.As(err, &brokenLink) {
+			t.Fatalf("Expected a BrokenLinkError but got: %v", err)
+		}
+		if brokenLink.Line != 3 || brokenLink.Sequence != 3 || verified != 2 {
+			t.Errorf("Expected the chain to break at line 3 after 2 verified entries, but got line %d after %d: %v", brokenLink.Line, verified, err)
+		}
+		if !strings.Contains(err.Error(), "BOOK_3.pdf") {
+			t.Errorf("Expected the error to name the missing file but got: %v", err)
+		}
+	})
+
+	// Each tamper function alters the archive in a different way, all of which should break the chain at line 2
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, dir string)
+	}{
+		{
+			name: "Deleted archived file",
+			tamper: func(t *testing.T, dir string) {
+				if err := os.Remove(filepath.Join(dir, "BOOK_2.pdf")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "Rewritten archived file",
+			tamper: func(t *testing.T, dir string) {
+				if err := os.WriteFile(filepath.Join(dir, "BOOK_2.pdf"), []byte("No guns here."), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "Rewritten ledger line",
+			tamper: func(t *testing.T, dir string) {
+				rewriteLedger(t, dir, func(lines []string) []string {
+					lines[1] = strings.Replace(lines[1], "pgibbons@initech.com", "mbolton@initech.com", 1)
+					return lines
+				})
+			},
+		},
+		{
+			name: "Deleted ledger line",
+			tamper: func(t *testing.T, dir string) {
+				rewriteLedger(t, dir, func(lines []string) []string {
+					return append(lines[:1], lines[2:]...)
+				})
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tempDir, records := createLedger(t)
+			test.tamper(t, tempDir)
+
+			verified, err := Verify(context.Background(), storage.NewLocal(tempDir), records)
+			var brokenLink *BrokenLinkError
+			if !errors.As(err, &brokenLink) {
+				t.Fatalf("Expected a BrokenLinkError but got: %v", err)
+			}
+			if brokenLink.Line != 2 || verified != 1 {
+				t.Errorf("Expected the chain to break at line 2 after 1 verified entry, but got line %d after %d: %v", brokenLink.Line, verified, err)
+			}
+		})
+	}
+}
+
+// rewriteLedger replaces the lines of the ledger in dir with the result of edit
+func rewriteLedger(t *testing.T, dir string, edit func([]string) []string) {
+	ledgerPath := filepath.Join(dir, FileName)
+	content, err := os.ReadFile(ledgerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := edit(strings.Split(strings.TrimSpace(string(content)), "\n"))
+	if err := os.WriteFile(ledgerPath, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+	"io"
+	"sort"
+	"strings"
+)
+
+// carriedGauges names the gauges only some cycles set. A cron run starts with none of them set, so their last values are
+// carried forward from the metrics the previous run left behind rather than disappearing until they are set again.
+var carriedGauges = map[string]bool{
+	"fastbound_downloader_last_success_timestamp_seconds":  true,
+	"fastbound_downloader_last_download_timestamp_seconds": true,
+	"fastbound_downloader_last_book_size_bytes":            true,
+}
+
+// ParseText Read metric families in the Prometheus text format, such as a textfile written by a previous run
+func ParseText(r io.Reader) ([]*dto.MetricFamily, error) {
+	parser := expfmt.NewTextParser(model.LegacyValidation)
+	byName, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		return nil, err
+	}
+	families := make([]*dto.MetricFamily, 0, len(byName))
+	for _, family := range byName {
+		families = append(families, family)
+	}
+	return families, nil
+}
+
+// CarryForward Gather from gatherer, adding the series of the carried gauges in previous that this run has not set
+func CarryForward(gatherer prometheus.Gatherer, previous []*dto.MetricFamily) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := gatherer.Gather()
+		if err != nil {
+			return families, err
+		}
+		byName := make(map[string]*dto.MetricFamily, len(families))
+		for _, family := range families {
+			byName[family.GetName()] = family
+		}
+		for _, old := range previous {
+			if !carriedGauges[old.GetName()] || old.GetType() != dto.MetricType_GAUGE {
+				continue
+			}
+			family, ok := byName[old.GetName()]
+			if !ok {
+				family = &dto.MetricFamily{Name: old.Name, Help: old.Help, Type: old.Type}
+				byName[old.GetName()] = family
+				families = append(families, family)
+			}
+			set := make(map[string]bool, len(family.Metric))
+			for _, metric := range family.Metric {
+				set[labelKey(metric)] = true
+			}
+			for _, metric := range old.Metric {
+				if key := labelKey(metric); !set[key] {
+					family.Metric = append(family.Metric, metric)
+					set[key] = true
+				}
+			}
+			sort.Slice(family.Metric, func(i, j int) bool {
+				return labelKey(family.Metric[i]) < labelKey(family.Metric[j])
+			})
+		}
+		// Gatherers return families sorted by name
+		sort.Slice(families, func(i, j int) bool {
+			return families[i].GetName() < families[j].GetName()
+		})
+		return families, nil
+	})
+}
+
+// labelKey Identify a series within its family by its labels
+func labelKey(metric *dto.Metric) string {
+	pairs := make([]string, 0, len(metric.Label))
+	for _, label := range metric.Label {
+		pairs = append(pairs, label.GetName()+"="+label.GetValue())
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
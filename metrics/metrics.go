@@ -7,34 +7,219 @@ package metrics
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
+	"time"
 )
 
+// Reasons a download can fail, used as the reason label of FailuresTotal
+const (
+	FailureAuth       = "auth"        // Fastbound rejected the API key or audit user
+	FailureHTTPStatus = "http_status" // Fastbound or its storage answered with any other unsuccessful status
+	FailureNetwork    = "network"     // Connecting or receiving a response failed or timed out
+	FailureDisk       = "disk"        // Reading or writing a local file failed
+	FailureValidation = "validation"  // The download was not a complete PDF and was quarantined
+	FailureOther      = "other"       // Anything else, such as a destination refusing the file
+)
+
+// FailureReasons lists every reason label of FailuresTotal
+var FailureReasons = []string{FailureAuth, FailureHTTPStatus, FailureNetwork, FailureDisk, FailureValidation, FailureOther}
+
 // MetricsRegistry creates our own custom metrics registry with no defaults
 var MetricsRegistry = prometheus.NewRegistry()
 
 var (
 	// DownloadedBooksTotal counts the total number of successful bound book downloads
-	DownloadedBooksTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	DownloadedBooksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "fastbound_downloader_downloaded_books_total",
 		Help: "The total number of successful bound book downloads",
-	})
+	}, []string{"account"})
 
 	// SkippedBookDownloadsTotal counts the total number of bound books downloads that were skipped due to an existing file
-	SkippedBookDownloadsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	SkippedBookDownloadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "fastbound_downloader_skipped_book_downloads_total",
 		Help: "The total number of times the found book was already detected as downloaded",
-	})
+	}, []string{"account"})
 
 	// FailedBookDownloadsTotal counts the total number of failed bound book downloads
-	FailedBookDownloadsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	FailedBookDownloadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "fastbound_downloader_failed_book_downloads_total",
 		Help: "The total number of failed attempts at downloading a bound book",
+	}, []string{"account"})
+
+	// RejectedBookDownloadsTotal counts the total number of bound book downloads that were quarantined for not being a valid PDF
+	RejectedBookDownloadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fastbound_downloader_rejected_book_downloads_total",
+		Help: "The total number of downloaded bound books that failed validation and were quarantined",
+	}, []string{"account"})
+
+	// DownloadMismatchesTotal counts the total number of previous downloads found to no longer match what Fastbound serves
+	DownloadMismatchesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fastbound_downloader_download_mismatches_total",
+		Help: "The total number of times a previously downloaded bound book or 4473 no longer matched what Fastbound served and was downloaded again",
+	}, []string{"account"})
+
+	// DownloadedBackgroundChecksTotal counts the total number of successful 4473 downloads
+	DownloadedBackgroundChecksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fastbound_downloader_downloaded_background_checks_total",
+		Help: "The total number of successful 4473 downloads",
+	}, []string{"account"})
+
+	// SkippedBackgroundCheckDownloadsTotal counts the total number of 4473 downloads that were skipped due to an existing file
+	SkippedBackgroundCheckDownloadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fastbound_downloader_skipped_background_check_downloads_total",
+		Help: "The total number of times a completed 4473 was already detected as downloaded",
+	}, []string{"account"})
+
+	// FailedBackgroundCheckDownloadsTotal counts the total number of failed 4473 downloads
+	FailedBackgroundCheckDownloadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fastbound_downloader_failed_background_check_downloads_total",
+		Help: "The total number of failed attempts at downloading a 4473",
+	}, []string{"account"})
+
+	// RejectedBackgroundCheckDownloadsTotal counts the total number of 4473 downloads that were quarantined for not being a valid PDF
+	RejectedBackgroundCheckDownloadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fastbound_downloader_rejected_background_check_downloads_total",
+		Help: "The total number of downloaded 4473s that failed validation and were quarantined",
+	}, []string{"account"})
+
+	// DownloadedBytesTotal counts the total number of bytes received while downloading bound books and 4473s
+	DownloadedBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fastbound_downloader_downloaded_bytes_total",
+		Help: "The total number of bytes received while downloading bound books and 4473s",
+	}, []string{"account"})
+
+	// FastboundRetriesTotal counts the total number of retried requests to Fastbound and its download URLs
+	FastboundRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fastbound_downloader_fastbound_retries_total",
+		Help: "The total number of times a request to Fastbound was retried after a temporary failure",
+	}, []string{"account"})
+
+	// FailuresTotal counts the total number of failed and rejected downloads by why they failed
+	FailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fastbound_downloader_failures_total",
+		Help: "The total number of failed or rejected bound book and 4473 downloads by reason: auth, http_status, network, disk, validation or other",
+	}, []string{"account", "reason"})
+
+	// DestinationUploadsTotal counts the total number of files successfully stored in each bound book destination
+	DestinationUploadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fastbound_downloader_destination_uploads_total",
+		Help: "The total number of bound books, checksums, manifests and ledgers stored in a bound book destination",
+	}, []string{"account", "destination"})
+
+	// DestinationFailedUploadsTotal counts the total number of files that failed to be stored in each bound book destination
+	DestinationFailedUploadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fastbound_downloader_destination_failed_uploads_total",
+		Help: "The total number of failed attempts at storing a file in a bound book destination",
+	}, []string{"account", "destination"})
+)
+
+var (
+	// APIRequestDurationSeconds observes how long Fastbound API calls take, including any retries
+	APIRequestDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fastbound_downloader_api_request_duration_seconds",
+		Help:    "How long Fastbound API calls took, including any retries, by HTTP method",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 10), // 100ms to 51.2s
+	}, []string{"account", "method"})
+
+	// DownloadDurationSeconds observes how long bound book and 4473 files take to download
+	DownloadDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fastbound_downloader_download_duration_seconds",
+		Help:    "How long downloading a bound book or 4473 file took, including any resumed attempts",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 10), // 500ms to 256s
+	}, []string{"account"})
+)
+
+var (
+	// LastRunSuccess records whether the last cycle finished without a failed or rejected download
+	LastRunSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "fastbound_downloader_last_run_success",
+		Help: "1 if the last cycle finished without a failed or rejected download, 0 if it did not",
+	})
+
+	// LastRunTimestampSeconds records when the last cycle finished
+	LastRunTimestampSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "fastbound_downloader_last_run_timestamp_seconds",
+		Help: "The Unix time the last cycle finished",
 	})
+
+	// LastAttemptTimestampSeconds records when each account was last backed up, whatever the outcome
+	LastAttemptTimestampSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fastbound_downloader_last_attempt_timestamp_seconds",
+		Help: "The Unix time an account's bound book and 4473s were last backed up, whatever the outcome",
+	}, []string{"account"})
+
+	// LastSuccessTimestampSeconds records when each account was last backed up without a failed or rejected download
+	LastSuccessTimestampSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fastbound_downloader_last_success_timestamp_seconds",
+		Help: "The Unix time an account's bound book and 4473s were last backed up without a failed or rejected download",
+	}, []string{"account"})
+
+	// LastDownloadTimestampSeconds records when a bound book or 4473 was last downloaded and stored for each account
+	LastDownloadTimestampSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fastbound_downloader_last_download_timestamp_seconds",
+		Help: "The Unix time a bound book or 4473 was last downloaded and stored for an account",
+	}, []string{"account"})
+
+	// LastBookSizeBytes records the size of the bound book last downloaded for each account
+	LastBookSizeBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "fastbound_downloader_last_book_size_bytes",
+		Help: "The size in bytes of the bound book last downloaded for an account",
+	}, []string{"account"})
 )
 
+// accountCounters lists every counter labelled by Fastbound account number
+var accountCounters = []*prometheus.CounterVec{
+	DownloadedBooksTotal,
+	SkippedBookDownloadsTotal,
+	FailedBookDownloadsTotal,
+	RejectedBookDownloadsTotal,
+	DownloadMismatchesTotal,
+	DownloadedBackgroundChecksTotal,
+	SkippedBackgroundCheckDownloadsTotal,
+	FailedBackgroundCheckDownloadsTotal,
+	RejectedBackgroundCheckDownloadsTotal,
+	DownloadedBytesTotal,
+	FastboundRetriesTotal,
+}
+
+// destinationCounters lists every counter labelled by Fastbound account number and bound book destination
+var destinationCounters = []*prometheus.CounterVec{
+	DestinationUploadsTotal,
+	DestinationFailedUploadsTotal,
+}
+
 // A function to initialize our registry with our counters
 func init() {
-	MetricsRegistry.MustRegister(DownloadedBooksTotal)
-	MetricsRegistry.MustRegister(SkippedBookDownloadsTotal)
-	MetricsRegistry.MustRegister(FailedBookDownloadsTotal)
+	for _, counter := range append(accountCounters, destinationCounters...) {
+		MetricsRegistry.MustRegister(counter)
+	}
+	MetricsRegistry.MustRegister(FailuresTotal, APIRequestDurationSeconds, DownloadDurationSeconds)
+	MetricsRegistry.MustRegister(LastRunSuccess, LastRunTimestampSeconds, LastAttemptTimestampSeconds, LastSuccessTimestampSeconds)
+	MetricsRegistry.MustRegister(LastDownloadTimestampSeconds, LastBookSizeBytes)
+}
+
+// InitAccount Start every counter for an account at zero so its series exist before anything is counted
+func InitAccount(accountNumber string) {
+	for _, counter := range accountCounters {
+		counter.WithLabelValues(accountNumber)
+	}
+	for _, reason := range FailureReasons {
+		FailuresTotal.WithLabelValues(accountNumber, reason)
+	}
+}
+
+// InitDestination Start every counter for one of an account's bound book destinations at zero
+func InitDestination(accountNumber string, destination string) {
+	for _, counter := range destinationCounters {
+		counter.WithLabelValues(accountNumber, destination)
+	}
+}
+
+// RecordRun Record the outcome of a cycle that finished at finishedAt
+func RecordRun(succeeded bool, finishedAt time.Time) {
+	if succeeded {
+		LastRunSuccess.Set(1)
+	} else {
+		LastRunSuccess.Set(0)
+	}
+	LastRunTimestampSeconds.Set(float64(finishedAt.Unix()))
 }
@@ -0,0 +1,304 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package signature
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/route1337/fastbound-downloader/storage"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Ed25519FileSuffix and OpenPGPFileSuffix are added to the key of a file to name its detached signature
+const (
+	Ed25519FileSuffix = ".sig"
+	OpenPGPFileSuffix = ".asc"
+)
+
+// ErrBadSignature is returned, possibly wrapped, when a file does not match its signature
+var ErrBadSignature = errors.New("signature does not match the file")
+
+// Signer Creates detached signatures with a private key
+type Signer interface {
+	// Sign returns a detached signature of message
+	Sign(message io.Reader) ([]byte, error)
+	// FileSuffix is added to the key of a signed file to name its signature
+	FileSuffix() string
+}
+
+// Verifier Checks detached signatures against a public key
+type Verifier interface {
+	// Verify checks that signature was made over message by the private key matching the public key
+	Verify(message io.Reader, signature []byte) error
+	// FileSuffix is added to the key of a signed file to name its signature
+	FileSuffix() string
+}
+
+// IsSignatureFile reports whether key names a detached signature
+func IsSignatureFile(key string) bool {
+	return strings.HasSuffix(key, Ed25519FileSuffix) || strings.HasSuffix(key, OpenPGPFileSuffix)
+}
+
+// NewSigner creates a Signer of keyType, either ed25519 or openpgp, from the private key in privateKeyPath
+func NewSigner(keyType string, privateKeyPath string, passphrase string) (Signer, error) {
+	switch strings.ToLower(keyType) {
+	case "ed25519":
+		return NewEd25519Signer(privateKeyPath)
+	case "openpgp":
+		return NewOpenPGPSigner(privateKeyPath, passphrase)
+	default:
+		return nil, fmt.Errorf("signing key type %q is not ed25519 or openpgp", keyType)
+	}
+}
+
+// NewVerifier creates a Verifier from the Ed25519 or OpenPGP public key in publicKeyPath, telling them apart by the
+// file's contents
+func NewVerifier(publicKeyPath string) (Verifier, error) {
+	content, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	if bytes.Contains(content, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")) {
+		return newOpenPGPVerifier(publicKeyPath, content)
+	}
+	return newEd25519Verifier(publicKeyPath, content)
+}
+
+// Ed25519Signer A Signer using an Ed25519 private key. Signatures are the raw 64 byte Ed25519 signature of the file,
+// which `openssl pkeyutl -verify -rawin` can also check.
+type Ed25519Signer struct {
+	privateKey ed25519.PrivateKey
+}
+
+// NewEd25519Signer creates a Signer from a PEM encoded PKCS #8 Ed25519 private key, such as one made with
+// `openssl genpkey -algorithm ed25519`
+func NewEd25519Signer(privateKeyPath string) (*Ed25519Signer, error) {
+	content, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("signing key %s is not a PEM encoded private key", privateKeyPath)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", privateKeyPath, err)
+	}
+	privateKey, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not an Ed25519 key", privateKeyPath)
+	}
+	return &Ed25519Signer{privateKey: privateKey}, nil
+}
+
+// Sign returns the Ed25519 signature of message, which is read into memory since Ed25519 signs the whole message
+func (s *Ed25519Signer) Sign(message io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(message)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.Sign(s.privateKey, content), nil
+}
+
+// FileSuffix returns the suffix of Ed25519 signature files
+func (s *Ed25519Signer) FileSuffix() string {
+	return Ed25519FileSuffix
+}
+
+// ed25519Verifier A Verifier using an Ed25519 public key
+type ed25519Verifier struct {
+	publicKey ed25519.PublicKey
+}
+
+// newEd25519Verifier creates a Verifier from a PEM encoded PKIX Ed25519 public key
+func newEd25519Verifier(publicKeyPath string, content []byte) (*ed25519Verifier, error) {
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("public key %s is not a PEM encoded public key or an armored OpenPGP public key", publicKeyPath)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %w", publicKeyPath, err)
+	}
+	publicKey, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is not an Ed25519 key", publicKeyPath)
+	}
+	return &ed25519Verifier{publicKey: publicKey}, nil
+}
+
+func (v *ed25519Verifier) Verify(message io.Reader, signature []byte) error {
+	content, err := io.ReadAll(message)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(v.publicKey, content, signature) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+func (v *ed25519Verifier) FileSuffix() string {
+	return Ed25519FileSuffix
+}
+
+// OpenPGPSigner A Signer using an OpenPGP private key. Signatures are armored, so `gpg --verify` can also check them.
+type OpenPGPSigner struct {
+	entity *openpgp.Entity
+}
+
+// NewOpenPGPSigner creates a Signer from an armored OpenPGP private key, such as one exported with
+// `gpg --export-secret-keys --armor`, decrypting it with passphrase if it is protected
+func NewOpenPGPSigner(privateKeyPath string, passphrase string) (*OpenPGPSigner, error) {
+	keyFile, err := os.Open(privateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open signing key: %w", err)
+	}
+	defer func() {
+		_ = keyFile.Close()
+	}()
+	entities, err := openpgp.ReadArmoredKeyRing(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key %s: %w", privateKeyPath, err)
+	}
+	if len(entities) != 1 || entities[0].PrivateKey == nil {
+		return nil, fmt.Errorf("signing key %s must hold exactly one OpenPGP private key", privateKeyPath)
+	}
+	entity := entities[0]
+	if entity.PrivateKey.Encrypted {
+		if passphrase == "" {
+			return nil, fmt.Errorf("signing key %s is protected by a passphrase", privateKeyPath)
+		}
+		if err := entity.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+			return nil, fmt.Errorf("failed to unlock signing key %s: %w", privateKeyPath, err)
+		}
+	}
+	return &OpenPGPSigner{entity: entity}, nil
+}
+
+// Sign returns an armored detached OpenPGP signature of message
+func (s *OpenPGPSigner) Sign(message io.Reader) ([]byte, error) {
+	var signature bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&signature, s.entity, message, nil); err != nil {
+		return nil, err
+	}
+	return signature.Bytes(), nil
+}
+
+// FileSuffix returns the suffix of OpenPGP signature files
+func (s *OpenPGPSigner) FileSuffix() string {
+	return OpenPGPFileSuffix
+}
+
+// openPGPVerifier A Verifier using the keys in an OpenPGP public key ring
+type openPGPVerifier struct {
+	keyRing openpgp.EntityList
+}
+
+// newOpenPGPVerifier creates a Verifier from an armored OpenPGP public key
+func newOpenPGPVerifier(publicKeyPath string, content []byte) (*openPGPVerifier, error) {
+	keyRing, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key %s: %w", publicKeyPath, err)
+	}
+	return &openPGPVerifier{keyRing: keyRing}, nil
+}
+
+func (v *openPGPVerifier) Verify(message io.Reader, signature []byte) error {
+	if _, err := armor.Decode(bytes.NewReader(signature)); err != nil {
+		return fmt.Errorf("signature is not an armored OpenPGP signature: %w", err)
+	}
+	if _, err := openpgp.CheckArmoredDetachedSignature(v.keyRing, message, bytes.NewReader(signature), nil); err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	return nil
+}
+
+func (v *openPGPVerifier) FileSuffix() string {
+	return OpenPGPFileSuffix
+}
+
+// Failure A file whose signature could not be verified
+type Failure struct {
+	Key string
+	Err error
+}
+
+// Report The outcome of checking every signature in a backend
+type Report struct {
+	Verified []string  // Files that match their signature
+	Failed   []Failure // Files that don't match their signature, and signatures whose file is missing
+	Unsigned []string  // Records without a signature, such as those archived before signing was turned on
+}
+
+// VerifyFile checks the file stored under key against its detached signature
+func VerifyFile(ctx context.Context, backend storage.Backend, verifier Verifier, key string) error {
+	signature, err := storage.ReadAll(ctx, backend, key+verifier.FileSuffix())
+	if errors.Is(err, storage.ErrNotExist) {
+		return fmt.Errorf("%s has no signature", backend.Location(key))
+	}
+	if err != nil {
+		return err
+	}
+	signed, err := backend.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := signed.Close(); err != nil {
+			log.Printf("Warning: failed to close %s: %v", backend.Location(key), err)
+		}
+	}()
+	return verifier.Verify(signed, signature)
+}
+
+// VerifyAll checks every signature stored in backend against the file it signs. Records, as reported by isRecord,
+// that have no signature are listed as unsigned.
+func VerifyAll(ctx context.Context, backend storage.Backend, verifier Verifier, isRecord func(key string) bool) (Report, error) {
+	objects, err := backend.List(ctx, "")
+	if err != nil {
+		return Report{}, err
+	}
+	stored := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		stored[object.Key] = true
+	}
+
+	var report Report
+	for _, object := range objects {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		signed, isSignature := strings.CutSuffix(object.Key, verifier.FileSuffix())
+		switch {
+		case isSignature && !stored[signed]:
+			report.Failed = append(report.Failed, Failure{Key: signed, Err: fmt.Errorf("the signed file is missing")})
+		case isSignature:
+			if err := VerifyFile(ctx, backend, verifier, signed); err != nil {
+				report.Failed = append(report.Failed, Failure{Key: signed, Err: err})
+				continue
+			}
+			report.Verified = append(report.Verified, signed)
+		case isRecord(object.Key) && !stored[object.Key+verifier.FileSuffix()]:
+			report.Unsigned = append(report.Unsigned, object.Key)
+		}
+	}
+	sort.Slice(report.Failed, func(i, j int) bool { return report.Failed[i].Key < report.Failed[j].Key })
+	sort.Strings(report.Verified)
+	return report, nil
+}
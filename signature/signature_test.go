@@ -0,0 +1,236 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package signature
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/route1337/fastbound-downloader/storage"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestEd25519Keys writes a fresh Ed25519 key pair as PEM files and returns their paths
+func writeTestEd25519Keys(t *testing.T) (string, string) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate a signing key: %v", err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to encode the signing key: %v", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("Failed to encode the public key: %v", err)
+	}
+	return writeTestKeys(t, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+}
+
+// writeTestOpenPGPKeys writes a fresh armored OpenPGP key pair, protecting the private key with passphrase if it is
+// not blank, and returns their paths
+func writeTestOpenPGPKeys(t *testing.T, passphrase string) (string, string) {
+	entity, err := openpgp.NewEntity("Peter Gibbons", "", "pgibbons@initech.com", nil)
+	if err != nil {
+		t.Fatalf("Failed to generate a signing key: %v", err)
+	}
+	var public bytes.Buffer
+	publicArmor, err := armor.Encode(&public, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("Failed to armor the public key: %v", err)
+	}
+	if err := entity.Serialize(publicArmor); err != nil {
+		t.Fatalf("Failed to encode the public key: %v", err)
+	}
+	if err := publicArmor.Close(); err != nil {
+		t.Fatalf("Failed to armor the public key: %v", err)
+	}
+
+	var private bytes.Buffer
+	privateArmor, err := armor.Encode(&private, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatalf("Failed to armor the signing key: %v", err)
+	}
+	if passphrase != "" {
+		if err := entity.EncryptPrivateKeys([]byte(passphrase), nil); err != nil {
+			t.Fatalf("Failed to protect the signing key: %v", err)
+		}
+	}
+	if err := entity.SerializePrivateWithoutSigning(privateArmor, nil); err != nil {
+		t.Fatalf("Failed to encode the signing key: %v", err)
+	}
+	if err := privateArmor.Close(); err != nil {
+		t.Fatalf("Failed to armor the signing key: %v", err)
+	}
+	return writeTestKeys(t, private.Bytes(), public.Bytes())
+}
+
+// writeTestKeys writes a private and public key to files and returns their paths
+func writeTestKeys(t *testing.T, privateKey []byte, publicKey []byte) (string, string) {
+	keyDir := t.TempDir()
+	privateKeyPath, publicKeyPath := filepath.Join(keyDir, "signing.key"), filepath.Join(keyDir, "signing.pub")
+	if err := os.WriteFile(privateKeyPath, privateKey, 0400); err != nil {
+		t.Fatalf("Failed to write the signing key: %v", err)
+	}
+	if err := os.WriteFile(publicKeyPath, publicKey, 0400); err != nil {
+		t.Fatalf("Failed to write the public key: %v", err)
+	}
+	return privateKeyPath, publicKeyPath
+}
+
+// TestSigners validates that each kind of key signs files that verify against its public key and nothing else
+func TestSigners(t *testing.T) {
+	ed25519Private, ed25519Public := writeTestEd25519Keys(t)
+	openPGPPrivate, openPGPPublic := writeTestOpenPGPKeys(t, "")
+	protectedPrivate, protectedPublic := writeTestOpenPGPKeys(t, "TPS reports")
+	tests := map[string]struct {
+		keyType    string
+		privateKey string
+		passphrase string
+		publicKey  string
+		suffix     string
+	}{
+		"Ed25519":            {"ed25519", ed25519Private, "", ed25519Public, Ed25519FileSuffix},
+		"OpenPGP":            {"openpgp", openPGPPrivate, "", openPGPPublic, OpenPGPFileSuffix},
+		"OpenPGP passphrase": {"OpenPGP", protectedPrivate, "TPS reports", protectedPublic, OpenPGPFileSuffix},
+	}
+	book := []byte("Guns. Lots of guns.")
+	for name, test := range tests {
+		signer, err := NewSigner(test.keyType, test.privateKey, test.passphrase)
+		if err != nil {
+			t.Fatalf("%s: NewSigner() returned an unexpected error: %v", name, err)
+		}
+		verifier, err := NewVerifier(test.publicKey)
+		if err != nil {
+			t.Fatalf("%s: NewVerifier() returned an unexpected error: %v", name, err)
+		}
+		if signer.FileSuffix() != test.suffix || verifier.FileSuffix() != test.suffix {
+			t.Errorf("%s: expected signatures to end in %s, but got %s and %s", name, test.suffix, signer.FileSuffix(), verifier.FileSuffix())
+		}
+		signed, err := signer.Sign(bytes.NewReader(book))
+		if err != nil {
+			t.Fatalf("%s: Sign() returned an unexpected error: %v", name, err)
+		}
+		if err := verifier.Verify(bytes.NewReader(book), signed); err != nil {
+			t.Errorf("%s: expected the signature to verify, but got %v", name, err)
+		}
+		if err := verifier.Verify(strings.NewReader("Guns. Lots of guns!"), signed); !errors.Is(err, ErrBadSignature) {
+			t.Errorf("%s: expected an altered file to be refused, but got %v", name, err)
+		}
+	}
+
+	// A signature made by another key of the same kind is refused
+	otherPrivate, _ := writeTestEd25519Keys(t)
+	other, err := NewSigner("ed25519", otherPrivate, "")
+	if err != nil {
+		t.Fatalf("NewSigner() returned an unexpected error: %v", err)
+	}
+	otherSigned, err := other.Sign(bytes.NewReader(book))
+	if err != nil {
+		t.Fatalf("Sign() returned an unexpected error: %v", err)
+	}
+	verifier, err := NewVerifier(ed25519Public)
+	if err != nil {
+		t.Fatalf("NewVerifier() returned an unexpected error: %v", err)
+	}
+	if err := verifier.Verify(bytes.NewReader(book), otherSigned); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected a signature by another key to be refused, but got %v", err)
+	}
+}
+
+// TestNewSigner_Invalid validates that unusable keys are refused
+func TestNewSigner_Invalid(t *testing.T) {
+	ed25519Private, ed25519Public := writeTestEd25519Keys(t)
+	protectedPrivate, _ := writeTestOpenPGPKeys(t, "TPS reports")
+	tests := map[string]struct {
+		keyType    string
+		privateKey string
+		passphrase string
+	}{
+		"Unknown type":       {"rsa", ed25519Private, ""},
+		"Missing key":        {"ed25519", filepath.Join(t.TempDir(), "missing.key"), ""},
+		"Public key":         {"ed25519", ed25519Public, ""},
+		"Wrong type":         {"openpgp", ed25519Private, ""},
+		"Missing passphrase": {"openpgp", protectedPrivate, ""},
+		"Wrong passphrase":   {"openpgp", protectedPrivate, "Flair"},
+	}
+	for name, test := range tests {
+		if _, err := NewSigner(test.keyType, test.privateKey, test.passphrase); err == nil {
+			t.Errorf("Expected %s to be refused", name)
+		}
+	}
+	if _, err := NewVerifier(ed25519Private); err == nil {
+		t.Errorf("Expected a private key to be refused as a public key")
+	}
+}
+
+// TestVerifyAll validates that every signature in a backend is checked and unsigned records are listed
+func TestVerifyAll(t *testing.T) {
+	ctx := context.Background()
+	privateKey, publicKey := writeTestEd25519Keys(t)
+	signer, err := NewSigner("ed25519", privateKey, "")
+	if err != nil {
+		t.Fatalf("NewSigner() returned an unexpected error: %v", err)
+	}
+	verifier, err := NewVerifier(publicKey)
+	if err != nil {
+		t.Fatalf("NewVerifier() returned an unexpected error: %v", err)
+	}
+	backend := storage.NewLocal(t.TempDir())
+	put := func(key string, content string) {
+		if err := backend.Put(ctx, key, strings.NewReader(content), -1); err != nil {
+			t.Fatalf("Put() returned an unexpected error: %v", err)
+		}
+	}
+	sign := func(key string, content string) {
+		signed, err := signer.Sign(strings.NewReader(content))
+		if err != nil {
+			t.Fatalf("Sign() returned an unexpected error: %v", err)
+		}
+		put(key+Ed25519FileSuffix, string(signed))
+	}
+
+	put("2025/GOOD.pdf", "Guns.")
+	sign("2025/GOOD.pdf", "Guns.")
+	put("2025/ALTERED.pdf", "Guns!")
+	sign("2025/ALTERED.pdf", "Guns.")
+	sign("2025/MISSING.pdf", "Guns.")
+	put("2024/OLD.pdf", "Old guns.")
+	put("manifest.jsonl", "{}\n")
+
+	isRecord := func(key string) bool { return strings.HasSuffix(key, ".pdf") }
+	report, err := VerifyAll(ctx, backend, verifier, isRecord)
+	if err != nil {
+		t.Fatalf("VerifyAll() returned an unexpected error: %v", err)
+	}
+	if strings.Join(report.Verified, ",") != "2025/GOOD.pdf" {
+		t.Errorf("Verified = %v", report.Verified)
+	}
+	if strings.Join(report.Unsigned, ",") != "2024/OLD.pdf" {
+		t.Errorf("Unsigned = %v", report.Unsigned)
+	}
+	if len(report.Failed) != 2 || report.Failed[0].Key != "2025/ALTERED.pdf" || !errors.Is(report.Failed[0].Err, ErrBadSignature) ||
+		report.Failed[1].Key != "2025/MISSING.pdf" {
+		t.Errorf("Failed = %+v", report.Failed)
+	}
+
+	if err := VerifyFile(ctx, backend, verifier, "2025/GOOD.pdf"); err != nil {
+		t.Errorf("VerifyFile() returned an unexpected error: %v", err)
+	}
+	if err := VerifyFile(ctx, backend, verifier, "2024/OLD.pdf"); err == nil || !strings.Contains(err.Error(), "no signature") {
+		t.Errorf("Expected an unsigned file to be reported, but got %v", err)
+	}
+}
@@ -0,0 +1,362 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// DefaultAzureBlockSize is the size of each block of a large upload unless overridden in AzureConfig
+const DefaultAzureBlockSize = 16 * 1024 * 1024
+
+// maximumAzureBlockSize is the largest block Azure accepts
+const maximumAzureBlockSize = 4000 * 1024 * 1024
+
+// AzureConfig Where and how to connect to an Azure Blob Storage container
+type AzureConfig struct {
+	ServiceURL       string // Blob service URL. Defaults to https://<AccountName>.blob.core.windows.net.
+	AccountName      string
+	AccountKey       string // Shared key to sign requests with
+	SASToken         string // Shared access signature to use instead of a shared key
+	Container        string
+	Prefix           string // Prepended to every blob name, for sharing a container
+	BlockSize        int64  // Size of each block when uploading large files in several blocks
+	ImmutabilityMode string // Blank, "unlocked" or "locked" to apply a version-level immutability policy to archived records
+	RetentionPeriod  time.Duration
+	LegalHold        bool // Place a legal hold on archived records
+}
+
+// Azure A Backend that stores objects as block blobs in an Azure Blob Storage container
+type Azure struct {
+	client       *container.Client
+	location     string // Container URL without any credentials, for logs and errors
+	prefix       string
+	blockSize    int64
+	immutability blob.ImmutabilityPolicySetting
+	retention    time.Duration
+	legalHold    bool
+}
+
+// NewAzure creates a Backend storing objects in an Azure Blob Storage container. It does not contact Azure.
+func NewAzure(config AzureConfig) (*Azure, error) {
+	if config.Container == "" {
+		return nil, fmt.Errorf("azure container is blank")
+	}
+	serviceURL := strings.TrimSuffix(config.ServiceURL, "/")
+	if serviceURL == "" {
+		if config.AccountName == "" {
+			return nil, fmt.Errorf("azure needs an account name or a service url")
+		}
+		serviceURL = "https://" + config.AccountName + ".blob.core.windows.net"
+	}
+	parsed, err := url.Parse(serviceURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid azure service url %q", config.ServiceURL)
+	}
+	if parsed.RawQuery != "" {
+		return nil, fmt.Errorf("invalid azure service url %q: use sas-token rather than a query string", config.ServiceURL)
+	}
+	containerURL := serviceURL + "/" + url.PathEscape(config.Container)
+
+	backend := &Azure{
+		location:  containerURL,
+		prefix:    strings.Trim(config.Prefix, "/"),
+		blockSize: config.BlockSize,
+		retention: config.RetentionPeriod,
+		legalHold: config.LegalHold,
+	}
+	switch {
+	case config.AccountKey != "" && config.SASToken != "":
+		return nil, fmt.Errorf("azure can sign requests with a shared key or a sas token, not both")
+	case config.AccountKey != "":
+		if config.AccountName == "" {
+			return nil, fmt.Errorf("azure shared key needs an account name")
+		}
+		credential, err := container.NewSharedKeyCredential(config.AccountName, config.AccountKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid azure shared key: %w", err)
+		}
+		backend.client, err = container.NewClientWithSharedKeyCredential(containerURL, credential, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create azure client for %s: %w", containerURL, err)
+		}
+	case config.SASToken != "":
+		backend.client, err = container.NewClientWithNoCredential(containerURL+"?"+strings.TrimPrefix(config.SASToken, "?"), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create azure client for %s: %w", containerURL, err)
+		}
+	default:
+		return nil, fmt.Errorf("azure needs a shared key or a sas token")
+	}
+
+	if backend.blockSize == 0 {
+		backend.blockSize = DefaultAzureBlockSize
+	}
+	if backend.blockSize < 0 || backend.blockSize > maximumAzureBlockSize {
+		return nil, fmt.Errorf("azure block size must be at most %d bytes", maximumAzureBlockSize)
+	}
+	switch strings.ToLower(config.ImmutabilityMode) {
+	case "":
+	case "unlocked":
+		backend.immutability = blob.ImmutabilityPolicySettingUnlocked
+	case "locked":
+		backend.immutability = blob.ImmutabilityPolicySettingLocked
+	default:
+		return nil, fmt.Errorf("unknown azure immutability mode %q, expected unlocked or locked", config.ImmutabilityMode)
+	}
+	if backend.immutability != "" && config.RetentionPeriod <= 0 {
+		return nil, fmt.Errorf("azure immutability mode %s needs a retention period", config.ImmutabilityMode)
+	}
+	return backend, nil
+}
+
+// Location returns the URL of the blob for key
+func (a *Azure) Location(key string) string {
+	return a.location + "/" + path.Join(a.prefix, key)
+}
+
+// blobName returns the name of the blob for key after checking it is valid
+func (a *Azure) blobName(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(a.prefix, cleaned), nil
+}
+
+// Put uploads r, in blocks for files larger than the block size. Azure only makes a blob visible once its blocks are committed.
+func (a *Azure) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	return a.upload(ctx, key, r, size, false)
+}
+
+// PutRetained uploads r like Put and applies the configured immutability policy and legal hold to the new version
+func (a *Azure) PutRetained(ctx context.Context, key string, r io.Reader, size int64) error {
+	return a.upload(ctx, key, r, size, true)
+}
+
+// upload stores r under key, in a single request when it fits in one block and otherwise as a list of blocks
+func (a *Azure) upload(ctx context.Context, key string, r io.Reader, size int64, retained bool) error {
+	blobName, err := a.blobName(key)
+	if err != nil {
+		return err
+	}
+	client := a.client.NewBlockBlobClient(blobName)
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	headers := &blob.HTTPHeaders{BlobContentType: &contentType}
+	var immutability *blob.ImmutabilityPolicySetting
+	var retainUntil *time.Time
+	var legalHold *bool
+	if retained && a.immutability != "" {
+		until := time.Now().Add(a.retention).UTC()
+		immutability, retainUntil = &a.immutability, &until
+	}
+	if retained && a.legalHold {
+		legalHold = &a.legalHold
+	}
+
+	// Small files such as sidecars don't need a whole block of memory
+	firstBlockSize := a.blockSize
+	if size >= 0 && size < firstBlockSize {
+		firstBlockSize = size + 1
+	}
+	block, err := readBlock(r, firstBlockSize)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", a.Location(key), err)
+	}
+	if int64(len(block)) < firstBlockSize {
+		if size >= 0 && int64(len(block)) != size {
+			return fmt.Errorf("failed to upload %s: expected %d bytes but read %d", a.Location(key), size, len(block))
+		}
+		_, err := client.Upload(ctx, streaming.NopCloser(bytes.NewReader(block)), &blockblob.UploadOptions{
+			HTTPHeaders:                  headers,
+			ImmutabilityPolicyMode:       immutability,
+			ImmutabilityPolicyExpiryTime: retainUntil,
+			LegalHold:                    legalHold,
+		})
+		if err != nil {
+			return a.wrapErr("upload", key, err)
+		}
+		return nil
+	}
+
+	// Name this upload's blocks uniquely so a concurrent upload of the same blob can't mix its blocks in
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return fmt.Errorf("failed to name the blocks of %s: %w", a.Location(key), err)
+	}
+	var blockIDs []string
+	var uploaded int64
+	for len(block) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		blockID := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%s-%08d", hex.EncodeToString(random), len(blockIDs))))
+		if _, err := client.StageBlock(ctx, blockID, streaming.NopCloser(bytes.NewReader(block)), nil); err != nil {
+			return a.wrapErr("upload a block of", key, err)
+		}
+		blockIDs = append(blockIDs, blockID)
+		uploaded += int64(len(block))
+		if block, err = readBlock(r, a.blockSize); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", a.Location(key), err)
+		}
+	}
+	if size >= 0 && uploaded != size {
+		return fmt.Errorf("failed to upload %s: expected %d bytes but read %d", a.Location(key), size, uploaded)
+	}
+	_, err = client.CommitBlockList(ctx, blockIDs, &blockblob.CommitBlockListOptions{
+		HTTPHeaders:                  headers,
+		ImmutabilityPolicyMode:       immutability,
+		ImmutabilityPolicyExpiryTime: retainUntil,
+		LegalHold:                    legalHold,
+	})
+	if err != nil {
+		return a.wrapErr("commit the blocks of", key, err)
+	}
+	return nil
+}
+
+// readBlock reads up to blockSize bytes from r, returning fewer only at the end of r
+func readBlock(r io.Reader, blockSize int64) ([]byte, error) {
+	block := make([]byte, blockSize)
+	n, err := io.ReadFull(r, block)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+	return block[:n], err
+}
+
+// Check confirms the container exists and, when immutability policies or legal holds are configured, that it supports
+// version-level immutability. Blobs in a container without it can't be given their own policy.
+func (a *Azure) Check(ctx context.Context) error {
+	properties, err := a.client.GetProperties(ctx, nil)
+	if bloberror.HasCode(err, bloberror.ContainerNotFound) {
+		return fmt.Errorf("azure container %s does not exist", a.location)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check azure container %s: %w", a.location, err)
+	}
+	if a.immutability == "" && !a.legalHold {
+		return nil
+	}
+	if properties.IsImmutableStorageWithVersioningEnabled == nil || !*properties.IsImmutableStorageWithVersioningEnabled {
+		return fmt.Errorf("azure container %s does not have version-level immutability enabled", a.location)
+	}
+	return nil
+}
+
+// Stat describes the blob for key
+func (a *Azure) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	blobName, err := a.blobName(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	properties, err := a.client.NewBlobClient(blobName).GetProperties(ctx, nil)
+	if err != nil {
+		return ObjectInfo{}, a.wrapErr("stat", key, err)
+	}
+	info := ObjectInfo{Key: key}
+	if properties.ContentLength != nil {
+		info.Size = *properties.ContentLength
+	}
+	if properties.LastModified != nil {
+		info.ModTime = *properties.LastModified
+	}
+	return info, nil
+}
+
+// List describes every blob in the container under the configured prefix whose key starts with prefix
+func (a *Azure) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	listPrefix := prefix
+	if a.prefix != "" {
+		listPrefix = a.prefix + "/" + prefix
+	}
+	var objects []ObjectInfo
+	pager := a.client.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: &listPrefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", a.Location(prefix), err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item.Name == nil {
+				continue
+			}
+			key := *item.Name
+			if a.prefix != "" {
+				key = strings.TrimPrefix(key, a.prefix+"/")
+			}
+			info := ObjectInfo{Key: key}
+			if item.Properties != nil && item.Properties.ContentLength != nil {
+				info.Size = *item.Properties.ContentLength
+			}
+			if item.Properties != nil && item.Properties.LastModified != nil {
+				info.ModTime = *item.Properties.LastModified
+			}
+			objects = append(objects, info)
+		}
+	}
+	return objects, nil
+}
+
+// Get downloads the blob for key
+func (a *Azure) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	blobName, err := a.blobName(key)
+	if err != nil {
+		return nil, err
+	}
+	response, err := a.client.NewBlobClient(blobName).DownloadStream(ctx, nil)
+	if err != nil {
+		return nil, a.wrapErr("download", key, err)
+	}
+	return response.Body, nil
+}
+
+// Delete removes the blob for key
+func (a *Azure) Delete(ctx context.Context, key string) error {
+	blobName, err := a.blobName(key)
+	if err != nil {
+		return err
+	}
+	if _, err := a.client.NewBlobClient(blobName).Delete(ctx, nil); err != nil {
+		if err = a.wrapErr("delete", key, err); !errors.Is(err, ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// wrapErr describes a failed request, marking missing blobs with ErrNotExist
+func (a *Azure) wrapErr(action string, key string, err error) error {
+	var responseError *azcore.ResponseError
+	if bloberror.HasCode(err, bloberror.BlobNotFound) ||
+		(errors.As(err, &responseError) && responseError.StatusCode == http.StatusNotFound && responseError.ErrorCode != string(bloberror.ContainerNotFound)) {
+		return fmt.Errorf("failed to %s %s: %w", action, a.Location(key), ErrNotExist)
+	}
+	return fmt.Errorf("failed to %s %s: %w", action, a.Location(key), err)
+}
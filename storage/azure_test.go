@@ -0,0 +1,425 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Azurite's well known development account, see https://learn.microsoft.com/azure/storage/common/storage-use-azurite
+const (
+	azuriteAccountName = "devstoreaccount1"
+	azuriteAccountKey  = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+// azureMockBlob A blob stored by the mock Azure server
+type azureMockBlob struct {
+	data    []byte
+	modTime time.Time
+}
+
+// azureMockServer A minimal in-memory Azure Blob service with one "books" container, for when Azurite is not available.
+// It does not check signatures.
+type azureMockServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	immutable bool
+	blobs     map[string]azureMockBlob
+	blocks    map[string][]byte
+	requests  []*http.Request
+}
+
+// newAzureMockServer starts a mock Azure Blob service. immutable sets whether its container reports version-level immutability.
+func newAzureMockServer(t *testing.T, immutable bool) *azureMockServer {
+	mock := &azureMockServer{immutable: immutable, blobs: make(map[string]azureMockBlob), blocks: make(map[string][]byte)}
+	mock.Server = httptest.NewServer(http.HandlerFunc(mock.serveHTTP))
+	t.Cleanup(mock.Close)
+	return mock
+}
+
+// azureError answers a request with an Azure style error
+func azureError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("x-ms-error-code", code)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+}
+
+func (m *azureMockServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, r)
+	query := r.URL.Query()
+	containerPath := "/" + azuriteAccountName + "/books"
+	if r.URL.Path != containerPath && !strings.HasPrefix(r.URL.Path, containerPath+"/") {
+		azureError(w, http.StatusNotFound, "ContainerNotFound")
+		return
+	}
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, containerPath), "/")
+
+	switch {
+	case name == "" && query.Get("comp") == "list":
+		m.listBlobs(w, query.Get("prefix"))
+	case name == "":
+		w.Header().Set("x-ms-immutable-storage-with-versioning-enabled", fmt.Sprint(m.immutable))
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPut && query.Get("comp") == "block":
+		data, _ := io.ReadAll(r.Body)
+		m.blocks[name+"/"+query.Get("blockid")] = data
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut && query.Get("comp") == "blocklist":
+		var blockList struct {
+			Latest []string `xml:"Latest"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&blockList); err != nil {
+			azureError(w, http.StatusBadRequest, "InvalidXmlDocument")
+			return
+		}
+		var data []byte
+		for _, blockID := range blockList.Latest {
+			block, ok := m.blocks[name+"/"+blockID]
+			if !ok {
+				azureError(w, http.StatusBadRequest, "InvalidBlockList")
+				return
+			}
+			data = append(data, block...)
+		}
+		m.blobs[name] = azureMockBlob{data: data, modTime: time.Now()}
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		m.blobs[name] = azureMockBlob{data: data, modTime: time.Now()}
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodHead || r.Method == http.MethodGet:
+		stored, ok := m.blobs[name]
+		if !ok {
+			azureError(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(stored.data)))
+		w.Header().Set("Last-Modified", stored.modTime.UTC().Format(http.TimeFormat))
+		w.Header().Set("x-ms-blob-type", "BlockBlob")
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(stored.data)
+		}
+	case r.Method == http.MethodDelete:
+		if _, ok := m.blobs[name]; !ok {
+			azureError(w, http.StatusNotFound, "BlobNotFound")
+			return
+		}
+		delete(m.blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		azureError(w, http.StatusBadRequest, "UnsupportedHttpVerb")
+	}
+}
+
+// listBlobs answers a List Blobs request for every blob whose name starts with prefix
+func (m *azureMockServer) listBlobs(w http.ResponseWriter, prefix string) {
+	type blobProperties struct {
+		LastModified  string `xml:"Last-Modified"`
+		ContentLength int    `xml:"Content-Length"`
+		BlobType      string `xml:"BlobType"`
+	}
+	type blobItem struct {
+		Name       string         `xml:"Name"`
+		Properties blobProperties `xml:"Properties"`
+	}
+	var names []string
+	for name := range m.blobs {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	result := struct {
+		XMLName    xml.Name   `xml:"EnumerationResults"`
+		Prefix     string     `xml:"Prefix"`
+		Blobs      []blobItem `xml:"Blobs>Blob"`
+		NextMarker string     `xml:"NextMarker"`
+	}{Prefix: prefix}
+	for _, name := range names {
+		result.Blobs = append(result.Blobs, blobItem{Name: name, Properties: blobProperties{
+			LastModified:  m.blobs[name].modTime.UTC().Format(http.TimeFormat),
+			ContentLength: len(m.blobs[name].data),
+			BlobType:      "BlockBlob",
+		}})
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(xml.Header))
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+// uploads returns every request that created a blob, in order
+func (m *azureMockServer) uploads() []*http.Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var uploads []*http.Request
+	for _, request := range m.requests {
+		if request.Method == http.MethodPut && (request.URL.Query().Get("comp") == "" || request.URL.Query().Get("comp") == "blocklist") {
+			uploads = append(uploads, request)
+		}
+	}
+	return uploads
+}
+
+// newTestAzure creates an Azure backend with extra settings from config. It uses the Azurite emulator when
+// AZURITE_BLOB_ENDPOINT is set, such as to http://127.0.0.1:10000/devstoreaccount1, and the mock server otherwise.
+// It returns the mock server, or nil when using Azurite.
+func newTestAzure(t *testing.T, config AzureConfig) (*Azure, *azureMockServer) {
+	var mock *azureMockServer
+	config.AccountName = azuriteAccountName
+	config.AccountKey = azuriteAccountKey
+	config.Container = "books"
+	if endpoint := os.Getenv("AZURITE_BLOB_ENDPOINT"); endpoint != "" {
+		config.ServiceURL = endpoint
+		config.Container = fmt.Sprintf("books-%d", time.Now().UnixNano())
+	} else {
+		mock = newAzureMockServer(t, false)
+		config.ServiceURL = mock.URL + "/" + azuriteAccountName
+	}
+	backend, err := NewAzure(config)
+	if err != nil {
+		t.Fatalf("NewAzure() returned an unexpected error: %v", err)
+	}
+	if mock == nil {
+		if _, err := backend.client.Create(context.Background(), nil); err != nil {
+			t.Fatalf("Failed to create Azurite container: %v", err)
+		}
+		t.Cleanup(func() { _, _ = backend.client.Delete(context.Background(), &container.DeleteOptions{}) })
+	}
+	return backend, mock
+}
+
+// TestAzure validates storing, describing, listing, reading and deleting blobs in a container
+func TestAzure(t *testing.T) {
+	ctx := context.Background()
+	backend, _ := newTestAzure(t, AzureConfig{Prefix: "/archive/"})
+
+	if err := backend.Check(ctx); err != nil {
+		t.Fatalf("Check() returned an unexpected error: %v", err)
+	}
+	content := "Guns. Lots of guns."
+	for _, key := range []string{"2025/01/BOOK_1.pdf", "2025/02/BOOK_2.pdf", "4473.pdf"} {
+		if err := backend.Put(ctx, key, strings.NewReader(content), int64(len(content))); err != nil {
+			t.Fatalf("Put(%s) returned an unexpected error: %v", key, err)
+		}
+	}
+
+	info, err := backend.Stat(ctx, "2025/01/BOOK_1.pdf")
+	if err != nil || info.Size != int64(len(content)) || info.ModTime.IsZero() {
+		t.Errorf("Stat() = %+v, %v", info, err)
+	}
+	if _, err := backend.Stat(ctx, "MISSING.pdf"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Expected a missing blob to be reported as missing, but got %v", err)
+	}
+
+	objects, err := backend.List(ctx, "2025/")
+	if err != nil {
+		t.Fatalf("List() returned an unexpected error: %v", err)
+	}
+	if len(objects) != 2 || objects[0].Key != "2025/01/BOOK_1.pdf" || objects[1].Key != "2025/02/BOOK_2.pdf" {
+		t.Errorf("List() = %+v", objects)
+	}
+
+	reader, err := backend.Get(ctx, "2025/02/BOOK_2.pdf")
+	if err != nil {
+		t.Fatalf("Get() returned an unexpected error: %v", err)
+	}
+	read, _ := io.ReadAll(reader)
+	_ = reader.Close()
+	if string(read) != content {
+		t.Errorf("Get() read %q", read)
+	}
+	if _, err := backend.Get(ctx, "MISSING.pdf"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Expected a missing blob to be reported as missing, but got %v", err)
+	}
+
+	if err := Append(ctx, backend, "manifest.jsonl", []byte("one\n")); err != nil {
+		t.Fatalf("Append() returned an unexpected error: %v", err)
+	}
+	if err := Append(ctx, backend, "manifest.jsonl", []byte("two\n")); err != nil {
+		t.Fatalf("Append() returned an unexpected error: %v", err)
+	}
+	if manifest, err := ReadAll(ctx, backend, "manifest.jsonl"); err != nil || string(manifest) != "one\ntwo\n" {
+		t.Errorf("Expected both appended lines, but got %q (%v)", manifest, err)
+	}
+
+	if err := backend.Delete(ctx, "4473.pdf"); err != nil {
+		t.Errorf("Delete() returned an unexpected error: %v", err)
+	}
+	if err := backend.Delete(ctx, "4473.pdf"); err != nil {
+		t.Errorf("Expected deleting a missing blob to succeed, but got %v", err)
+	}
+	if _, err := backend.Stat(ctx, "../escape.pdf"); err == nil {
+		t.Errorf("Expected a key outside the prefix to be refused")
+	}
+	if location := backend.Location("4473.pdf"); !strings.HasSuffix(location, "/archive/4473.pdf") || !strings.HasPrefix(location, "http") {
+		t.Errorf("Location() = %q", location)
+	}
+}
+
+// TestAzurePut_Blocks validates that files larger than a block are uploaded in blocks, whether or not their size is known
+func TestAzurePut_Blocks(t *testing.T) {
+	ctx := context.Background()
+	backend, mock := newTestAzure(t, AzureConfig{BlockSize: 16})
+	content := strings.Repeat("Guns. Lots of guns. ", 3)
+	for _, size := range []int64{int64(len(content)), -1} {
+		if err := backend.Put(ctx, "BOOK.pdf", strings.NewReader(content), size); err != nil {
+			t.Fatalf("Put() with size %d returned an unexpected error: %v", size, err)
+		}
+		stored, err := ReadAll(ctx, backend, "BOOK.pdf")
+		if err != nil || string(stored) != content {
+			t.Errorf("Expected the blocks to be committed in order, but got %q (%v)", stored, err)
+		}
+	}
+	if mock != nil {
+		for _, upload := range mock.uploads() {
+			if upload.URL.Query().Get("comp") != "blocklist" {
+				t.Errorf("Expected a block list upload, but got %s", upload.URL.RequestURI())
+			}
+		}
+	}
+	if err := backend.Put(ctx, "SHORT.pdf", strings.NewReader(content), 1000); err == nil {
+		t.Errorf("Expected Put() to fail when the size does not match")
+	}
+	if _, err := backend.Stat(ctx, "SHORT.pdf"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Expected a failed upload to leave nothing behind, but got %v", err)
+	}
+}
+
+// TestAzurePutRetained validates that records get the configured immutability policy and legal hold, and other files do not
+func TestAzurePutRetained(t *testing.T) {
+	mock := newAzureMockServer(t, true)
+	backend, err := NewAzure(AzureConfig{
+		ServiceURL:       mock.URL + "/" + azuriteAccountName,
+		AccountName:      azuriteAccountName,
+		AccountKey:       azuriteAccountKey,
+		Container:        "books",
+		BlockSize:        16,
+		ImmutabilityMode: "locked",
+		RetentionPeriod:  30 * 24 * time.Hour,
+		LegalHold:        true,
+	})
+	if err != nil {
+		t.Fatalf("NewAzure() returned an unexpected error: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := backend.Check(ctx); err != nil {
+		t.Fatalf("Check() returned an unexpected error: %v", err)
+	}
+	if err := backend.PutRetained(ctx, "SMALL.pdf", strings.NewReader("Guns."), 5); err != nil {
+		t.Fatalf("PutRetained() returned an unexpected error: %v", err)
+	}
+	if err := PutRecord(ctx, backend, "LARGE.pdf", strings.NewReader(strings.Repeat("Guns. ", 10)), 60); err != nil {
+		t.Fatalf("PutRecord() returned an unexpected error: %v", err)
+	}
+	if err := backend.Put(ctx, "manifest.jsonl", strings.NewReader("{}\n"), 3); err != nil {
+		t.Fatalf("Put() returned an unexpected error: %v", err)
+	}
+
+	uploads := mock.uploads()
+	if len(uploads) != 3 {
+		t.Fatalf("Expected 3 uploads, but got %d", len(uploads))
+	}
+	for _, upload := range uploads[:2] {
+		until, err := time.Parse(time.RFC1123, upload.Header.Get("x-ms-immutability-policy-until-date"))
+		if upload.Header.Get("x-ms-immutability-policy-mode") != "Locked" || err != nil || time.Until(until) < 29*24*time.Hour {
+			t.Errorf("Expected %s to be locked for 30 days, but got %q until %q", upload.URL.Path,
+				upload.Header.Get("x-ms-immutability-policy-mode"), upload.Header.Get("x-ms-immutability-policy-until-date"))
+		}
+		if upload.Header.Get("x-ms-legal-hold") != "true" {
+			t.Errorf("Expected %s to have a legal hold", upload.URL.Path)
+		}
+	}
+	if uploads[2].Header.Get("x-ms-immutability-policy-mode") != "" || uploads[2].Header.Get("x-ms-legal-hold") != "" {
+		t.Errorf("Expected the manifest not to be retained, but got headers %v", uploads[2].Header)
+	}
+}
+
+// TestAzureCheck validates that Check refuses a missing container, or one without version-level immutability when it is needed
+func TestAzureCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		container string
+		immutable bool
+		config    AzureConfig
+		wantErr   bool
+	}{
+		{name: "Container exists", container: "books", wantErr: false},
+		{name: "Container is missing", container: "missing", wantErr: true},
+		{name: "Immutability supported", container: "books", immutable: true, config: AzureConfig{ImmutabilityMode: "unlocked", RetentionPeriod: time.Hour}, wantErr: false},
+		{name: "Immutability not supported", container: "books", config: AzureConfig{ImmutabilityMode: "unlocked", RetentionPeriod: time.Hour}, wantErr: true},
+		{name: "Legal hold not supported", container: "books", config: AzureConfig{LegalHold: true}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock := newAzureMockServer(t, test.immutable)
+			config := test.config
+			config.ServiceURL = mock.URL + "/" + azuriteAccountName
+			config.AccountName = azuriteAccountName
+			config.SASToken = "sv=2024-08-04&sr=c&sp=racwdl&sig=bW9jaw%3D%3D"
+			config.Container = test.container
+			backend, err := NewAzure(config)
+			if err != nil {
+				t.Fatalf("NewAzure() returned an unexpected error: %v", err)
+			}
+			if err := backend.Check(context.Background()); (err != nil) != test.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, test.wantErr)
+			}
+			// The SAS token is sent with every request but never shown
+			mock.mu.Lock()
+			requests := mock.requests
+			mock.mu.Unlock()
+			if len(requests) == 0 || requests[0].URL.Query().Get("sig") != "bW9jaw==" {
+				t.Errorf("Expected the SAS token to be sent with the request")
+			}
+			if strings.Contains(backend.Location("BOOK.pdf"), "sig=") {
+				t.Errorf("Expected Location() not to include the SAS token, but got %s", backend.Location("BOOK.pdf"))
+			}
+		})
+	}
+}
+
+// TestNewAzure_Invalid validates that unusable Azure settings are refused
+func TestNewAzure_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config AzureConfig
+	}{
+		{name: "Missing container", config: AzureConfig{AccountName: azuriteAccountName, AccountKey: azuriteAccountKey}},
+		{name: "Missing account and service url", config: AzureConfig{Container: "books", SASToken: "sig=bW9jaw%3D%3D"}},
+		{name: "Missing credentials", config: AzureConfig{AccountName: azuriteAccountName, Container: "books"}},
+		{name: "Both kinds of credentials", config: AzureConfig{AccountName: azuriteAccountName, AccountKey: azuriteAccountKey, SASToken: "sig=bW9jaw%3D%3D", Container: "books"}},
+		{name: "Invalid shared key", config: AzureConfig{AccountName: azuriteAccountName, AccountKey: "not base64!", Container: "books"}},
+		{name: "Service url with a query", config: AzureConfig{ServiceURL: "https://initech.blob.core.windows.net/?sig=bW9jaw%3D%3D", Container: "books", SASToken: "sig=bW9jaw%3D%3D"}},
+		{name: "Unknown immutability mode", config: AzureConfig{AccountName: azuriteAccountName, AccountKey: azuriteAccountKey, Container: "books", ImmutabilityMode: "forever", RetentionPeriod: time.Hour}},
+		{name: "Immutability without retention", config: AzureConfig{AccountName: azuriteAccountName, AccountKey: azuriteAccountKey, Container: "books", ImmutabilityMode: "locked"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewAzure(test.config); err == nil {
+				t.Errorf("Expected NewAzure() to fail, but it did not")
+			}
+		})
+	}
+}
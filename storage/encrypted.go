@@ -0,0 +1,257 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// EncryptedConfig How to encrypt records before they reach a backend
+type EncryptedConfig struct {
+	Cipher Cipher
+	// IsRecord reports whether key is an archived record to encrypt. Nil encrypts every object.
+	IsRecord func(key string) bool
+	// StagingDir is where records are encrypted before they are stored, which is created if needed. Blank uses the
+	// system temporary directory.
+	StagingDir string
+}
+
+// Encrypted A Backend that encrypts records before storing them in another Backend and decrypts them when they are read.
+// Encrypted records are stored with EncryptedFileSuffix added to their key, and records stored before encryption was
+// turned on are still read as they are.
+type Encrypted struct {
+	backend    Backend
+	cipher     Cipher
+	isRecord   func(key string) bool
+	stagingDir string
+}
+
+// NewEncrypted creates a Backend encrypting records with config before storing them in backend
+func NewEncrypted(backend Backend, config EncryptedConfig) *Encrypted {
+	return &Encrypted{
+		backend:    backend,
+		cipher:     config.Cipher,
+		isRecord:   config.IsRecord,
+		stagingDir: config.StagingDir,
+	}
+}
+
+// encrypts reports whether the object for key is encrypted
+func (e *Encrypted) encrypts(key string) bool {
+	return key != "" && (e.isRecord == nil || e.isRecord(key))
+}
+
+// Location returns where key is stored in the underlying backend
+func (e *Encrypted) Location(key string) string {
+	if e.encrypts(key) {
+		return e.backend.Location(key + EncryptedFileSuffix)
+	}
+	return e.backend.Location(key)
+}
+
+// Put encrypts r and stores it, or stores it as it is if key is not a record
+func (e *Encrypted) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if !e.encrypts(key) {
+		return e.backend.Put(ctx, key, r, size)
+	}
+	return e.encrypt(ctx, key, r, size, func(encrypted io.Reader, encryptedSize int64) error {
+		return e.backend.Put(ctx, key+EncryptedFileSuffix, encrypted, encryptedSize)
+	})
+}
+
+// PutRetained encrypts r and stores it like Put, protecting it if the underlying backend supports retention
+func (e *Encrypted) PutRetained(ctx context.Context, key string, r io.Reader, size int64) error {
+	if !e.encrypts(key) {
+		return PutRecord(ctx, e.backend, key, r, size)
+	}
+	return e.encrypt(ctx, key, r, size, func(encrypted io.Reader, encryptedSize int64) error {
+		return PutRecord(ctx, e.backend, key+EncryptedFileSuffix, encrypted, encryptedSize)
+	})
+}
+
+// encrypt encrypts r into a temporary file and hands it to store, so the encrypted record can be rewound and its size
+// is known before it is uploaded
+func (e *Encrypted) encrypt(ctx context.Context, key string, r io.Reader, size int64, store func(io.Reader, int64) error) error {
+	if e.stagingDir != "" {
+		if err := os.MkdirAll(e.stagingDir, 0750); err != nil {
+			return fmt.Errorf("failed to create staging directory %s: %w", e.stagingDir, err)
+		}
+	}
+	tempFile, err := os.CreateTemp(e.stagingDir, PartialFilePrefix+"*"+PartialFileSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary file to encrypt %s: %w", key, err)
+	}
+	defer func() {
+		_ = tempFile.Close()
+		if err := os.Remove(tempFile.Name()); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: failed to remove partial file %s: %v", tempFile.Name(), err)
+		}
+	}()
+
+	encrypter, err := e.cipher.Encrypt(tempFile)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", key, err)
+	}
+	written, err := io.Copy(encrypter, contextReader{ctx: ctx, Reader: r})
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", key, err)
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("failed to encrypt %s: expected %d bytes but got %d", key, size, written)
+	}
+	if err := encrypter.Close(); err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", key, err)
+	}
+	encryptedSize, err := tempFile.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to rewind %s: %w", tempFile.Name(), err)
+	}
+	if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind %s: %w", tempFile.Name(), err)
+	}
+	return store(tempFile, encryptedSize)
+}
+
+// Stat describes the stored object for key. The size of an encrypted record is its encrypted size.
+func (e *Encrypted) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	if e.encrypts(key) {
+		info, err := e.backend.Stat(ctx, key+EncryptedFileSuffix)
+		if err == nil {
+			info.Key, info.Encrypted = key, true
+			return info, nil
+		}
+		if !errors.Is(err, ErrNotExist) {
+			return ObjectInfo{}, err
+		}
+	}
+	return e.backend.Stat(ctx, key)
+}
+
+// List describes every object whose key starts with prefix, naming encrypted records by their original key
+func (e *Encrypted) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects, err := e.backend.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(objects))
+	listed := make([]ObjectInfo, 0, len(objects))
+	for _, object := range objects {
+		if original, ok := strings.CutSuffix(object.Key, EncryptedFileSuffix); ok && e.encrypts(original) {
+			object.Key, object.Encrypted = original, true
+		}
+		// A record stored both before and after encryption was turned on is only listed once
+		if seen[object.Key] {
+			continue
+		}
+		seen[object.Key] = true
+		listed = append(listed, object)
+	}
+	sort.Slice(listed, func(i, j int) bool { return listed[i].Key < listed[j].Key })
+	return listed, nil
+}
+
+// Get opens the object for key, decrypting it if it is an encrypted record
+func (e *Encrypted) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if e.encrypts(key) {
+		object, err := e.backend.Get(ctx, key+EncryptedFileSuffix)
+		if err == nil {
+			plaintext, err := e.cipher.Decrypt(object)
+			if err != nil {
+				_ = object.Close()
+				return nil, fmt.Errorf("failed to decrypt %s: %w", e.backend.Location(key+EncryptedFileSuffix), err)
+			}
+			return decryptedObject{Reader: plaintext, Closer: object}, nil
+		}
+		if !errors.Is(err, ErrNotExist) {
+			return nil, err
+		}
+	}
+	return e.backend.Get(ctx, key)
+}
+
+// decryptedObject Reads the plaintext of an object and closes the object underneath it
+type decryptedObject struct {
+	io.Reader
+	io.Closer
+}
+
+// Delete removes the object for key, both encrypted and as it was stored before encryption was turned on
+func (e *Encrypted) Delete(ctx context.Context, key string) error {
+	if e.encrypts(key) {
+		if err := e.backend.Delete(ctx, key+EncryptedFileSuffix); err != nil {
+			return err
+		}
+	}
+	return e.backend.Delete(ctx, key)
+}
+
+// Append adds data to the end of the object for key. Encrypted objects are decrypted and rewritten.
+func (e *Encrypted) Append(ctx context.Context, key string, data []byte) error {
+	if e.encrypts(key) {
+		return appendByRewriting(ctx, e, key, data)
+	}
+	return Append(ctx, e.backend, key, data)
+}
+
+// Check checks the underlying backend
+func (e *Encrypted) Check(ctx context.Context) error {
+	return Check(ctx, e.backend)
+}
+
+// Close disconnects the underlying backend if it holds a connection open
+func (e *Encrypted) Close() error {
+	if closer, ok := e.backend.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Rekey decrypts every encrypted record and encrypts it again with the current Cipher, such as after rotating the
+// recipients or key. It returns how many records were encrypted again. Records that fail are skipped and reported.
+func (e *Encrypted) Rekey(ctx context.Context) (int, error) {
+	objects, err := e.backend.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	rekeyed := 0
+	var errs []error
+	for _, object := range objects {
+		original, ok := strings.CutSuffix(object.Key, EncryptedFileSuffix)
+		if !ok || !e.encrypts(original) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return rekeyed, err
+		}
+		if err := e.rekey(ctx, original); err != nil {
+			errs = append(errs, fmt.Errorf("failed to re-encrypt %s: %w", e.Location(original), err))
+			continue
+		}
+		rekeyed++
+	}
+	return rekeyed, errors.Join(errs...)
+}
+
+// rekey decrypts the record for key and stores it encrypted again
+func (e *Encrypted) rekey(ctx context.Context, key string) error {
+	object, err := e.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := object.Close(); err != nil {
+			log.Printf("Warning: failed to close %s: %v", e.Location(key), err)
+		}
+	}()
+	return e.PutRetained(ctx, key, object, -1)
+}
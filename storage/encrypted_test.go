@@ -0,0 +1,175 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// isTestRecord treats PDFs as records, leaving checksums and manifests readable
+func isTestRecord(key string) bool {
+	return strings.HasSuffix(key, ".pdf")
+}
+
+// TestEncrypted validates that records are encrypted at rest and read back transparently, while other files are not
+func TestEncrypted(t *testing.T) {
+	ctx := context.Background()
+	tempDir := t.TempDir()
+	local := NewLocal(tempDir)
+	ageCipher, _ := newTestAgeCipher(t)
+	stagingDir := t.TempDir()
+	backend := NewEncrypted(local, EncryptedConfig{Cipher: ageCipher, IsRecord: isTestRecord, StagingDir: stagingDir})
+
+	content := "Guns. Lots of guns."
+	if err := PutRecord(ctx, backend, "2025/BOOK.pdf", strings.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("PutRecord() returned an unexpected error: %v", err)
+	}
+	if err := backend.Put(ctx, "2025/BOOK.pdf.sha256", strings.NewReader("abc123"), 6); err != nil {
+		t.Fatalf("Put() returned an unexpected error: %v", err)
+	}
+	if err := Append(ctx, backend, "manifest.jsonl", []byte("one\n")); err != nil {
+		t.Fatalf("Append() returned an unexpected error: %v", err)
+	}
+
+	stored, err := os.ReadFile(filepath.Join(tempDir, "2025", "BOOK.pdf.enc"))
+	if err != nil || bytes.Contains(stored, []byte("Guns.")) {
+		t.Errorf("Expected the record to be stored encrypted, but got %q (%v)", stored, err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "2025", "BOOK.pdf")); !os.IsNotExist(err) {
+		t.Errorf("Expected no plaintext copy of the record, but got %v", err)
+	}
+	if checksum, err := os.ReadFile(filepath.Join(tempDir, "2025", "BOOK.pdf.sha256")); err != nil || string(checksum) != "abc123" {
+		t.Errorf("Expected the checksum to be stored as it is, but got %q (%v)", checksum, err)
+	}
+	if manifest, err := os.ReadFile(filepath.Join(tempDir, "manifest.jsonl")); err != nil || string(manifest) != "one\n" {
+		t.Errorf("Expected the manifest to be stored as it is, but got %q (%v)", manifest, err)
+	}
+	if entries, _ := os.ReadDir(stagingDir); len(entries) != 0 {
+		t.Errorf("Expected no encrypted copies to be left in the staging directory, but found %d", len(entries))
+	}
+
+	if read, err := ReadAll(ctx, backend, "2025/BOOK.pdf"); err != nil || string(read) != content {
+		t.Errorf("Expected the record to be decrypted, but got %q (%v)", read, err)
+	}
+	if info, err := backend.Stat(ctx, "2025/BOOK.pdf"); err != nil || info.Key != "2025/BOOK.pdf" {
+		t.Errorf("Stat() = %+v, %v", info, err)
+	}
+	if _, err := backend.Stat(ctx, "MISSING.pdf"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Expected a missing record to be reported as missing, but got %v", err)
+	}
+	if location := backend.Location("2025/BOOK.pdf"); location != filepath.Join(tempDir, "2025", "BOOK.pdf.enc") {
+		t.Errorf("Location() = %q", location)
+	}
+
+	// A record archived before encryption was turned on is still found and read as it is
+	if err := local.Put(ctx, "2024/OLD.pdf", strings.NewReader("Old guns."), -1); err != nil {
+		t.Fatalf("Put() returned an unexpected error: %v", err)
+	}
+	if read, err := ReadAll(ctx, backend, "2024/OLD.pdf"); err != nil || string(read) != "Old guns." {
+		t.Errorf("Expected a plaintext record to be read as it is, but got %q (%v)", read, err)
+	}
+	objects, err := backend.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List() returned an unexpected error: %v", err)
+	}
+	var keys []string
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	if strings.Join(keys, ",") != "2024/OLD.pdf,2025/BOOK.pdf,2025/BOOK.pdf.sha256,manifest.jsonl" {
+		t.Errorf("List() = %v", keys)
+	}
+
+	if err := backend.Delete(ctx, "2025/BOOK.pdf"); err != nil {
+		t.Errorf("Delete() returned an unexpected error: %v", err)
+	}
+	if _, err := backend.Get(ctx, "2025/BOOK.pdf"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Expected a deleted record to be missing, but got %v", err)
+	}
+}
+
+// TestEncrypted_Altered validates that an encrypted record that was altered at rest is refused rather than read
+func TestEncrypted_Altered(t *testing.T) {
+	ctx := context.Background()
+	tempDir := t.TempDir()
+	aesCipher, err := NewAESGCMCipher(writeTestKeyFile(t))
+	if err != nil {
+		t.Fatalf("NewAESGCMCipher() returned an unexpected error: %v", err)
+	}
+	backend := NewEncrypted(NewLocal(tempDir), EncryptedConfig{Cipher: aesCipher})
+	if err := backend.Put(ctx, "BOOK.pdf", strings.NewReader("Guns. Lots of guns."), -1); err != nil {
+		t.Fatalf("Put() returned an unexpected error: %v", err)
+	}
+	storedPath := filepath.Join(tempDir, "BOOK.pdf.enc")
+	stored, err := os.ReadFile(storedPath)
+	if err != nil {
+		t.Fatalf("Failed to read the stored record: %v", err)
+	}
+	stored[len(stored)-1] ^= 1
+	if err := os.WriteFile(storedPath, stored, 0600); err != nil {
+		t.Fatalf("Failed to alter the stored record: %v", err)
+	}
+	if _, err := ReadAll(ctx, backend, "BOOK.pdf"); err == nil {
+		t.Errorf("Expected an altered record to be refused")
+	}
+	if err := backend.Put(ctx, "SHORT.pdf", strings.NewReader("Guns."), 100); err == nil {
+		t.Errorf("Expected Put() to fail when the size does not match")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "SHORT.pdf.enc")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be stored after a failed Put, but got %v", err)
+	}
+}
+
+// TestEncryptedRekey validates that records are encrypted again with the current key after it is rotated
+func TestEncryptedRekey(t *testing.T) {
+	ctx := context.Background()
+	local := NewLocal(t.TempDir())
+	oldKey, newKey := writeTestKeyFile(t), writeTestKeyFile(t)
+	oldCipher, err := NewAESGCMCipher(oldKey)
+	if err != nil {
+		t.Fatalf("NewAESGCMCipher() returned an unexpected error: %v", err)
+	}
+	rotated, err := NewAESGCMCipher(newKey, oldKey)
+	if err != nil {
+		t.Fatalf("NewAESGCMCipher() returned an unexpected error: %v", err)
+	}
+	newCipher, err := NewAESGCMCipher(newKey)
+	if err != nil {
+		t.Fatalf("NewAESGCMCipher() returned an unexpected error: %v", err)
+	}
+
+	before := NewEncrypted(local, EncryptedConfig{Cipher: oldCipher, IsRecord: isTestRecord})
+	for _, key := range []string{"2025/01/BOOK.pdf", "2025/02/BOOK.pdf"} {
+		if err := before.Put(ctx, key, strings.NewReader("Guns. "+key), -1); err != nil {
+			t.Fatalf("Put() returned an unexpected error: %v", err)
+		}
+	}
+	if err := before.Put(ctx, "manifest.jsonl", strings.NewReader("one\n"), -1); err != nil {
+		t.Fatalf("Put() returned an unexpected error: %v", err)
+	}
+
+	rekeyed, err := NewEncrypted(local, EncryptedConfig{Cipher: rotated, IsRecord: isTestRecord}).Rekey(ctx)
+	if err != nil || rekeyed != 2 {
+		t.Fatalf("Expected Rekey() to re-encrypt 2 records, but got %d (%v)", rekeyed, err)
+	}
+	after := NewEncrypted(local, EncryptedConfig{Cipher: newCipher, IsRecord: isTestRecord})
+	for _, key := range []string{"2025/01/BOOK.pdf", "2025/02/BOOK.pdf"} {
+		if read, err := ReadAll(ctx, after, key); err != nil || string(read) != "Guns. "+key {
+			t.Errorf("Expected %s to decrypt with only the new key, but got %q (%v)", key, read, err)
+		}
+	}
+
+	// Records that can't be decrypted are reported and the rest are still re-encrypted
+	if rekeyed, err := NewEncrypted(local, EncryptedConfig{Cipher: oldCipher, IsRecord: isTestRecord}).Rekey(ctx); err == nil || rekeyed != 0 {
+		t.Errorf("Expected Rekey() with a retired key to fail, but got %d (%v)", rekeyed, err)
+	}
+}
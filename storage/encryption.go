@@ -0,0 +1,313 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"filippo.io/age"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// EncryptedFileSuffix is added to the key of every encrypted object so an encrypted file is never mistaken for a plain one
+const EncryptedFileSuffix = ".enc"
+
+// ageHeader starts every file encrypted with age
+const ageHeader = "age-encryption.org/"
+
+// aesGCMHeader starts every file encrypted with AESGCMCipher, followed by the key ID and a random salt
+const aesGCMHeader = "fastbound-downloader/aes-256-gcm/v1\n"
+
+const (
+	aesGCMKeyIDSize  = 8
+	aesGCMSaltSize   = 32
+	aesGCMChunkSize  = 64 * 1024
+	aesGCMNonceSize  = 12
+	aesGCMLastChunk  = 1 // Set in the last byte of the nonce of the final chunk so a truncated file fails to decrypt
+	aesGCMKeyHexSize = 64
+)
+
+// Cipher Encrypts records before they are stored and decrypts them when they are read back
+type Cipher interface {
+	// Encrypt returns a writer that encrypts everything written to it into w. Close finishes the encryption.
+	Encrypt(w io.Writer) (io.WriteCloser, error)
+	// Decrypt returns a reader of the plaintext of r, which fails if r was altered or truncated
+	Decrypt(r io.Reader) (io.Reader, error)
+}
+
+// AgeCipher A Cipher that encrypts to age recipients, so only holders of a matching identity can decrypt
+type AgeCipher struct {
+	recipients []age.Recipient
+	identities []age.Identity
+}
+
+// NewAgeCipher creates a Cipher encrypting to the age recipients in recipients and decrypting with the identities in
+// identityFile. Either may be left empty for a Cipher that only encrypts or only decrypts.
+func NewAgeCipher(recipients []string, identityFile string) (*AgeCipher, error) {
+	c := &AgeCipher{}
+	for _, recipient := range recipients {
+		parsed, err := age.ParseX25519Recipient(strings.TrimSpace(recipient))
+		if err != nil {
+			return nil, fmt.Errorf("invalid age recipient %q: %w", recipient, err)
+		}
+		c.recipients = append(c.recipients, parsed)
+	}
+	if identityFile != "" {
+		identities, err := os.Open(identityFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open age identity file: %w", err)
+		}
+		defer func() {
+			_ = identities.Close()
+		}()
+		if c.identities, err = age.ParseIdentities(identities); err != nil {
+			return nil, fmt.Errorf("failed to read age identity file %s: %w", identityFile, err)
+		}
+	}
+	return c, nil
+}
+
+// Encrypt returns a writer that encrypts to every recipient
+func (c *AgeCipher) Encrypt(w io.Writer) (io.WriteCloser, error) {
+	if len(c.recipients) == 0 {
+		return nil, fmt.Errorf("no age recipients to encrypt to")
+	}
+	return age.Encrypt(w, c.recipients...)
+}
+
+// Decrypt returns a reader of the plaintext of r using whichever identity it was encrypted to
+func (c *AgeCipher) Decrypt(r io.Reader) (io.Reader, error) {
+	if len(c.identities) == 0 {
+		return nil, fmt.Errorf("an age identity is needed to decrypt")
+	}
+	buffered := bufio.NewReader(r)
+	if header, _ := buffered.Peek(len(aesGCMHeader)); string(header) == aesGCMHeader {
+		return nil, fmt.Errorf("encrypted with an AES-256-GCM key file rather than age")
+	}
+	return age.Decrypt(buffered, c.identities...)
+}
+
+// aesGCMKey A 256-bit key and the ID stored in the header of everything it encrypts
+type aesGCMKey struct {
+	id  []byte
+	key []byte
+}
+
+// AESGCMCipher A Cipher that encrypts with AES-256-GCM using a key read from a file. Each file is encrypted with its
+// own key derived from a random salt, in authenticated chunks so large books never have to fit in memory.
+type AESGCMCipher struct {
+	keys []aesGCMKey // The first key encrypts, and any of them decrypts
+}
+
+// NewAESGCMCipher creates a Cipher encrypting with the key in keyFile and decrypting with it or any of previousKeyFiles,
+// so records encrypted before a key was rotated can still be read
+func NewAESGCMCipher(keyFile string, previousKeyFiles ...string) (*AESGCMCipher, error) {
+	c := &AESGCMCipher{}
+	for _, path := range append([]string{keyFile}, previousKeyFiles...) {
+		key, err := ReadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		c.keys = append(c.keys, aesGCMKey{id: aesGCMKeyID(key), key: key})
+	}
+	return c, nil
+}
+
+// ReadKeyFile reads a 256-bit key written as 64 hexadecimal characters, such as the output of `openssl rand -hex 32`
+func ReadKeyFile(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	encoded := strings.TrimSpace(string(content))
+	key, err := hex.DecodeString(encoded)
+	if err != nil || len(encoded) != aesGCMKeyHexSize {
+		return nil, fmt.Errorf("key file %s must hold %d hexadecimal characters", path, aesGCMKeyHexSize)
+	}
+	return key, nil
+}
+
+// aesGCMKeyID returns the ID of key, which tells keys apart without revealing them
+func aesGCMKeyID(key []byte) []byte {
+	sum := sha256.Sum256(append([]byte("fastbound-downloader key id\n"), key...))
+	return sum[:aesGCMKeyIDSize]
+}
+
+// newAESGCM creates the AEAD for one file from key and the file's salt
+func newAESGCM(key []byte, salt []byte) (cipher.AEAD, error) {
+	fileKey, err := hkdf.Key(sha256.New, key, salt, "fastbound-downloader aes-256-gcm v1", 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// aesGCMNonce returns the nonce of chunk number counter, marking the final chunk
+func aesGCMNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, aesGCMNonceSize)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if last {
+		nonce[aesGCMNonceSize-1] = aesGCMLastChunk
+	}
+	return nonce
+}
+
+// Encrypt writes the header for a fresh salt and returns a writer that encrypts in chunks with the current key
+func (c *AESGCMCipher) Encrypt(w io.Writer) (io.WriteCloser, error) {
+	salt := make([]byte, aesGCMSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newAESGCM(c.keys[0].key, salt)
+	if err != nil {
+		return nil, err
+	}
+	header := append(append([]byte(aesGCMHeader), c.keys[0].id...), salt...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &aesGCMWriter{w: w, aead: aead, buffer: make([]byte, 0, aesGCMChunkSize)}, nil
+}
+
+// aesGCMWriter Seals each full chunk once more data follows it, and the final chunk on Close
+type aesGCMWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	buffer  []byte
+	counter uint64
+	closed  bool
+}
+
+func (a *aesGCMWriter) Write(p []byte) (int, error) {
+	if a.closed {
+		return 0, errors.New("write to a closed encryption writer")
+	}
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data arrives, since the final chunk is sealed differently
+		if len(a.buffer) == aesGCMChunkSize {
+			if err := a.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(a.buffer[len(a.buffer):aesGCMChunkSize], p)
+		a.buffer = a.buffer[:len(a.buffer)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// seal encrypts and writes the buffered chunk
+func (a *aesGCMWriter) seal(last bool) error {
+	sealed := a.aead.Seal(nil, aesGCMNonce(a.counter, last), a.buffer, nil)
+	if _, err := a.w.Write(sealed); err != nil {
+		return err
+	}
+	a.counter++
+	a.buffer = a.buffer[:0]
+	return nil
+}
+
+// Close seals the final chunk
+func (a *aesGCMWriter) Close() error {
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	return a.seal(true)
+}
+
+// Decrypt reads the header of r and returns a reader of its plaintext using the key it names
+func (c *AESGCMCipher) Decrypt(r io.Reader) (io.Reader, error) {
+	header := make([]byte, len(aesGCMHeader)+aesGCMKeyIDSize+aesGCMSaltSize)
+	n, err := io.ReadFull(r, header)
+	if bytes.HasPrefix(header[:n], []byte(ageHeader)) {
+		return nil, fmt.Errorf("encrypted with age rather than an AES-256-GCM key file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the encryption header: %w", err)
+	}
+	if !bytes.HasPrefix(header, []byte(aesGCMHeader)) {
+		return nil, fmt.Errorf("not encrypted with an AES-256-GCM key file")
+	}
+	keyID := header[len(aesGCMHeader) : len(aesGCMHeader)+aesGCMKeyIDSize]
+	salt := header[len(aesGCMHeader)+aesGCMKeyIDSize:]
+	for _, key := range c.keys {
+		if !bytes.Equal(key.id, keyID) {
+			continue
+		}
+		aead, err := newAESGCM(key.key, salt)
+		if err != nil {
+			return nil, err
+		}
+		return &aesGCMReader{r: bufio.NewReader(r), aead: aead, chunk: make([]byte, aesGCMChunkSize+aead.Overhead())}, nil
+	}
+	return nil, fmt.Errorf("encrypted with key %s, which is not one of the configured key files", hex.EncodeToString(keyID))
+}
+
+// aesGCMReader Opens one chunk at a time, failing if any chunk was altered or the file was cut short
+type aesGCMReader struct {
+	r         *bufio.Reader
+	aead      cipher.AEAD
+	chunk     []byte
+	plaintext []byte
+	counter   uint64
+	done      bool
+}
+
+func (a *aesGCMReader) Read(p []byte) (int, error) {
+	for len(a.plaintext) == 0 {
+		if a.done {
+			return 0, io.EOF
+		}
+		if err := a.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, a.plaintext)
+	a.plaintext = a.plaintext[n:]
+	return n, nil
+}
+
+// open reads and decrypts the next chunk
+func (a *aesGCMReader) open() error {
+	n, err := io.ReadFull(a.r, a.chunk)
+	last := false
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF):
+		last = true
+	case err != nil:
+		return err
+	default:
+		// A full chunk is the last one when nothing follows it
+		_, peekErr := a.r.Peek(1)
+		last = errors.Is(peekErr, io.EOF)
+	}
+	plaintext, err := a.aead.Open(a.chunk[:0], aesGCMNonce(a.counter, last), a.chunk[:n], nil)
+	if err != nil {
+		return fmt.Errorf("encrypted file is damaged, truncated or was altered")
+	}
+	a.counter++
+	a.plaintext = plaintext
+	a.done = last
+	return nil
+}
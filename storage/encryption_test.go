@@ -0,0 +1,205 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"filippo.io/age"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestKeyFile writes a random AES-256 key file and returns its path
+func writeTestKeyFile(t *testing.T) string {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("Failed to generate a key: %v", err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "books.key")
+	if err := os.WriteFile(keyFile, []byte(hex.EncodeToString(key)+"\n"), 0400); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	return keyFile
+}
+
+// newTestAgeCipher creates an AgeCipher for a fresh identity and returns it with the identity's recipient
+func newTestAgeCipher(t *testing.T) (*AgeCipher, string) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("Failed to generate an age identity: %v", err)
+	}
+	identityFile := filepath.Join(t.TempDir(), "identity.txt")
+	if err := os.WriteFile(identityFile, []byte("# Inspector\n"+identity.String()+"\n"), 0400); err != nil {
+		t.Fatalf("Failed to write identity file: %v", err)
+	}
+	ageCipher, err := NewAgeCipher([]string{identity.Recipient().String()}, identityFile)
+	if err != nil {
+		t.Fatalf("NewAgeCipher() returned an unexpected error: %v", err)
+	}
+	return ageCipher, identity.Recipient().String()
+}
+
+// encryptForTest encrypts plaintext with c
+func encryptForTest(t *testing.T, c Cipher, plaintext []byte) []byte {
+	var encrypted bytes.Buffer
+	encrypter, err := c.Encrypt(&encrypted)
+	if err != nil {
+		t.Fatalf("Encrypt() returned an unexpected error: %v", err)
+	}
+	if _, err := encrypter.Write(plaintext); err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if err := encrypter.Close(); err != nil {
+		t.Fatalf("Failed to finish encrypting: %v", err)
+	}
+	return encrypted.Bytes()
+}
+
+// decryptForTest decrypts encrypted with c
+func decryptForTest(c Cipher, encrypted []byte) ([]byte, error) {
+	plaintext, err := c.Decrypt(bytes.NewReader(encrypted))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(plaintext)
+}
+
+// TestCiphers validates that each Cipher decrypts what it encrypted, whatever its size relative to a chunk
+func TestCiphers(t *testing.T) {
+	aesCipher, err := NewAESGCMCipher(writeTestKeyFile(t))
+	if err != nil {
+		t.Fatalf("NewAESGCMCipher() returned an unexpected error: %v", err)
+	}
+	ageCipher, _ := newTestAgeCipher(t)
+	large := make([]byte, 3*aesGCMChunkSize+17)
+	if _, err := rand.Read(large); err != nil {
+		t.Fatalf("Failed to generate a test book: %v", err)
+	}
+	for name, c := range map[string]Cipher{"AES-256-GCM": aesCipher, "age": ageCipher} {
+		for _, plaintext := range [][]byte{nil, []byte("Guns. Lots of guns."), large[:aesGCMChunkSize], large[:2*aesGCMChunkSize], large} {
+			encrypted := encryptForTest(t, c, plaintext)
+			if bytes.Contains(encrypted, []byte("Guns.")) {
+				t.Errorf("%s left the plaintext readable", name)
+			}
+			decrypted, err := decryptForTest(c, encrypted)
+			if err != nil || !bytes.Equal(decrypted, plaintext) {
+				t.Errorf("%s failed to decrypt %d bytes: %v", name, len(plaintext), err)
+			}
+		}
+	}
+}
+
+// TestAESGCMCipher_Tampered validates that altered, truncated or extended files are refused
+func TestAESGCMCipher_Tampered(t *testing.T) {
+	aesCipher, err := NewAESGCMCipher(writeTestKeyFile(t))
+	if err != nil {
+		t.Fatalf("NewAESGCMCipher() returned an unexpected error: %v", err)
+	}
+	plaintext := bytes.Repeat([]byte("Guns. Lots of guns. "), aesGCMChunkSize/10)
+	encrypted := encryptForTest(t, aesCipher, plaintext)
+	headerSize := len(aesGCMHeader) + aesGCMKeyIDSize + aesGCMSaltSize
+	chunkSize := aesGCMChunkSize + 16
+
+	altered := bytes.Clone(encrypted)
+	altered[headerSize+100] ^= 1
+	tests := map[string][]byte{
+		"Altered":                altered,
+		"Truncated at a chunk":   encrypted[:headerSize+chunkSize],
+		"Truncated mid chunk":    encrypted[:len(encrypted)-1],
+		"Truncated after header": encrypted[:headerSize],
+		"Extended":               append(bytes.Clone(encrypted), 0),
+		"Not encrypted":          plaintext,
+	}
+	for name, damaged := range tests {
+		if _, err := decryptForTest(aesCipher, damaged); err == nil {
+			t.Errorf("Expected %s to fail to decrypt", name)
+		}
+	}
+}
+
+// TestAESGCMCipher_Rotation validates that previous keys still decrypt while only the current key encrypts
+func TestAESGCMCipher_Rotation(t *testing.T) {
+	oldKey, newKey := writeTestKeyFile(t), writeTestKeyFile(t)
+	oldCipher, err := NewAESGCMCipher(oldKey)
+	if err != nil {
+		t.Fatalf("NewAESGCMCipher() returned an unexpected error: %v", err)
+	}
+	rotated, err := NewAESGCMCipher(newKey, oldKey)
+	if err != nil {
+		t.Fatalf("NewAESGCMCipher() returned an unexpected error: %v", err)
+	}
+	newCipher, err := NewAESGCMCipher(newKey)
+	if err != nil {
+		t.Fatalf("NewAESGCMCipher() returned an unexpected error: %v", err)
+	}
+
+	encrypted := encryptForTest(t, oldCipher, []byte("Guns."))
+	if decrypted, err := decryptForTest(rotated, encrypted); err != nil || string(decrypted) != "Guns." {
+		t.Errorf("Expected a previous key to decrypt, but got %q (%v)", decrypted, err)
+	}
+	if _, err := decryptForTest(newCipher, encrypted); err == nil || !strings.Contains(err.Error(), "not one of the configured key files") {
+		t.Errorf("Expected a file encrypted with an unknown key to be refused, but got %v", err)
+	}
+	if _, err := decryptForTest(oldCipher, encryptForTest(t, rotated, []byte("Guns."))); err == nil {
+		t.Errorf("Expected the rotated cipher to encrypt with the new key")
+	}
+}
+
+// TestCiphers_WrongKind validates that a file encrypted one way is refused with a helpful error by the other
+func TestCiphers_WrongKind(t *testing.T) {
+	aesCipher, err := NewAESGCMCipher(writeTestKeyFile(t))
+	if err != nil {
+		t.Fatalf("NewAESGCMCipher() returned an unexpected error: %v", err)
+	}
+	ageCipher, _ := newTestAgeCipher(t)
+	if _, err := decryptForTest(aesCipher, encryptForTest(t, ageCipher, []byte("Guns."))); err == nil || !strings.Contains(err.Error(), "age") {
+		t.Errorf("Expected an age file to be refused by the key file cipher, but got %v", err)
+	}
+	if _, err := decryptForTest(ageCipher, encryptForTest(t, aesCipher, []byte("Guns."))); err == nil || !strings.Contains(err.Error(), "AES-256-GCM") {
+		t.Errorf("Expected a key file encrypted file to be refused by the age cipher, but got %v", err)
+	}
+	otherAge, _ := newTestAgeCipher(t)
+	if _, err := decryptForTest(otherAge, encryptForTest(t, ageCipher, []byte("Guns."))); err == nil {
+		t.Errorf("Expected a file encrypted to another recipient to be refused")
+	}
+}
+
+// TestNewCiphers_Invalid validates that unusable keys are refused
+func TestNewCiphers_Invalid(t *testing.T) {
+	shortKey := filepath.Join(t.TempDir(), "short.key")
+	if err := os.WriteFile(shortKey, []byte("deadbeef"), 0400); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	for _, keyFile := range []string{shortKey, filepath.Join(t.TempDir(), "missing.key")} {
+		if _, err := NewAESGCMCipher(keyFile); err == nil {
+			t.Errorf("Expected NewAESGCMCipher(%s) to fail", keyFile)
+		}
+	}
+	if _, err := NewAESGCMCipher(writeTestKeyFile(t), shortKey); err == nil {
+		t.Errorf("Expected an invalid previous key file to be refused")
+	}
+	if _, err := NewAgeCipher([]string{"age1notarecipient"}, ""); err == nil {
+		t.Errorf("Expected an invalid age recipient to be refused")
+	}
+	if _, err := NewAgeCipher(nil, shortKey); err == nil {
+		t.Errorf("Expected an invalid age identity file to be refused")
+	}
+	encryptOnly, err := NewAgeCipher(nil, "")
+	if err != nil {
+		t.Fatalf("NewAgeCipher() returned an unexpected error: %v", err)
+	}
+	if _, err := encryptOnly.Encrypt(io.Discard); err == nil {
+		t.Errorf("Expected encrypting without recipients to fail")
+	}
+	if _, err := encryptOnly.Decrypt(strings.NewReader("")); err == nil {
+		t.Errorf("Expected decrypting without identities to fail")
+	}
+}
@@ -0,0 +1,288 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local A Backend that stores objects as files under a directory on the local filesystem
+type Local struct {
+	root     string
+	excluded map[string]bool // Keys of directories under root that List leaves out
+}
+
+// NewLocal creates a Backend storing objects under the directory root. Any of the excluded directories inside root,
+// such as where downloads are staged or quarantined, are left out of List so they are never mistaken for archived files.
+func NewLocal(root string, excluded ...string) *Local {
+	local := &Local{root: root, excluded: make(map[string]bool)}
+	absoluteRoot, err := filepath.Abs(root)
+	if err != nil {
+		return local
+	}
+	for _, dir := range excluded {
+		if dir == "" {
+			continue
+		}
+		absoluteDir, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		relativeDir, err := filepath.Rel(absoluteRoot, absoluteDir)
+		if err != nil || relativeDir == "." || relativeDir == ".." || strings.HasPrefix(relativeDir, ".."+string(filepath.Separator)) {
+			// Only directories inside root could be listed
+			continue
+		}
+		local.excluded[filepath.ToSlash(relativeDir)] = true
+	}
+	return local
+}
+
+// Location returns the file path of key
+func (l *Local) Location(key string) string {
+	return filepath.Join(l.root, filepath.FromSlash(key))
+}
+
+// path returns the file path of key after checking it stays inside the root
+func (l *Local) path(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return l.Location(cleaned), nil
+}
+
+// Put writes r to a temporary file, flushes it to disk and atomically renames it into place
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	destinationPath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := l.makeParentDirs(destinationPath); err != nil {
+		return err
+	}
+
+	// The temporary file lives in the root, rather than next to the destination, so a sweep of the root finds it
+	tempFile, err := os.CreateTemp(l.root, PartialFilePrefix+"*"+PartialFileSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary file for %s: %w", destinationPath, err)
+	}
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		_ = tempFile.Close()
+		if err := os.Remove(tempFile.Name()); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: failed to remove partial file %s: %v", tempFile.Name(), err)
+		}
+	}()
+
+	written, err := io.Copy(tempFile, contextReader{ctx: ctx, Reader: r})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", destinationPath, err)
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("failed to write %s: expected %d bytes but got %d", destinationPath, size, written)
+	}
+	if err := tempFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", tempFile.Name(), err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", tempFile.Name(), err)
+	}
+	if err := os.Rename(tempFile.Name(), destinationPath); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", destinationPath, err)
+	}
+	committed = true
+
+	// Sync the directory so the rename itself survives a crash
+	return syncDir(filepath.Dir(destinationPath))
+}
+
+// Append adds data to the end of the file for key and syncs it to disk
+func (l *Local) Append(ctx context.Context, key string, data []byte) error {
+	filePath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := l.makeParentDirs(filePath); err != nil {
+		return err
+	}
+	appendFile, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", filePath, err)
+	}
+	defer func() {
+		if err := appendFile.Close(); err != nil {
+			log.Printf("Warning: failed to close %s: %v", filePath, err)
+		}
+	}()
+
+	if _, err := appendFile.Write(data); err != nil {
+		return fmt.Errorf("failed to append to %s: %w", filePath, err)
+	}
+	if err := appendFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// Stat describes the file for key
+func (l *Local) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	filePath, err := l.path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to stat %s: %w", filePath, err)
+	}
+	if info.IsDir() {
+		return ObjectInfo{}, fmt.Errorf("%s is a directory: %w", filePath, ErrNotExist)
+	}
+	return ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// List walks the root for files whose key starts with prefix, skipping unfinished writes and excluded directories
+func (l *Local) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(l.root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), PartialFilePrefix) && strings.HasSuffix(entry.Name(), PartialFileSuffix) {
+			return nil
+		}
+		relativePath, err := filepath.Rel(l.root, filePath)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(relativePath)
+		if entry.IsDir() {
+			if l.excluded[key] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) && len(objects) == 0 {
+		// Nothing has been stored yet
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", l.root, err)
+	}
+	return objects, nil
+}
+
+// Get opens the file for key
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	filePath, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", filePath, err)
+	}
+	return file, nil
+}
+
+// Delete removes the file for key
+func (l *Local) Delete(ctx context.Context, key string) error {
+	filePath, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// makeParentDirs creates the directories above filePath, syncing every directory it creates and the existing directory
+// they were created in so the new directories survive a crash
+func (l *Local) makeParentDirs(filePath string) error {
+	parentDir := filepath.Dir(filePath)
+	// Find the directories that don't exist yet, deepest first, before creating them
+	var created []string
+	for dir := parentDir; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil || !os.IsNotExist(err) || filepath.Dir(dir) == dir {
+			break
+		}
+		created = append(created, dir)
+	}
+	if len(created) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(parentDir, 0750); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", parentDir, err)
+	}
+	for _, dir := range append(created, filepath.Dir(created[len(created)-1])) {
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncDir fsyncs a directory so renames and new entries in it are durable. It is replaced in tests to see which
+// directories are synced.
+var syncDir = syncDirectory
+
+// syncDirectory fsyncs dir
+func syncDirectory(dir string) error {
+	dirHandle, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open %s to sync it: %w", dir, err)
+	}
+	defer func() {
+		if err := dirHandle.Close(); err != nil {
+			log.Printf("Warning: failed to close directory %s: %v", dir, err)
+		}
+	}()
+	if err := dirHandle.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+// contextReader stops a copy as soon as its context is cancelled
+type contextReader struct {
+	ctx context.Context
+	io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.Reader.Read(p)
+}
@@ -0,0 +1,218 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLocal validates storing, describing, listing, reading and deleting objects on the local filesystem
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	tempDir := t.TempDir()
+	backend := NewLocal(tempDir)
+
+	content := "Guns. Lots of guns."
+	for _, key := range []string{"2025/01/BOOK_1.pdf", "2025/02/BOOK_2.pdf", "4473.pdf"} {
+		if err := backend.Put(ctx, key, strings.NewReader(content), int64(len(content))); err != nil {
+			t.Fatalf("Put(%q) returned an unexpected error: %v", key, err)
+		}
+	}
+
+	t.Run("Test Stat", func(t *testing.T) {
+		info, err := backend.Stat(ctx, "2025/01/BOOK_1.pdf")
+		if err != nil {
+			t.Fatalf("Stat() returned an unexpected error: %v", err)
+		}
+		if info.Size != int64(len(content)) || info.Key != "2025/01/BOOK_1.pdf" {
+			t.Errorf("Unexpected object info: %+v", info)
+		}
+		if _, err := backend.Stat(ctx, "MISSING.pdf"); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Expected ErrNotExist for a missing object, but got: %v", err)
+		}
+		if _, err := backend.Stat(ctx, "2025"); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Expected ErrNotExist for a directory, but got: %v", err)
+		}
+	})
+
+	t.Run("Test Get", func(t *testing.T) {
+		got, err := ReadAll(ctx, backend, "2025/02/BOOK_2.pdf")
+		if err != nil || string(got) != content {
+			t.Errorf("Expected %q, but got %q (%v)", content, got, err)
+		}
+		if _, err := backend.Get(ctx, "MISSING.pdf"); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Expected ErrNotExist for a missing object, but got: %v", err)
+		}
+	})
+
+	t.Run("Test List", func(t *testing.T) {
+		// Unfinished writes should never be listed
+		if err := os.WriteFile(filepath.Join(tempDir, PartialFilePrefix+"12345"+PartialFileSuffix), nil, 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		objects, err := backend.List(ctx, "2025/")
+		if err != nil {
+			t.Fatalf("List() returned an unexpected error: %v", err)
+		}
+		if len(objects) != 2 || objects[0].Key != "2025/01/BOOK_1.pdf" || objects[1].Key != "2025/02/BOOK_2.pdf" {
+			t.Errorf("Unexpected objects listed: %+v", objects)
+		}
+		all, err := backend.List(ctx, "")
+		if err != nil || len(all) != 3 {
+			t.Errorf("Expected 3 objects in total, but got %d (%v)", len(all), err)
+		}
+		// Downloads staged or quarantined inside the root are not archived files
+		for _, dir := range []string{"quarantine", ".staging"} {
+			if err := os.MkdirAll(filepath.Join(tempDir, dir), 0750); err != nil {
+				t.Fatalf("Failed to create test directory: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(tempDir, dir, "REJECTED.pdf"), nil, 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+		}
+		excluding := NewLocal(tempDir, filepath.Join(tempDir, "quarantine"), filepath.Join(tempDir, ".staging"), t.TempDir())
+		if objects, err := excluding.List(ctx, ""); err != nil || len(objects) != 3 {
+			t.Errorf("Expected the quarantine and staging directories to be left out, but got %+v (%v)", objects, err)
+		}
+		missing, err := NewLocal(filepath.Join(tempDir, "missing")).List(ctx, "")
+		if err != nil || len(missing) != 0 {
+			t.Errorf("Expected an empty list for a missing root, but got %+v (%v)", missing, err)
+		}
+	})
+
+	t.Run("Test Delete", func(t *testing.T) {
+		if err := backend.Delete(ctx, "4473.pdf"); err != nil {
+			t.Fatalf("Delete() returned an unexpected error: %v", err)
+		}
+		if _, err := backend.Stat(ctx, "4473.pdf"); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Expected the deleted object to be gone, but got: %v", err)
+		}
+		if err := backend.Delete(ctx, "4473.pdf"); err != nil {
+			t.Errorf("Expected deleting a missing object to succeed, but got: %v", err)
+		}
+	})
+
+	t.Run("Test invalid keys", func(t *testing.T) {
+		for _, key := range []string{"", "../escape.pdf", "/etc/passwd", "2025/../../escape.pdf", "."} {
+			if err := backend.Put(ctx, key, strings.NewReader(content), -1); err == nil {
+				t.Errorf("Expected Put(%q) to be refused", key)
+			}
+		}
+	})
+}
+
+// failingReader returns some data and then an error, like a download that dropped partway through
+type failingReader struct {
+	sent bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.sent {
+		return 0, errors.New("connection reset")
+	}
+	r.sent = true
+	return copy(p, "Guns. Lots of"), nil
+}
+
+// TestLocalPut_Failed validates that a failed Put leaves nothing behind
+func TestLocalPut_Failed(t *testing.T) {
+	tempDir := t.TempDir()
+	backend := NewLocal(tempDir)
+	if err := backend.Put(context.Background(), "BOOK.pdf", &failingReader{}, -1); err == nil {
+		t.Fatalf("Expected an error from a failed write, but got none")
+	}
+	if err := backend.Put(context.Background(), "SHORT.pdf", strings.NewReader("Guns."), 1000); err == nil {
+		t.Fatalf("Expected an error from a short write, but got none")
+	}
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to list %s: %v", tempDir, err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected no files after failed writes, but found %d", len(entries))
+	}
+}
+
+// TestLocal_SyncsNewDirs validates that every directory created for a file is synced, along with the one it was created in
+func TestLocal_SyncsNewDirs(t *testing.T) {
+	tempDir := t.TempDir()
+	var synced []string
+	syncDir = func(dir string) error {
+		synced = append(synced, dir)
+		return syncDirectory(dir)
+	}
+	defer func() {
+		syncDir = syncDirectory
+	}()
+
+	tests := []struct {
+		key        string
+		wantSynced []string
+	}{
+		{key: "2025/01/BOOK_1.pdf", wantSynced: []string{"2025/01", "2025", "", "2025/01"}},
+		{key: "2025/02/BOOK_2.pdf", wantSynced: []string{"2025/02", "2025", "2025/02"}},
+		{key: "2025/02/BOOK_3.pdf", wantSynced: []string{"2025/02"}},
+	}
+	backend := NewLocal(tempDir)
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			synced = nil
+			if err := backend.Put(context.Background(), test.key, strings.NewReader("Guns. Lots of guns."), -1); err != nil {
+				t.Fatalf("Put() returned an unexpected error: %v", err)
+			}
+			var want []string
+			for _, dir := range test.wantSynced {
+				want = append(want, filepath.Join(tempDir, filepath.FromSlash(dir)))
+			}
+			if strings.Join(synced, "\n") != strings.Join(want, "\n") {
+				t.Errorf("Expected to sync:\n%s\nbut synced:\n%s", strings.Join(want, "\n"), strings.Join(synced, "\n"))
+			}
+		})
+	}
+}
+
+// putOnly hides the Append method of a backend so the generic Append path is used
+type putOnly struct {
+	Backend
+}
+
+// TestAppend validates appending both with backends that append in place and with ones that rewrite the object
+func TestAppend(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend Backend
+	}{
+		{name: "Appender", backend: NewLocal(t.TempDir())},
+		{name: "Rewrite", backend: putOnly{NewLocal(t.TempDir())}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			for _, line := range []string{"first\n", "second\n"} {
+				if err := Append(ctx, test.backend, "manifest.jsonl", []byte(line)); err != nil {
+					t.Fatalf("Append() returned an unexpected error: %v", err)
+				}
+			}
+			object, err := test.backend.Get(ctx, "manifest.jsonl")
+			if err != nil {
+				t.Fatalf("Get() returned an unexpected error: %v", err)
+			}
+			defer func() {
+				_ = object.Close()
+			}()
+			got, _ := io.ReadAll(object)
+			if string(got) != "first\nsecond\n" {
+				t.Errorf("Expected both lines in order, but got %q", got)
+			}
+		})
+	}
+}
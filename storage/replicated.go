@@ -0,0 +1,473 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+)
+
+// ReplicationPolicy Decides whether a write to several destinations succeeded
+type ReplicationPolicy string
+
+const (
+	// ReplicateToAll requires every destination to store the object
+	ReplicateToAll ReplicationPolicy = "all"
+	// ReplicateToQuorum requires more than half of the destinations to store the object
+	ReplicateToQuorum ReplicationPolicy = "quorum"
+	// ReplicateToPrimary requires the first destination to store the object and tries the rest on a best-effort basis
+	ReplicateToPrimary ReplicationPolicy = "primary"
+)
+
+// Destination A named Backend that objects are replicated to
+type Destination struct {
+	Name    string
+	Backend Backend
+}
+
+// ReplicatedConfig The destinations to replicate objects to and how to decide a write succeeded
+type ReplicatedConfig struct {
+	Destinations []Destination // The first destination is the primary
+	Policy       ReplicationPolicy
+	// IsRecord reports whether key is an archived record that should be stored with PutRecord when it is copied to a
+	// destination that missed it. Nil treats every object as a plain file.
+	IsRecord func(key string) bool
+	// Verify checks the copy of the record for key in backend against the checksum recorded for it, so a damaged copy
+	// is never read or copied to another destination. Nil trusts every copy.
+	Verify func(ctx context.Context, backend Backend, key string) error
+	// OnWrite is called with the outcome of every write to a destination, including copies made by CatchUp
+	OnWrite func(destination string, err error)
+}
+
+// Replicated A Backend that stores every object in several destinations. Reads are served by whichever destination
+// has a sound copy of the object, and CatchUp copies objects to destinations that missed them.
+type Replicated struct {
+	destinations []Destination
+	policy       ReplicationPolicy
+	isRecord     func(key string) bool
+	verify       func(ctx context.Context, backend Backend, key string) error
+	onWrite      func(destination string, err error)
+}
+
+// NewReplicated creates a Backend replicating objects to every destination in config
+func NewReplicated(config ReplicatedConfig) (*Replicated, error) {
+	if len(config.Destinations) == 0 {
+		return nil, fmt.Errorf("replication needs at least one destination")
+	}
+	seen := make(map[string]bool)
+	for _, destination := range config.Destinations {
+		if destination.Name == "" || seen[destination.Name] {
+			return nil, fmt.Errorf("every replication destination needs a unique name, but got %q", destination.Name)
+		}
+		seen[destination.Name] = true
+	}
+	policy := config.Policy
+	switch policy {
+	case "":
+		policy = ReplicateToAll
+	case ReplicateToAll, ReplicateToQuorum, ReplicateToPrimary:
+	default:
+		return nil, fmt.Errorf("unknown replication policy %q, expected all, quorum or primary", config.Policy)
+	}
+	return &Replicated{
+		destinations: config.Destinations,
+		policy:       policy,
+		isRecord:     config.IsRecord,
+		verify:       config.Verify,
+		onWrite:      config.OnWrite,
+	}, nil
+}
+
+// Destinations returns the destinations objects are replicated to, primary first
+func (r *Replicated) Destinations() []Destination {
+	return r.destinations
+}
+
+// Location returns where key is stored in the primary destination
+func (r *Replicated) Location(key string) string {
+	return r.destinations[0].Backend.Location(key)
+}
+
+// isRecordKey reports whether key holds an archived record
+func (r *Replicated) isRecordKey(key string) bool {
+	return r.isRecord != nil && r.isRecord(key)
+}
+
+// reportWrite passes the outcome of a write to a destination on to OnWrite
+func (r *Replicated) reportWrite(destination string, err error) {
+	if r.onWrite != nil {
+		r.onWrite(destination, err)
+	}
+}
+
+// Put stores r in every destination and succeeds if the replication policy is met
+func (r *Replicated) Put(ctx context.Context, key string, reader io.Reader, size int64) error {
+	return r.write(ctx, key, reader, func(backend Backend, reader io.Reader) error {
+		return backend.Put(ctx, key, reader, size)
+	})
+}
+
+// PutRetained stores r in every destination like Put, protecting it in each destination that supports retention
+func (r *Replicated) PutRetained(ctx context.Context, key string, reader io.Reader, size int64) error {
+	return r.write(ctx, key, reader, func(backend Backend, reader io.Reader) error {
+		return PutRecord(ctx, backend, key, reader, size)
+	})
+}
+
+// write stores reader in each destination in turn with put, rewinding it between destinations, and applies the policy
+func (r *Replicated) write(ctx context.Context, key string, reader io.Reader, put func(Backend, io.Reader) error) error {
+	if len(r.destinations) == 1 {
+		err := put(r.destinations[0].Backend, reader)
+		r.reportWrite(r.destinations[0].Name, err)
+		return err
+	}
+
+	seeker, ok := reader.(io.ReadSeeker)
+	if !ok {
+		// Everything the downloader stores can be rewound, so this only buffers small files
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read %s for replication: %w", key, err)
+		}
+		seeker = bytes.NewReader(data)
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to read %s for replication: %w", key, err)
+	}
+
+	failed := make(map[int]error)
+	for i, destination := range r.destinations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind %s for replication: %w", key, err)
+		}
+		err := put(destination.Backend, seeker)
+		r.reportWrite(destination.Name, err)
+		if err != nil {
+			failed[i] = fmt.Errorf("%s: %w", destination.Name, err)
+		}
+	}
+	return r.decide(fmt.Sprintf("store %s", r.Location(key)), failed)
+}
+
+// decide applies the replication policy to the failures of an operation run against every destination, keyed by
+// destination index. Failures the policy tolerates are logged, since CatchUp will repair them on the next cycle.
+func (r *Replicated) decide(action string, failed map[int]error) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	var errs []error
+	for i := range r.destinations {
+		if err, ok := failed[i]; ok {
+			errs = append(errs, err)
+		}
+	}
+	succeeded := len(r.destinations) - len(failed)
+	_, primaryFailed := failed[0]
+	met := false
+	switch r.policy {
+	case ReplicateToQuorum:
+		met = succeeded*2 > len(r.destinations)
+	case ReplicateToPrimary:
+		met = !primaryFailed
+	}
+	if !met {
+		return fmt.Errorf("failed to %s in %d of %d destinations, which does not meet the %s replication policy: %w",
+			action, len(failed), len(r.destinations), r.policy, errors.Join(errs...))
+	}
+	log.Printf("Warning: failed to %s in %d of %d destinations, which will be caught up later: %v", action, len(failed), len(r.destinations), errors.Join(errs...))
+	return nil
+}
+
+// Stat describes the object for key from the first destination, in order, that has it
+func (r *Replicated) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	var firstErr error
+	for _, destination := range r.destinations {
+		info, err := destination.Backend.Stat(ctx, key)
+		if err == nil {
+			return info, nil
+		}
+		firstErr = moreSerious(firstErr, err)
+	}
+	return ObjectInfo{}, firstErr
+}
+
+// moreSerious returns whichever of two errors matters more, since a destination that can't be reached matters more
+// than one that doesn't have the object
+func moreSerious(current error, err error) error {
+	if current == nil || (errors.Is(current, ErrNotExist) && !errors.Is(err, ErrNotExist)) {
+		return err
+	}
+	return current
+}
+
+// List describes every object whose key starts with prefix in any destination, using the copy in the first
+// destination, in order, that has it
+func (r *Replicated) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	listed := make(map[string]ObjectInfo)
+	var errs []error
+	for _, destination := range r.destinations {
+		objects, err := destination.Backend.List(ctx, prefix)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, object := range objects {
+			if _, ok := listed[object.Key]; !ok {
+				listed[object.Key] = object
+			}
+		}
+	}
+	if len(errs) == len(r.destinations) {
+		return nil, errors.Join(errs...)
+	}
+	objects := make([]ObjectInfo, 0, len(listed))
+	for _, object := range listed {
+		objects = append(objects, object)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// Get opens a sound copy of the object for key. A record is read from the first destination, in order, whose copy
+// matches its recorded checksum. Every other object, such as the manifest and ledger, only ever grows as entries are
+// appended, so the longest copy is read as long as every other copy is the start of it.
+func (r *Replicated) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if len(r.destinations) == 1 {
+		return r.destinations[0].Backend.Get(ctx, key)
+	}
+	if r.isRecordKey(key) {
+		source, _, err := r.verifiedSource(ctx, key, r.destinations)
+		if err != nil {
+			return nil, err
+		}
+		return source.Backend.Get(ctx, key)
+	}
+	data, err := r.longestCopy(ctx, key, r.destinations)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// verifiedSource returns the first of destinations whose copy of the record for key matches its recorded checksum,
+// and the size of that copy
+func (r *Replicated) verifiedSource(ctx context.Context, key string, destinations []Destination) (Destination, int64, error) {
+	var firstErr error
+	for _, destination := range destinations {
+		info, err := destination.Backend.Stat(ctx, key)
+		if err != nil {
+			firstErr = moreSerious(firstErr, err)
+			continue
+		}
+		if r.verify != nil {
+			if err := r.verify(ctx, destination.Backend, key); err != nil {
+				log.Printf("Warning: the copy of %s in %s is damaged: %v", key, destination.Name, err)
+				firstErr = moreSerious(firstErr, fmt.Errorf("the copy in %s is damaged: %w", destination.Name, err))
+				continue
+			}
+		}
+		return destination, info.Size, nil
+	}
+	return Destination{}, 0, firstErr
+}
+
+// longestCopy reads the longest copy of the object for key from destinations, failing if any other copy is not the
+// start of it, since then the copies disagree rather than one having missed later appends
+func (r *Replicated) longestCopy(ctx context.Context, key string, destinations []Destination) ([]byte, error) {
+	var longest []byte
+	var longestName string
+	var firstErr error
+	for _, destination := range destinations {
+		data, err := ReadAll(ctx, destination.Backend, key)
+		if err != nil {
+			firstErr = moreSerious(firstErr, err)
+			continue
+		}
+		switch {
+		case longestName == "" || bytes.HasPrefix(data, longest):
+			longest, longestName = data, destination.Name
+		case bytes.HasPrefix(longest, data):
+		default:
+			return nil, fmt.Errorf("the copies of %s in %s and %s disagree and need to be checked by hand", key, longestName, destination.Name)
+		}
+	}
+	if longestName == "" {
+		return nil, firstErr
+	}
+	return longest, nil
+}
+
+// Delete removes the object for key from every destination
+func (r *Replicated) Delete(ctx context.Context, key string) error {
+	var errs []error
+	for _, destination := range r.destinations {
+		if err := destination.Backend.Delete(ctx, key); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", destination.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Append adds data to the end of the object for key. With several destinations the longest copy is rewritten to all of
+// them, so a destination that missed an earlier append is brought up to date. Copies that disagree are left alone.
+func (r *Replicated) Append(ctx context.Context, key string, data []byte) error {
+	if len(r.destinations) == 1 {
+		err := Append(ctx, r.destinations[0].Backend, key, data)
+		r.reportWrite(r.destinations[0].Name, err)
+		return err
+	}
+	return appendByRewriting(ctx, r, key, data)
+}
+
+// Check checks every destination. Destinations the replication policy can do without only log a warning.
+func (r *Replicated) Check(ctx context.Context) error {
+	failed := make(map[int]error)
+	for i, destination := range r.destinations {
+		if err := Check(ctx, destination.Backend); err != nil {
+			failed[i] = fmt.Errorf("%s: %w", destination.Name, err)
+		}
+	}
+	return r.decide("check storage", failed)
+}
+
+// CatchUp copies every object to the destinations that are missing it. Records are copied from a destination whose
+// copy matches its recorded checksum, and other objects from the longest copy that every other copy is the start of.
+// Copies that already exist are never overwritten, and records whose copies differ in size are reported instead. It
+// returns how many copies were made. Destinations that can't be listed are skipped.
+func (r *Replicated) CatchUp(ctx context.Context) (int, error) {
+	if len(r.destinations) < 2 {
+		return 0, nil
+	}
+	sizes := make([]map[string]int64, len(r.destinations))
+	keys := make(map[string]bool)
+	var errs []error
+	for i, destination := range r.destinations {
+		objects, err := destination.Backend.List(ctx, "")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list %s: %w", destination.Name, err))
+			continue
+		}
+		sizes[i] = make(map[string]int64, len(objects))
+		for _, object := range objects {
+			sizes[i][object.Key] = object.Size
+			keys[object.Key] = true
+		}
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	copied := 0
+	for _, key := range sortedKeys {
+		var holders, missing []Destination
+		var holderSize int64
+		sizesDiffer := false
+		for i, destination := range r.destinations {
+			if sizes[i] == nil {
+				continue
+			}
+			size, ok := sizes[i][key]
+			switch {
+			case !ok:
+				missing = append(missing, destination)
+				continue
+			case len(holders) == 0:
+				holderSize = size
+			case size != holderSize:
+				sizesDiffer = true
+			}
+			holders = append(holders, destination)
+		}
+		record := r.isRecordKey(key)
+		if record && sizesDiffer {
+			errs = append(errs, fmt.Errorf("the copies of %s differ in size and need to be checked by hand", key))
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return copied, err
+		}
+		made, err := r.copyMissing(ctx, key, record, holders, missing)
+		copied += made
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return copied, errors.Join(errs...)
+}
+
+// copyMissing copies the object for key from a sound copy in holders to every destination in missing and returns how
+// many copies were made
+func (r *Replicated) copyMissing(ctx context.Context, key string, record bool, holders []Destination, missing []Destination) (int, error) {
+	var source Destination
+	var size int64
+	var data []byte
+	var err error
+	if record {
+		source, size, err = r.verifiedSource(ctx, key, holders)
+	} else {
+		data, err = r.longestCopy(ctx, key, holders)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a sound copy of %s to copy: %w", key, err)
+	}
+
+	copied := 0
+	var errs []error
+	for _, destination := range missing {
+		if record {
+			err = r.copyRecord(ctx, key, size, source.Backend, destination.Backend)
+		} else {
+			err = destination.Backend.Put(ctx, key, bytes.NewReader(data), int64(len(data)))
+		}
+		r.reportWrite(destination.Name, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to copy %s to %s: %w", key, destination.Name, err))
+			continue
+		}
+		copied++
+	}
+	return copied, errors.Join(errs...)
+}
+
+// copyRecord copies the record for key from source to target, protecting it like the original upload was
+func (r *Replicated) copyRecord(ctx context.Context, key string, size int64, source Backend, target Backend) error {
+	object, err := source.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := object.Close(); err != nil {
+			log.Printf("Warning: failed to close %s: %v", source.Location(key), err)
+		}
+	}()
+	return PutRecord(ctx, target, key, object, size)
+}
+
+// Close disconnects from every destination that holds a connection open
+func (r *Replicated) Close() error {
+	var errs []error
+	for _, destination := range r.destinations {
+		if closer, ok := destination.Backend.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", destination.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
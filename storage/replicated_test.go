@@ -0,0 +1,356 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// unavailable A Backend that fails every call, like a destination whose server is down
+type unavailable struct {
+	Backend
+}
+
+var errUnavailable = errors.New("connection refused")
+
+func (u unavailable) Put(context.Context, string, io.Reader, int64) error { return errUnavailable }
+func (u unavailable) Stat(context.Context, string) (ObjectInfo, error) {
+	return ObjectInfo{}, errUnavailable
+}
+func (u unavailable) List(context.Context, string) ([]ObjectInfo, error) { return nil, errUnavailable }
+func (u unavailable) Get(context.Context, string) (io.ReadCloser, error) { return nil, errUnavailable }
+func (u unavailable) Delete(context.Context, string) error               { return errUnavailable }
+
+// failingChecker A Backend whose Check always fails, like a bucket that was deleted
+type failingChecker struct {
+	Backend
+}
+
+func (f failingChecker) Check(context.Context) error { return errUnavailable }
+
+// writeRecorder Counts the outcome of every write reported to OnWrite by destination
+type writeRecorder struct {
+	mu       sync.Mutex
+	uploads  map[string]int
+	failures map[string]int
+}
+
+func newWriteRecorder() *writeRecorder {
+	return &writeRecorder{uploads: make(map[string]int), failures: make(map[string]int)}
+}
+
+func (w *writeRecorder) onWrite(destination string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err != nil {
+		w.failures[destination]++
+		return
+	}
+	w.uploads[destination]++
+}
+
+// TestReplicatedPut validates that each replication policy decides the outcome of a write the way it promises
+func TestReplicatedPut(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  ReplicationPolicy
+		down    []bool // Whether each destination is unavailable
+		wantErr bool
+	}{
+		{name: "All with every destination", policy: ReplicateToAll, down: []bool{false, false, false}, wantErr: false},
+		{name: "All with one down", policy: ReplicateToAll, down: []bool{false, false, true}, wantErr: true},
+		{name: "Quorum with one down", policy: ReplicateToQuorum, down: []bool{true, false, false}, wantErr: false},
+		{name: "Quorum with two down", policy: ReplicateToQuorum, down: []bool{false, true, true}, wantErr: true},
+		{name: "Quorum of two with one down", policy: ReplicateToQuorum, down: []bool{false, true}, wantErr: true},
+		{name: "Primary with the rest down", policy: ReplicateToPrimary, down: []bool{false, true, true}, wantErr: false},
+		{name: "Primary down", policy: ReplicateToPrimary, down: []bool{true, false, false}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var destinations []Destination
+			var dirs []string
+			for i, down := range test.down {
+				dir := t.TempDir()
+				dirs = append(dirs, dir)
+				var backend Backend = NewLocal(dir)
+				if down {
+					backend = unavailable{backend}
+				}
+				destinations = append(destinations, Destination{Name: string(rune('a' + i)), Backend: backend})
+			}
+			recorder := newWriteRecorder()
+			replicated, err := NewReplicated(ReplicatedConfig{Destinations: destinations, Policy: test.policy, OnWrite: recorder.onWrite})
+			if err != nil {
+				t.Fatalf("NewReplicated() returned an unexpected error: %v", err)
+			}
+
+			content := "Guns. Lots of guns."
+			err = replicated.Put(context.Background(), "2025/BOOK.pdf", strings.NewReader(content), int64(len(content)))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Put() error = %v, wantErr %v", err, test.wantErr)
+			}
+			for i, down := range test.down {
+				name := destinations[i].Name
+				stored, readErr := os.ReadFile(filepath.Join(dirs[i], "2025", "BOOK.pdf"))
+				if down {
+					if recorder.failures[name] != 1 {
+						t.Errorf("Expected one failure to be reported for %s, but got %d", name, recorder.failures[name])
+					}
+					continue
+				}
+				// Every reachable destination gets a full copy, even when the write as a whole failed
+				if readErr != nil || string(stored) != content {
+					t.Errorf("Expected %s to store the book, but got %q (%v)", name, stored, readErr)
+				}
+				if recorder.uploads[name] != 1 {
+					t.Errorf("Expected one upload to be reported for %s, but got %d", name, recorder.uploads[name])
+				}
+			}
+		})
+	}
+}
+
+// TestReplicated validates reading, listing, appending and deleting across destinations that have drifted apart
+func TestReplicated(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := NewLocal(t.TempDir()), NewLocal(t.TempDir())
+	replicated, err := NewReplicated(ReplicatedConfig{
+		Destinations: []Destination{{Name: "local", Backend: primary}, {Name: "offsite", Backend: putOnly{secondary}}},
+	})
+	if err != nil {
+		t.Fatalf("NewReplicated() returned an unexpected error: %v", err)
+	}
+
+	// The secondary missed the second line of the manifest and only it has the older book
+	if err := primary.Put(ctx, "manifest.jsonl", strings.NewReader("one\ntwo\n"), -1); err != nil {
+		t.Fatalf("Put() returned an unexpected error: %v", err)
+	}
+	if err := secondary.Put(ctx, "manifest.jsonl", strings.NewReader("one\n"), -1); err != nil {
+		t.Fatalf("Put() returned an unexpected error: %v", err)
+	}
+	if err := secondary.Put(ctx, "2024/BOOK.pdf", strings.NewReader("Guns."), -1); err != nil {
+		t.Fatalf("Put() returned an unexpected error: %v", err)
+	}
+
+	if info, err := replicated.Stat(ctx, "2024/BOOK.pdf"); err != nil || info.Size != 5 {
+		t.Errorf("Expected Stat() to find the book in the secondary, but got %+v (%v)", info, err)
+	}
+	if _, err := replicated.Stat(ctx, "MISSING.pdf"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Expected a missing file to be reported as missing, but got %v", err)
+	}
+	objects, err := replicated.List(ctx, "")
+	if err != nil || len(objects) != 2 || objects[0].Key != "2024/BOOK.pdf" || objects[1].Key != "manifest.jsonl" || objects[1].Size != 8 {
+		t.Errorf("Expected List() to merge both destinations, but got %+v (%v)", objects, err)
+	}
+
+	if err := replicated.Append(ctx, "manifest.jsonl", []byte("three\n")); err != nil {
+		t.Fatalf("Append() returned an unexpected error: %v", err)
+	}
+	for _, backend := range []Backend{primary, secondary} {
+		if manifest, err := ReadAll(ctx, backend, "manifest.jsonl"); err != nil || string(manifest) != "one\ntwo\nthree\n" {
+			t.Errorf("Expected %s to hold every line, but got %q (%v)", backend.Location("manifest.jsonl"), manifest, err)
+		}
+	}
+	if location := replicated.Location("manifest.jsonl"); location != primary.Location("manifest.jsonl") {
+		t.Errorf("Expected the location of the primary, but got %q", location)
+	}
+
+	if err := replicated.Delete(ctx, "2024/BOOK.pdf"); err != nil {
+		t.Errorf("Delete() returned an unexpected error: %v", err)
+	}
+	if _, err := replicated.Get(ctx, "2024/BOOK.pdf"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Expected a deleted file to be missing, but got %v", err)
+	}
+}
+
+// TestReplicatedCatchUp validates that destinations which missed copies are brought up to date
+func TestReplicatedCatchUp(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := NewLocal(t.TempDir()), NewLocal(t.TempDir())
+	var retained []string
+	recorder := newWriteRecorder()
+	replicated, err := NewReplicated(ReplicatedConfig{
+		Destinations: []Destination{{Name: "local", Backend: primary}, {Name: "offsite", Backend: secondary}},
+		Policy:       ReplicateToPrimary,
+		IsRecord: func(key string) bool {
+			retained = append(retained, key)
+			return strings.HasSuffix(key, ".pdf")
+		},
+		OnWrite: recorder.onWrite,
+	})
+	if err != nil {
+		t.Fatalf("NewReplicated() returned an unexpected error: %v", err)
+	}
+
+	for key, content := range map[string]string{"2025/BOOK.pdf": "Guns. Lots of guns.", "manifest.jsonl": "one\ntwo\n"} {
+		if err := primary.Put(ctx, key, strings.NewReader(content), -1); err != nil {
+			t.Fatalf("Put() returned an unexpected error: %v", err)
+		}
+	}
+	if err := secondary.Put(ctx, "manifest.jsonl", strings.NewReader("one\n"), -1); err != nil {
+		t.Fatalf("Put() returned an unexpected error: %v", err)
+	}
+	if err := secondary.Put(ctx, "2024/BOOK.pdf", strings.NewReader("Guns."), -1); err != nil {
+		t.Fatalf("Put() returned an unexpected error: %v", err)
+	}
+
+	copied, err := replicated.CatchUp(ctx)
+	if err != nil || copied != 2 {
+		t.Fatalf("Expected CatchUp() to make 2 copies, but got %d (%v)", copied, err)
+	}
+	for _, backend := range []Backend{primary, secondary} {
+		objects, err := backend.List(ctx, "")
+		if err != nil || len(objects) != 3 {
+			t.Errorf("Expected every object in %s, but got %+v (%v)", backend.Location(""), objects, err)
+		}
+	}
+	// A copy that already exists is never overwritten. The shorter manifest is brought up to date by the next append.
+	if manifest, _ := ReadAll(ctx, secondary, "manifest.jsonl"); string(manifest) != "one\n" {
+		t.Errorf("Expected the secondary manifest to be left alone, but got %q", manifest)
+	}
+	if recorder.uploads["local"] != 1 || recorder.uploads["offsite"] != 1 {
+		t.Errorf("Expected each copy to be reported, but got %v", recorder.uploads)
+	}
+	if len(retained) != 3 {
+		t.Errorf("Expected IsRecord() to be asked about each key, but got %v", retained)
+	}
+
+	if copied, err := replicated.CatchUp(ctx); err != nil || copied != 0 {
+		t.Errorf("Expected nothing left to copy, but got %d (%v)", copied, err)
+	}
+
+	// A destination that is down is skipped and the rest are still caught up
+	down, err := NewReplicated(ReplicatedConfig{
+		Destinations: []Destination{{Name: "local", Backend: primary}, {Name: "offsite", Backend: unavailable{secondary}}, {Name: "empty", Backend: NewLocal(t.TempDir())}},
+	})
+	if err != nil {
+		t.Fatalf("NewReplicated() returned an unexpected error: %v", err)
+	}
+	if copied, err := down.CatchUp(ctx); err == nil || copied != 3 {
+		t.Errorf("Expected 3 copies and an error for the unavailable destination, but got %d (%v)", copied, err)
+	}
+}
+
+// TestReplicated_DamagedCopy validates that a damaged copy is never read or copied, even when it is the largest one, and
+// that copies which disagree are reported rather than overwritten
+func TestReplicated_DamagedCopy(t *testing.T) {
+	ctx := context.Background()
+	content := "Guns. Lots of guns."
+	recorded := sha256.Sum256([]byte(content))
+	verify := func(ctx context.Context, backend Backend, key string) error {
+		stored, err := ReadAll(ctx, backend, key)
+		if err != nil {
+			return err
+		}
+		if sha256.Sum256(stored) != recorded {
+			return errors.New("checksum mismatch")
+		}
+		return nil
+	}
+
+	damaged, sound, empty := NewLocal(t.TempDir()), NewLocal(t.TempDir()), NewLocal(t.TempDir())
+	replicated, err := NewReplicated(ReplicatedConfig{
+		Destinations: []Destination{{Name: "damaged", Backend: damaged}, {Name: "sound", Backend: sound}, {Name: "empty", Backend: empty}},
+		IsRecord:     func(key string) bool { return strings.HasSuffix(key, ".pdf") },
+		Verify:       verify,
+	})
+	if err != nil {
+		t.Fatalf("NewReplicated() returned an unexpected error: %v", err)
+	}
+	objects := []struct {
+		backend Backend
+		key     string
+		content string
+	}{
+		{backend: damaged, key: "2025/BOOK.pdf", content: content + " Tampered with."},
+		{backend: sound, key: "2025/BOOK.pdf", content: content},
+		{backend: damaged, key: "2025/BOOK.pdf.sig", content: "forged"},
+		{backend: sound, key: "2025/BOOK.pdf.sig", content: "signed"},
+	}
+	for _, object := range objects {
+		if err := object.backend.Put(ctx, object.key, strings.NewReader(object.content), -1); err != nil {
+			t.Fatalf("Put() returned an unexpected error: %v", err)
+		}
+	}
+
+	if book, err := ReadAll(ctx, replicated, "2025/BOOK.pdf"); err != nil || string(book) != content {
+		t.Errorf("Expected Get() to read the sound copy, but got %q (%v)", book, err)
+	}
+	if _, err := replicated.Get(ctx, "2025/BOOK.pdf.sig"); err == nil {
+		t.Errorf("Expected Get() to report signatures that disagree, but it did not")
+	}
+
+	copied, err := replicated.CatchUp(ctx)
+	if err == nil || copied != 1 {
+		t.Errorf("Expected CatchUp() to copy the sound book and report the rest, but got %d (%v)", copied, err)
+	}
+	if book, err := ReadAll(ctx, empty, "2025/BOOK.pdf"); err != nil || string(book) != content {
+		t.Errorf("Expected the sound copy in the empty destination, but got %q (%v)", book, err)
+	}
+	if book, _ := ReadAll(ctx, damaged, "2025/BOOK.pdf"); string(book) != content+" Tampered with." {
+		t.Errorf("Expected the damaged copy to be left for a person to check, but got %q", book)
+	}
+	if _, err := empty.Stat(ctx, "2025/BOOK.pdf.sig"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Expected signatures that disagree not to be copied, but got %v", err)
+	}
+}
+
+// TestReplicatedCheck validates that Check only fails when the replication policy can't be met
+func TestReplicatedCheck(t *testing.T) {
+	local := NewLocal(t.TempDir())
+	broken := failingChecker{local}
+	tests := []struct {
+		name    string
+		policy  ReplicationPolicy
+		wantErr bool
+	}{
+		{name: "All", policy: ReplicateToAll, wantErr: true},
+		{name: "Primary", policy: ReplicateToPrimary, wantErr: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			replicated, err := NewReplicated(ReplicatedConfig{
+				Destinations: []Destination{{Name: "local", Backend: local}, {Name: "broken", Backend: broken}},
+				Policy:       test.policy,
+			})
+			if err != nil {
+				t.Fatalf("NewReplicated() returned an unexpected error: %v", err)
+			}
+			if err := replicated.Check(context.Background()); (err != nil) != test.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+// TestNewReplicated_Invalid validates that unusable replication settings are refused
+func TestNewReplicated_Invalid(t *testing.T) {
+	local := NewLocal(t.TempDir())
+	tests := []struct {
+		name   string
+		config ReplicatedConfig
+	}{
+		{name: "No destinations", config: ReplicatedConfig{}},
+		{name: "Unnamed destination", config: ReplicatedConfig{Destinations: []Destination{{Backend: local}}}},
+		{name: "Duplicate names", config: ReplicatedConfig{Destinations: []Destination{{Name: "local", Backend: local}, {Name: "local", Backend: local}}}},
+		{name: "Unknown policy", config: ReplicatedConfig{Destinations: []Destination{{Name: "local", Backend: local}}, Policy: "most"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewReplicated(test.config); err == nil {
+				t.Errorf("Expected NewReplicated() to fail, but it did not")
+			}
+		})
+	}
+}
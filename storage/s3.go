@@ -0,0 +1,310 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// minimumS3PartSize is the smallest part S3 accepts in a multipart upload, other than the last one
+const minimumS3PartSize = 5 * 1024 * 1024
+
+// DefaultS3PartSize is the size of each part of a multipart upload unless overridden in S3Config
+const DefaultS3PartSize = 16 * 1024 * 1024
+
+// S3Config Where and how to connect to an S3 compatible bucket
+type S3Config struct {
+	Endpoint             string // Host and optional port, or a URL. An http:// URL disables TLS. Defaults to AWS S3.
+	Bucket               string
+	Prefix               string // Prepended to every key, for sharing a bucket
+	Region               string
+	PathStyle            bool   // Address the bucket as part of the path instead of the host name, as MinIO usually needs
+	AccessKeyID          string // Leave blank to use the AWS environment variables, credentials file or instance role
+	SecretAccessKey      string
+	SessionToken         string
+	ServerSideEncryption string // Blank, "AES256" or "aws:kms"
+	KMSKeyID             string // Key for "aws:kms", blank for the bucket's default key
+	PartSize             uint64 // Size of each part when uploading large files in several parts
+	ObjectLockMode       string // Blank, "GOVERNANCE" or "COMPLIANCE" to apply Object Lock retention to archived records
+	RetentionPeriod      time.Duration
+	LegalHold            bool // Place a legal hold on archived records
+	Transport            http.RoundTripper
+}
+
+// S3 A Backend that stores objects in an S3 compatible bucket
+type S3 struct {
+	client     *minio.Client
+	bucket     string
+	prefix     string
+	partSize   uint64
+	encryption encrypt.ServerSide
+	lockMode   minio.RetentionMode
+	retention  time.Duration
+	legalHold  bool
+}
+
+// NewS3 creates a Backend storing objects in an S3 compatible bucket. It does not contact the bucket.
+func NewS3(config S3Config) (*S3, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is blank")
+	}
+	endpoint, secure, err := parseS3Endpoint(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	options := &minio.Options{
+		Creds:     s3Credentials(config),
+		Secure:    secure,
+		Region:    config.Region,
+		Transport: config.Transport,
+	}
+	if config.PathStyle {
+		options.BucketLookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(endpoint, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client for %s: %w", endpoint, err)
+	}
+
+	backend := &S3{
+		client:   client,
+		bucket:   config.Bucket,
+		prefix:   strings.Trim(config.Prefix, "/"),
+		partSize: config.PartSize,
+	}
+	if backend.partSize == 0 {
+		backend.partSize = DefaultS3PartSize
+	}
+	if backend.partSize < minimumS3PartSize {
+		return nil, fmt.Errorf("s3 part size must be at least %d bytes", minimumS3PartSize)
+	}
+	if config.ObjectLockMode != "" {
+		backend.lockMode = minio.RetentionMode(strings.ToUpper(config.ObjectLockMode))
+		if !backend.lockMode.IsValid() {
+			return nil, fmt.Errorf("unknown s3 object lock mode %q, expected GOVERNANCE or COMPLIANCE", config.ObjectLockMode)
+		}
+		if config.RetentionPeriod <= 0 {
+			return nil, fmt.Errorf("s3 object lock mode %s needs a retention period", backend.lockMode)
+		}
+		backend.retention = config.RetentionPeriod
+	}
+	backend.legalHold = config.LegalHold
+	switch config.ServerSideEncryption {
+	case "":
+	case "AES256":
+		backend.encryption = encrypt.NewSSE()
+	case "aws:kms":
+		if backend.encryption, err = encrypt.NewSSEKMS(config.KMSKeyID, nil); err != nil {
+			return nil, fmt.Errorf("invalid s3 kms settings: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown s3 server side encryption %q, expected AES256 or aws:kms", config.ServerSideEncryption)
+	}
+	return backend, nil
+}
+
+// parseS3Endpoint splits an endpoint that may be a URL into the host minio expects and whether to use TLS
+func parseS3Endpoint(endpoint string) (string, bool, error) {
+	if endpoint == "" {
+		return "s3.amazonaws.com", true, nil
+	}
+	if !strings.Contains(endpoint, "://") {
+		return endpoint, true, nil
+	}
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid s3 endpoint %q: %w", endpoint, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", false, fmt.Errorf("invalid s3 endpoint %q: scheme must be http or https", endpoint)
+	}
+	if strings.Trim(parsed.Path, "/") != "" {
+		return "", false, fmt.Errorf("invalid s3 endpoint %q: use prefix rather than a path", endpoint)
+	}
+	return parsed.Host, parsed.Scheme == "https", nil
+}
+
+// s3Credentials uses the configured keys, or else the same sources as the AWS tools
+func s3Credentials(config S3Config) *credentials.Credentials {
+	if config.AccessKeyID != "" {
+		return credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, config.SessionToken)
+	}
+	return credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.FileAWSCredentials{},
+		&credentials.IAM{},
+	})
+}
+
+// Location returns the s3:// URL of key
+func (s *S3) Location(key string) string {
+	return "s3://" + s.bucket + "/" + path.Join(s.prefix, key)
+}
+
+// objectName returns the name of the object for key after checking it is valid
+func (s *S3) objectName(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(s.prefix, cleaned), nil
+}
+
+// Put uploads r, using a multipart upload for files larger than the part size or of unknown size.
+// S3 only makes an object visible once its upload has completed.
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	return s.put(ctx, key, r, size, s.putOptions(key))
+}
+
+// PutRetained uploads r like Put and applies the configured Object Lock retention and legal hold to it
+func (s *S3) PutRetained(ctx context.Context, key string, r io.Reader, size int64) error {
+	options := s.putOptions(key)
+	if s.lockMode != "" {
+		options.Mode = s.lockMode
+		options.RetainUntilDate = time.Now().Add(s.retention).UTC()
+	}
+	if s.legalHold {
+		options.LegalHold = minio.LegalHoldEnabled
+	}
+	// S3 refuses locked uploads without an integrity check
+	options.SendContentMd5 = options.Mode != "" || options.LegalHold != ""
+	return s.put(ctx, key, r, size, options)
+}
+
+// putOptions returns the upload options shared by every object
+func (s *S3) putOptions(key string) minio.PutObjectOptions {
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return minio.PutObjectOptions{
+		ContentType:          contentType,
+		PartSize:             s.partSize,
+		ServerSideEncryption: s.encryption,
+	}
+}
+
+// put uploads r under key with options
+func (s *S3) put(ctx context.Context, key string, r io.Reader, size int64, options minio.PutObjectOptions) error {
+	objectName, err := s.objectName(key)
+	if err != nil {
+		return err
+	}
+	if _, err := s.client.PutObject(ctx, s.bucket, objectName, r, size, options); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", s.Location(key), err)
+	}
+	return nil
+}
+
+// Check confirms the bucket exists and, when retention or legal holds are configured, that it has Object Lock enabled.
+// Object Lock can only be turned on for a bucket with versioning, so uploads to a bucket without it would not be protected.
+func (s *S3) Check(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("failed to check s3 bucket %s: %w", s.bucket, err)
+	}
+	if !exists {
+		return fmt.Errorf("s3 bucket %s does not exist", s.bucket)
+	}
+	if s.lockMode == "" && !s.legalHold {
+		return nil
+	}
+	objectLock, _, _, _, err := s.client.GetObjectLockConfig(ctx, s.bucket)
+	if minio.ToErrorResponse(err).Code == "ObjectLockConfigurationNotFoundError" {
+		return fmt.Errorf("s3 bucket %s does not have object lock enabled", s.bucket)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the object lock configuration of s3 bucket %s: %w", s.bucket, err)
+	}
+	if objectLock != "Enabled" {
+		return fmt.Errorf("s3 bucket %s does not have object lock enabled", s.bucket)
+	}
+	return nil
+}
+
+// Stat describes the object for key with a HEAD request
+func (s *S3) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	objectName, err := s.objectName(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := s.client.StatObject(ctx, s.bucket, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, s.wrapErr("stat", key, err)
+	}
+	return ObjectInfo{Key: key, Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+// List describes every object in the bucket under the configured prefix whose key starts with prefix
+func (s *S3) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	listPrefix := prefix
+	if s.prefix != "" {
+		listPrefix = s.prefix + "/" + prefix
+	}
+	var objects []ObjectInfo
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: listPrefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", s.Location(prefix), object.Err)
+		}
+		key := object.Key
+		if s.prefix != "" {
+			key = strings.TrimPrefix(key, s.prefix+"/")
+		}
+		objects = append(objects, ObjectInfo{Key: key, Size: object.Size, ModTime: object.LastModified})
+	}
+	return objects, nil
+}
+
+// Get downloads the object for key
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	objectName, err := s.objectName(key)
+	if err != nil {
+		return nil, err
+	}
+	object, err := s.client.GetObject(ctx, s.bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.wrapErr("download", key, err)
+	}
+	// GetObject is lazy, so check the object exists before handing it back
+	if _, err := object.Stat(); err != nil {
+		_ = object.Close()
+		return nil, s.wrapErr("download", key, err)
+	}
+	return object, nil
+}
+
+// Delete removes the object for key
+func (s *S3) Delete(ctx context.Context, key string) error {
+	objectName, err := s.objectName(key)
+	if err != nil {
+		return err
+	}
+	if err := s.client.RemoveObject(ctx, s.bucket, objectName, minio.RemoveObjectOptions{}); err != nil {
+		return s.wrapErr("delete", key, err)
+	}
+	return nil
+}
+
+// wrapErr describes a failed request, marking missing objects with ErrNotExist
+func (s *S3) wrapErr(action string, key string, err error) error {
+	response := minio.ToErrorResponse(err)
+	if response.StatusCode == http.StatusNotFound || response.Code == "NoSuchKey" {
+		return fmt.Errorf("failed to %s %s: %w", action, s.Location(key), ErrNotExist)
+	}
+	return fmt.Errorf("failed to %s %s: %w", action, s.Location(key), err)
+}
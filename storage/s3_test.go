@@ -0,0 +1,294 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newS3MockServer starts an in-memory S3 server with a "books" bucket and returns it with a log of the requests it received.
+// Requests intercept returns true for have already been answered and are not passed on to the in-memory server.
+func newS3MockServer(t *testing.T, intercept func(w http.ResponseWriter, r *http.Request) bool) (*httptest.Server, func() []string) {
+	memoryBackend := s3mem.New()
+	if err := memoryBackend.CreateBucket("books"); err != nil {
+		t.Fatalf("Failed to create mock bucket: %v", err)
+	}
+	faker := gofakes3.New(memoryBackend).Server()
+
+	var mu sync.Mutex
+	var requests []string
+	// Serve over TLS, because over plain HTTP minio signs each chunk of an upload part and the mock server can't decode that
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		mu.Unlock()
+		if intercept != nil && intercept(w, r) {
+			return
+		}
+		faker.ServeHTTP(w, r)
+	}))
+	t.Cleanup(mockServer.Close)
+	return mockServer, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requests...)
+	}
+}
+
+// newTestS3 creates an S3 backend for the mock server
+func newTestS3(t *testing.T, mockServer *httptest.Server, prefix string) *S3 {
+	return newTestS3WithConfig(t, mockServer, S3Config{Prefix: prefix})
+}
+
+// newTestS3WithConfig creates an S3 backend for the mock server with extra settings from config
+func newTestS3WithConfig(t *testing.T, mockServer *httptest.Server, config S3Config) *S3 {
+	config.Endpoint = mockServer.URL
+	config.Bucket = "books"
+	config.Region = "us-east-1"
+	config.PathStyle = true
+	config.AccessKeyID = "pgibbons"
+	config.SecretAccessKey = "kkJ4K3dHoHqZzNvoDJ"
+	config.PartSize = minimumS3PartSize
+	config.Transport = mockServer.Client().Transport
+	backend, err := NewS3(config)
+	if err != nil {
+		t.Fatalf("NewS3() returned an unexpected error: %v", err)
+	}
+	return backend
+}
+
+// TestS3 validates storing, describing, listing, reading and deleting objects in a bucket
+func TestS3(t *testing.T) {
+	ctx := context.Background()
+	mockServer, requests := newS3MockServer(t, nil)
+	backend := newTestS3(t, mockServer, "/archive/")
+
+	content := "Guns. Lots of guns."
+	for _, key := range []string{"2025/01/BOOK_1.pdf", "2025/02/BOOK_2.pdf", "4473.pdf"} {
+		if err := backend.Put(ctx, key, strings.NewReader(content), int64(len(content))); err != nil {
+			t.Fatalf("Put(%q) returned an unexpected error: %v", key, err)
+		}
+	}
+
+	t.Run("Test Stat", func(t *testing.T) {
+		info, err := backend.Stat(ctx, "2025/01/BOOK_1.pdf")
+		if err != nil {
+			t.Fatalf("Stat() returned an unexpected error: %v", err)
+		}
+		if info.Size != int64(len(content)) || info.Key != "2025/01/BOOK_1.pdf" {
+			t.Errorf("Unexpected object info: %+v", info)
+		}
+		if _, err := backend.Stat(ctx, "MISSING.pdf"); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Expected ErrNotExist for a missing object, but got: %v", err)
+		}
+		found := false
+		for _, request := range requests() {
+			found = found || request == "HEAD /books/archive/2025/01/BOOK_1.pdf"
+		}
+		if !found {
+			t.Errorf("Expected Stat to use a HEAD request under the prefix, but got %q", requests())
+		}
+	})
+
+	t.Run("Test Get", func(t *testing.T) {
+		got, err := ReadAll(ctx, backend, "2025/02/BOOK_2.pdf")
+		if err != nil || string(got) != content {
+			t.Errorf("Expected %q, but got %q (%v)", content, got, err)
+		}
+		if _, err := backend.Get(ctx, "MISSING.pdf"); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Expected ErrNotExist for a missing object, but got: %v", err)
+		}
+	})
+
+	t.Run("Test List", func(t *testing.T) {
+		objects, err := backend.List(ctx, "2025/")
+		if err != nil {
+			t.Fatalf("List() returned an unexpected error: %v", err)
+		}
+		if len(objects) != 2 || objects[0].Key != "2025/01/BOOK_1.pdf" || objects[1].Key != "2025/02/BOOK_2.pdf" {
+			t.Errorf("Unexpected objects listed: %+v", objects)
+		}
+	})
+
+	t.Run("Test Delete", func(t *testing.T) {
+		if err := backend.Delete(ctx, "4473.pdf"); err != nil {
+			t.Fatalf("Delete() returned an unexpected error: %v", err)
+		}
+		if _, err := backend.Stat(ctx, "4473.pdf"); !errors.Is(err, ErrNotExist) {
+			t.Errorf("Expected the deleted object to be gone, but got: %v", err)
+		}
+	})
+
+	t.Run("Test Append", func(t *testing.T) {
+		for _, line := range []string{"first\n", "second\n"} {
+			if err := Append(ctx, backend, "manifest.jsonl", []byte(line)); err != nil {
+				t.Fatalf("Append() returned an unexpected error: %v", err)
+			}
+		}
+		got, err := ReadAll(ctx, backend, "manifest.jsonl")
+		if err != nil || string(got) != "first\nsecond\n" {
+			t.Errorf("Expected both lines in order, but got %q (%v)", got, err)
+		}
+	})
+
+	if got := backend.Location("2025/01/BOOK_1.pdf"); got != "s3://books/archive/2025/01/BOOK_1.pdf" {
+		t.Errorf("Unexpected location: %s", got)
+	}
+}
+
+// TestS3Put_Multipart validates that files larger than the part size are uploaded in parts
+func TestS3Put_Multipart(t *testing.T) {
+	mockServer, requests := newS3MockServer(t, nil)
+	backend := newTestS3(t, mockServer, "")
+
+	content := bytes.Repeat([]byte("Guns. Lots of guns. "), minimumS3PartSize/10)
+	if err := backend.Put(context.Background(), "LARGE_BOUND_BOOK.pdf", bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("Put() returned an unexpected error: %v", err)
+	}
+	parts := 0
+	for _, request := range requests() {
+		if strings.HasPrefix(request, "PUT ") && strings.Contains(request, "partNumber=") {
+			parts++
+		}
+	}
+	if parts != 2 {
+		t.Errorf("Expected a 2 part upload, but got %d parts: %q", parts, requests())
+	}
+	got, err := ReadAll(context.Background(), backend, "LARGE_BOUND_BOOK.pdf")
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("Expected the uploaded parts to reassemble the file (%v)", err)
+	}
+}
+
+// TestNewS3_Invalid validates that unusable S3 settings are refused
+func TestNewS3_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config S3Config
+	}{
+		{name: "Missing bucket", config: S3Config{Endpoint: "localhost:9000"}},
+		{name: "Unknown encryption", config: S3Config{Bucket: "books", ServerSideEncryption: "rot13"}},
+		{name: "Small parts", config: S3Config{Bucket: "books", PartSize: 1024}},
+		{name: "Endpoint with a path", config: S3Config{Bucket: "books", Endpoint: "https://minio.initech.com/books"}},
+		{name: "Unknown scheme", config: S3Config{Bucket: "books", Endpoint: "ftp://minio.initech.com"}},
+		{name: "Unknown object lock mode", config: S3Config{Bucket: "books", ObjectLockMode: "forever", RetentionPeriod: time.Hour}},
+		{name: "Object lock without retention", config: S3Config{Bucket: "books", ObjectLockMode: "COMPLIANCE"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewS3(test.config); err == nil {
+				t.Errorf("Expected NewS3(%+v) to fail, but it did not", test.config)
+			}
+		})
+	}
+}
+
+// newObjectLockMockServer starts an in-memory S3 server that reports whether Object Lock is enabled on its bucket
+// and records the headers of every upload
+func newObjectLockMockServer(t *testing.T, lockEnabled bool) (*httptest.Server, func() []http.Header) {
+	var mu sync.Mutex
+	var uploads []http.Header
+	mockServer, _ := newS3MockServer(t, func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == "PUT" {
+			mu.Lock()
+			uploads = append(uploads, r.Header.Clone())
+			mu.Unlock()
+			return false
+		}
+		if r.Method != "GET" || !r.URL.Query().Has("object-lock") {
+			return false
+		}
+		if !lockEnabled {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`<Error><Code>ObjectLockConfigurationNotFoundError</Code><Message>Object Lock configuration does not exist for this bucket</Message></Error>`))
+			return true
+		}
+		_, _ = w.Write([]byte(`<ObjectLockConfiguration><ObjectLockEnabled>Enabled</ObjectLockEnabled></ObjectLockConfiguration>`))
+		return true
+	})
+	return mockServer, func() []http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]http.Header(nil), uploads...)
+	}
+}
+
+// TestS3PutRetained validates that archived records are uploaded with Object Lock retention and a legal hold
+func TestS3PutRetained(t *testing.T) {
+	mockServer, uploads := newObjectLockMockServer(t, true)
+	backend := newTestS3WithConfig(t, mockServer, S3Config{ObjectLockMode: "compliance", RetentionPeriod: 24 * time.Hour, LegalHold: true})
+
+	content := "Guns. Lots of guns."
+	started := time.Now()
+	if err := PutRecord(context.Background(), backend, "BOOK.pdf", strings.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("PutRecord() returned an unexpected error: %v", err)
+	}
+	if err := backend.Put(context.Background(), "manifest.jsonl", strings.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("Put() returned an unexpected error: %v", err)
+	}
+
+	headers := uploads()
+	if len(headers) != 2 {
+		t.Fatalf("Expected 2 uploads, but got %d", len(headers))
+	}
+	record := headers[0]
+	if record.Get("X-Amz-Object-Lock-Mode") != "COMPLIANCE" || record.Get("X-Amz-Object-Lock-Legal-Hold") != "ON" {
+		t.Errorf("Expected compliance retention and a legal hold on the record, but got %v", record)
+	}
+	retainUntil, err := time.Parse(time.RFC3339, record.Get("X-Amz-Object-Lock-Retain-Until-Date"))
+	if err != nil || retainUntil.Before(started.Add(23*time.Hour)) {
+		t.Errorf("Expected the record to be retained for a day, but got %q (%v)", record.Get("X-Amz-Object-Lock-Retain-Until-Date"), err)
+	}
+	if record.Get("Content-Md5") == "" {
+		t.Errorf("Expected a Content-MD5 on the locked upload")
+	}
+	if headers[1].Get("X-Amz-Object-Lock-Mode") != "" {
+		t.Errorf("Expected no retention on objects that are not records, but got %v", headers[1])
+	}
+}
+
+// TestS3Check validates the startup check of the bucket
+func TestS3Check(t *testing.T) {
+	tests := []struct {
+		name        string
+		lockEnabled bool
+		config      S3Config
+		wantErr     bool
+	}{
+		{name: "No object lock needed", lockEnabled: false, config: S3Config{}, wantErr: false},
+		{name: "Object lock enabled", lockEnabled: true, config: S3Config{ObjectLockMode: "GOVERNANCE", RetentionPeriod: time.Hour}, wantErr: false},
+		{name: "Object lock disabled", lockEnabled: false, config: S3Config{ObjectLockMode: "GOVERNANCE", RetentionPeriod: time.Hour}, wantErr: true},
+		{name: "Legal hold without object lock", lockEnabled: false, config: S3Config{LegalHold: true}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockServer, _ := newObjectLockMockServer(t, test.lockEnabled)
+			backend := newTestS3WithConfig(t, mockServer, test.config)
+			if err := Check(context.Background(), backend); (err != nil) != test.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+
+	t.Run("Missing bucket", func(t *testing.T) {
+		mockServer, _ := newObjectLockMockServer(t, true)
+		backend := newTestS3WithConfig(t, mockServer, S3Config{})
+		backend.bucket = "missing"
+		if err := backend.Check(context.Background()); err == nil {
+			t.Errorf("Expected Check() to fail for a missing bucket")
+		}
+	})
+}
@@ -0,0 +1,353 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSFTPPort is used when an SFTP address does not include a port
+const defaultSFTPPort = "22"
+
+// defaultSFTPTimeout bounds connecting and completing the SSH handshake unless overridden in SFTPConfig
+const defaultSFTPTimeout = 30 * time.Second
+
+// SFTPConfig Where and how to connect to an SFTP server
+type SFTPConfig struct {
+	Address        string // Host and optional port of the server
+	User           string
+	PrivateKeyPath string // OpenSSH or PEM private key used to log in
+	Passphrase     string // Passphrase of the private key, if it has one
+	KnownHostsPath string // known_hosts file the server's host key must be listed in
+	RemoteDir      string // Directory on the server objects are stored under
+	Timeout        time.Duration
+}
+
+// SFTP A Backend that stores objects as files under a directory on an SFTP server
+type SFTP struct {
+	address      string
+	user         string
+	remoteDir    string
+	clientConfig *ssh.ClientConfig
+	mu           sync.Mutex
+	sshClient    *ssh.Client
+	sftpClient   *sftp.Client
+}
+
+// NewSFTP creates a Backend storing objects on an SFTP server. It reads the key files but does not connect until first used.
+func NewSFTP(config SFTPConfig) (*SFTP, error) {
+	if config.Address == "" || config.User == "" {
+		return nil, fmt.Errorf("sftp address and user must both be set")
+	}
+	if config.KnownHostsPath == "" {
+		return nil, fmt.Errorf("sftp known_hosts file must be set so the server can be verified")
+	}
+	address := config.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, defaultSFTPPort)
+	}
+
+	privateKey, err := os.ReadFile(config.PrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sftp private key: %w", err)
+	}
+	var signer ssh.Signer
+	if config.Passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(privateKey, []byte(config.Passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(privateKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sftp private key %s: %w", config.PrivateKeyPath, err)
+	}
+	hostKeyCallback, err := knownhosts.New(config.KnownHostsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sftp known_hosts file: %w", err)
+	}
+
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = defaultSFTPTimeout
+	}
+	return &SFTP{
+		address:   address,
+		user:      config.User,
+		remoteDir: path.Clean("/" + strings.Trim(config.RemoteDir, "/")),
+		clientConfig: &ssh.ClientConfig{
+			User:            config.User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         timeout,
+		},
+	}, nil
+}
+
+// connect returns the open SFTP session, logging in first if there is none
+func (s *SFTP) connect(ctx context.Context) (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sftpClient != nil {
+		return s.sftpClient, nil
+	}
+
+	dialer := net.Dialer{Timeout: s.clientConfig.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to sftp server %s: %w", s.address, err)
+	}
+	// Bound the handshake, since it does not watch the context
+	_ = conn.SetDeadline(time.Now().Add(s.clientConfig.Timeout))
+	sshConn, channels, requests, err := ssh.NewClientConn(conn, s.address, s.clientConfig)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to log in to sftp server %s: %w", s.address, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	sshClient := ssh.NewClient(sshConn, channels, requests)
+	sftpClient, err := sftp.NewClient(sshClient)
+	if err != nil {
+		_ = sshClient.Close()
+		return nil, fmt.Errorf("failed to start sftp session on %s: %w", s.address, err)
+	}
+	s.sshClient, s.sftpClient = sshClient, sftpClient
+	return sftpClient, nil
+}
+
+// Close logs out of the SFTP server. The next operation logs in again.
+func (s *SFTP) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sftpClient == nil {
+		return nil
+	}
+	_ = s.sftpClient.Close()
+	err := s.sshClient.Close()
+	s.sshClient, s.sftpClient = nil, nil
+	return err
+}
+
+// Location returns the sftp:// URL of key
+func (s *SFTP) Location(key string) string {
+	return "sftp://" + s.user + "@" + s.address + path.Join(s.remoteDir, key)
+}
+
+// remotePath returns the path on the server of key after checking it stays inside the remote directory
+func (s *SFTP) remotePath(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(s.remoteDir, cleaned), nil
+}
+
+// Put uploads r to a temporary name next to its destination and renames it into place on the server
+func (s *SFTP) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	destinationPath, err := s.remotePath(key)
+	if err != nil {
+		return err
+	}
+	client, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	parentDir := path.Dir(destinationPath)
+	if err := client.MkdirAll(parentDir); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", s.Location(path.Dir(key)), err)
+	}
+
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return fmt.Errorf("failed to name a temporary file for %s: %w", s.Location(key), err)
+	}
+	tempPath := path.Join(parentDir, PartialFilePrefix+hex.EncodeToString(random)+PartialFileSuffix)
+	tempFile, err := client.Create(tempPath)
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary file for %s: %w", s.Location(key), err)
+	}
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		_ = tempFile.Close()
+		if err := client.Remove(tempPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: failed to remove partial upload %s: %v", tempPath, err)
+		}
+	}()
+
+	written, err := io.Copy(tempFile, contextReader{ctx: ctx, Reader: r})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", s.Location(key), err)
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("failed to upload %s: expected %d bytes but sent %d", s.Location(key), size, written)
+	}
+	if err := tempFile.Close(); err != nil {
+		return fmt.Errorf("failed to finish uploading %s: %w", s.Location(key), err)
+	}
+
+	if err := moveIntoPlace(client, tempPath, destinationPath); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", s.Location(key), err)
+	}
+	committed = true
+	return nil
+}
+
+// posixRenameExtension is the OpenSSH extension that renames over an existing file atomically
+const posixRenameExtension = "posix-rename@openssh.com"
+
+// sftpRenamer The calls moveIntoPlace makes on an SFTP client
+type sftpRenamer interface {
+	HasExtension(name string) (string, bool)
+	PosixRename(oldname string, newname string) error
+	Rename(oldname string, newname string) error
+	Lstat(p string) (os.FileInfo, error)
+	Remove(p string) error
+}
+
+// moveIntoPlace renames tempPath to destinationPath, replacing any file already there. Servers without the OpenSSH
+// rename refuse to rename over a file, so the existing file is moved aside first and put back if the rename fails.
+func moveIntoPlace(client sftpRenamer, tempPath string, destinationPath string) error {
+	if _, ok := client.HasExtension(posixRenameExtension); ok {
+		return client.PosixRename(tempPath, destinationPath)
+	}
+	if _, err := client.Lstat(destinationPath); errors.Is(err, os.ErrNotExist) {
+		return client.Rename(tempPath, destinationPath)
+	} else if err != nil {
+		return err
+	}
+
+	// The aside name is a partial file name so it is never listed as a finished file
+	asidePath := strings.TrimSuffix(tempPath, PartialFileSuffix) + "-replaced" + PartialFileSuffix
+	if err := client.Rename(destinationPath, asidePath); err != nil {
+		return fmt.Errorf("failed to move the existing file aside: %w", err)
+	}
+	if err := client.Rename(tempPath, destinationPath); err != nil {
+		if restoreErr := client.Rename(asidePath, destinationPath); restoreErr != nil {
+			return fmt.Errorf("%w, and failed to restore the existing file from %s: %v", err, asidePath, restoreErr)
+		}
+		return err
+	}
+	if err := client.Remove(asidePath); err != nil {
+		log.Printf("Warning: failed to remove the replaced file %s: %v", asidePath, err)
+	}
+	return nil
+}
+
+// Stat describes the file for key
+func (s *SFTP) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	remotePath, err := s.remotePath(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	client, err := s.connect(ctx)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := client.Stat(remotePath)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to stat %s: %w", s.Location(key), err)
+	}
+	if info.IsDir() {
+		return ObjectInfo{}, fmt.Errorf("%s is a directory: %w", s.Location(key), ErrNotExist)
+	}
+	return ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// List walks the remote directory for files whose key starts with prefix, in key order, skipping unfinished uploads
+func (s *SFTP) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var objects []ObjectInfo
+	walker := client.Walk(s.remoteDir)
+	for walker.Step() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := walker.Err(); err != nil {
+			if errors.Is(err, os.ErrNotExist) && walker.Path() == s.remoteDir {
+				// Nothing has been stored yet
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to list %s: %w", s.Location(""), err)
+		}
+		info := walker.Stat()
+		name := info.Name()
+		if info.IsDir() || (strings.HasPrefix(name, PartialFilePrefix) && strings.HasSuffix(name, PartialFileSuffix)) {
+			continue
+		}
+		key := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), s.remoteDir), "/")
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		}
+	}
+	// Servers return directory entries in any order, so match the sorted listings of the other backends
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// Get opens the file for key
+func (s *SFTP) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	remotePath, err := s.remotePath(key)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	file, err := client.Open(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", s.Location(key), err)
+	}
+	return file, nil
+}
+
+// Delete removes the file for key
+func (s *SFTP) Delete(ctx context.Context, key string) error {
+	remotePath, err := s.remotePath(key)
+	if err != nil {
+		return err
+	}
+	client, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err := client.Remove(remotePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", s.Location(key), err)
+	}
+	return nil
+}
+
+// Check logs in and makes sure the remote directory exists or can be created
+func (s *SFTP) Check(ctx context.Context) error {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	if err := client.MkdirAll(s.remoteDir); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", s.Location(""), err)
+	}
+	return nil
+}
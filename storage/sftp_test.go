@@ -0,0 +1,372 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package storage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sftpTestServer An in-process SFTP server serving the local filesystem to one authorized key
+type sftpTestServer struct {
+	address        string
+	privateKeyPath string
+	knownHostsPath string
+}
+
+// newSFTPTestServer starts an SFTP server on a random local port and writes a client key and known_hosts file for it
+func newSFTPTestServer(t *testing.T) sftpTestServer {
+	keyDir := t.TempDir()
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("Failed to load host key: %v", err)
+	}
+	clientPublicKey, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate client key: %v", err)
+	}
+	authorizedKey, err := ssh.NewPublicKey(clientPublicKey)
+	if err != nil {
+		t.Fatalf("Failed to load client key: %v", err)
+	}
+	clientPEM, err := ssh.MarshalPrivateKey(clientKey, "")
+	if err != nil {
+		t.Fatalf("Failed to encode client key: %v", err)
+	}
+	privateKeyPath := filepath.Join(keyDir, "id_ed25519")
+	if err := os.WriteFile(privateKeyPath, pem.EncodeToMemory(clientPEM), 0600); err != nil {
+		t.Fatalf("Failed to write client key: %v", err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "pgibbons" && string(key.Marshal()) == string(authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized key")
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen for SFTP connections: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTPConn(conn, serverConfig)
+		}
+	}()
+
+	knownHostsPath := filepath.Join(keyDir, "known_hosts")
+	knownHostsLine := knownhosts.Line([]string{knownhosts.Normalize(listener.Addr().String())}, hostSigner.PublicKey())
+	if err := os.WriteFile(knownHostsPath, []byte(knownHostsLine+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write known_hosts: %v", err)
+	}
+	return sftpTestServer{address: listener.Addr().String(), privateKeyPath: privateKeyPath, knownHostsPath: knownHostsPath}
+}
+
+// serveSFTPConn completes the SSH handshake on conn and serves SFTP on every session channel opened on it
+func serveSFTPConn(conn net.Conn, serverConfig *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, serverConfig)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for request := range channelRequests {
+				_ = request.Reply(request.Type == "subsystem" && string(request.Payload[4:]) == "sftp", nil)
+			}
+		}()
+		go func() {
+			server, err := sftp.NewServer(channel)
+			if err != nil {
+				_ = channel.Close()
+				return
+			}
+			_ = server.Serve()
+			_ = server.Close()
+		}()
+	}
+}
+
+// newTestSFTP creates an SFTP backend for the test server storing objects under remoteDir
+func newTestSFTP(t *testing.T, server sftpTestServer, remoteDir string) *SFTP {
+	backend, err := NewSFTP(SFTPConfig{
+		Address:        server.address,
+		User:           "pgibbons",
+		PrivateKeyPath: server.privateKeyPath,
+		KnownHostsPath: server.knownHostsPath,
+		RemoteDir:      remoteDir,
+	})
+	if err != nil {
+		t.Fatalf("NewSFTP() returned an unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = backend.Close() })
+	return backend
+}
+
+// TestSFTP validates storing, describing, listing, reading and deleting files on an SFTP server
+func TestSFTP(t *testing.T) {
+	ctx := context.Background()
+	server := newSFTPTestServer(t)
+	remoteDir := filepath.Join(t.TempDir(), "archive")
+	backend := newTestSFTP(t, server, remoteDir)
+
+	if err := backend.Check(ctx); err != nil {
+		t.Fatalf("Check() returned an unexpected error: %v", err)
+	}
+	objects, err := backend.List(ctx, "")
+	if err != nil || len(objects) != 0 {
+		t.Fatalf("Expected an empty directory to list nothing, but got %v (%v)", objects, err)
+	}
+
+	content := "Guns. Lots of guns."
+	for _, key := range []string{"2025/01/BOOK_1.pdf", "2025/02/BOOK_2.pdf", "4473.pdf"} {
+		if err := backend.Put(ctx, key, strings.NewReader(content), int64(len(content))); err != nil {
+			t.Fatalf("Put(%s) returned an unexpected error: %v", key, err)
+		}
+	}
+	// Replacing a file goes through the same rename
+	if err := backend.Put(ctx, "4473.pdf", strings.NewReader(content+"!"), int64(len(content)+1)); err != nil {
+		t.Fatalf("Put() failed to replace a file: %v", err)
+	}
+
+	stored, err := os.ReadFile(filepath.Join(remoteDir, "2025", "01", "BOOK_1.pdf"))
+	if err != nil || string(stored) != content {
+		t.Errorf("Expected the file to be stored under the remote directory, but got %q (%v)", stored, err)
+	}
+	info, err := backend.Stat(ctx, "4473.pdf")
+	if err != nil || info.Size != int64(len(content)+1) {
+		t.Errorf("Stat() = %+v, %v", info, err)
+	}
+	if _, err := backend.Stat(ctx, "2025"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Expected a directory to be reported as missing, but got %v", err)
+	}
+
+	objects, err = backend.List(ctx, "2025/")
+	if err != nil {
+		t.Fatalf("List() returned an unexpected error: %v", err)
+	}
+	if len(objects) != 2 || objects[0].Key != "2025/01/BOOK_1.pdf" || objects[1].Key != "2025/02/BOOK_2.pdf" {
+		t.Errorf("List() = %+v", objects)
+	}
+	// No unfinished uploads should be left behind
+	if all, _ := backend.List(ctx, ""); len(all) != 3 {
+		t.Errorf("Expected three files, but found %+v", all)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(remoteDir, "*", "*", PartialFilePrefix+"*")); len(matches) != 0 {
+		t.Errorf("Expected no partial uploads to remain, but found %v", matches)
+	}
+
+	reader, err := backend.Get(ctx, "2025/02/BOOK_2.pdf")
+	if err != nil {
+		t.Fatalf("Get() returned an unexpected error: %v", err)
+	}
+	read, _ := io.ReadAll(reader)
+	_ = reader.Close()
+	if string(read) != content {
+		t.Errorf("Get() read %q", read)
+	}
+
+	if err := Append(ctx, backend, "manifest.jsonl", []byte("one\n")); err != nil {
+		t.Fatalf("Append() returned an unexpected error: %v", err)
+	}
+	if err := Append(ctx, backend, "manifest.jsonl", []byte("two\n")); err != nil {
+		t.Fatalf("Append() returned an unexpected error: %v", err)
+	}
+	if manifest, err := ReadAll(ctx, backend, "manifest.jsonl"); err != nil || string(manifest) != "one\ntwo\n" {
+		t.Errorf("Expected both appended lines, but got %q (%v)", manifest, err)
+	}
+
+	if err := backend.Delete(ctx, "4473.pdf"); err != nil {
+		t.Errorf("Delete() returned an unexpected error: %v", err)
+	}
+	if err := backend.Delete(ctx, "4473.pdf"); err != nil {
+		t.Errorf("Expected deleting a missing file to succeed, but got %v", err)
+	}
+	if _, err := backend.Get(ctx, "4473.pdf"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Expected a deleted file to be missing, but got %v", err)
+	}
+	if _, err := backend.Stat(ctx, "../escape.pdf"); err == nil {
+		t.Errorf("Expected a key outside the remote directory to be refused")
+	}
+
+	expectedLocation := "sftp://pgibbons@" + server.address + filepath.ToSlash(remoteDir) + "/4473.pdf"
+	if location := backend.Location("4473.pdf"); location != expectedLocation {
+		t.Errorf("Location() = %q, want %q", location, expectedLocation)
+	}
+}
+
+// TestSFTPPut_Failed validates that a failed upload leaves nothing behind on the server
+func TestSFTPPut_Failed(t *testing.T) {
+	ctx := context.Background()
+	remoteDir := t.TempDir()
+	backend := newTestSFTP(t, newSFTPTestServer(t), remoteDir)
+
+	if err := backend.Put(ctx, "BOOK.pdf", &failingReader{}, -1); err == nil {
+		t.Fatalf("Expected Put() to fail when the reader does")
+	}
+	if err := backend.Put(ctx, "BOOK.pdf", strings.NewReader("Guns."), 100); err == nil {
+		t.Fatalf("Expected Put() to fail when the size does not match")
+	}
+	entries, err := os.ReadDir(remoteDir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("Expected the remote directory to be empty, but found %v (%v)", entries, err)
+	}
+}
+
+// plainRenamer An SFTP server without the OpenSSH rename, whose renames refuse to overwrite, holding files by path
+type plainRenamer struct {
+	files      map[string]string
+	failRename string // A path that can't be renamed, like a file the server has locked
+}
+
+func (p *plainRenamer) HasExtension(string) (string, bool) { return "", false }
+func (p *plainRenamer) PosixRename(string, string) error {
+	return errors.New("posix-rename@openssh.com is not supported")
+}
+func (p *plainRenamer) Rename(oldname string, newname string) error {
+	if _, ok := p.files[newname]; ok || oldname == p.failRename {
+		return errors.New("failure")
+	}
+	content, ok := p.files[oldname]
+	if !ok {
+		return os.ErrNotExist
+	}
+	delete(p.files, oldname)
+	p.files[newname] = content
+	return nil
+}
+func (p *plainRenamer) Lstat(path string) (os.FileInfo, error) {
+	if _, ok := p.files[path]; !ok {
+		return nil, os.ErrNotExist
+	}
+	return nil, nil
+}
+func (p *plainRenamer) Remove(path string) error {
+	delete(p.files, path)
+	return nil
+}
+
+// TestMoveIntoPlace validates that a server without the OpenSSH rename never loses the file being replaced
+func TestMoveIntoPlace(t *testing.T) {
+	tempPath := "/archive/" + PartialFilePrefix + "1234" + PartialFileSuffix
+	tests := []struct {
+		name       string
+		files      map[string]string
+		failRename string
+		wantErr    bool
+		want       map[string]string
+	}{
+		{
+			name:  "New file",
+			files: map[string]string{tempPath: "new"},
+			want:  map[string]string{"/archive/manifest.jsonl": "new"},
+		},
+		{
+			name:  "Replaced file",
+			files: map[string]string{tempPath: "new", "/archive/manifest.jsonl": "old"},
+			want:  map[string]string{"/archive/manifest.jsonl": "new"},
+		},
+		{
+			name:       "Failed rename restores the replaced file",
+			files:      map[string]string{tempPath: "new", "/archive/manifest.jsonl": "old"},
+			failRename: tempPath,
+			wantErr:    true,
+			want:       map[string]string{tempPath: "new", "/archive/manifest.jsonl": "old"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := &plainRenamer{files: test.files, failRename: test.failRename}
+			if err := moveIntoPlace(server, tempPath, "/archive/manifest.jsonl"); (err != nil) != test.wantErr {
+				t.Fatalf("moveIntoPlace() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if len(server.files) != len(test.want) {
+				t.Errorf("Expected %v, but the server holds %v", test.want, server.files)
+			}
+			for path, content := range test.want {
+				if server.files[path] != content {
+					t.Errorf("Expected %s to hold %q, but the server holds %v", path, content, server.files)
+				}
+			}
+		})
+	}
+}
+
+// TestSFTP_UnknownHostKey validates that a server whose host key is not in known_hosts is refused
+func TestSFTP_UnknownHostKey(t *testing.T) {
+	server := newSFTPTestServer(t)
+	// Pin the key of a different server to this server's address
+	contents, err := os.ReadFile(newSFTPTestServer(t).knownHostsPath)
+	if err != nil {
+		t.Fatalf("Failed to read known_hosts: %v", err)
+	}
+	otherKey := strings.SplitN(string(contents), " ", 2)[1]
+	server.knownHostsPath = filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(server.knownHostsPath, []byte(knownhosts.Normalize(server.address)+" "+otherKey), 0600); err != nil {
+		t.Fatalf("Failed to write known_hosts: %v", err)
+	}
+
+	backend := newTestSFTP(t, server, t.TempDir())
+	var keyError *knownhosts.KeyError
+	if err := backend.Check(context.Background()); !errors.As(err, &keyError) {
+		t.Errorf("Expected the host key to be rejected, but got %v", err)
+	}
+}
+
+// TestNewSFTP_Invalid validates that incomplete SFTP settings are refused
+func TestNewSFTP_Invalid(t *testing.T) {
+	server := newSFTPTestServer(t)
+	tests := []struct {
+		name   string
+		config SFTPConfig
+	}{
+		{name: "Missing address", config: SFTPConfig{User: "pgibbons", PrivateKeyPath: server.privateKeyPath, KnownHostsPath: server.knownHostsPath}},
+		{name: "Missing known_hosts", config: SFTPConfig{Address: server.address, User: "pgibbons", PrivateKeyPath: server.privateKeyPath}},
+		{name: "Missing private key", config: SFTPConfig{Address: server.address, User: "pgibbons", PrivateKeyPath: filepath.Join(t.TempDir(), "id_ed25519"), KnownHostsPath: server.knownHostsPath}},
+		{name: "Unparsable private key", config: SFTPConfig{Address: server.address, User: "pgibbons", PrivateKeyPath: server.knownHostsPath, KnownHostsPath: server.knownHostsPath}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewSFTP(test.config); err == nil {
+				t.Errorf("Expected NewSFTP() to fail, but it did not")
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotExist is returned, possibly wrapped, when an object does not exist
+var ErrNotExist = fs.ErrNotExist
+
+// PartialFilePrefix and PartialFileSuffix mark in-progress writes so they are never mistaken for a finished file
+const (
+	PartialFilePrefix = ".fbdownloader-"
+	PartialFileSuffix = ".partial"
+)
+
+// ObjectInfo Describes a stored object
+type ObjectInfo struct {
+	Key       string // Slash separated path relative to the root of the backend
+	Size      int64
+	ModTime   time.Time
+	Encrypted bool // Whether the object is stored encrypted, so Size is its encrypted size rather than the size of its contents
+}
+
+// Backend A place archived records can be stored. Keys are slash separated paths relative to the root of the backend.
+type Backend interface {
+	// Put stores size bytes read from r under key, replacing any existing object. A size of -1 means the size is unknown.
+	// The object must not be visible under key until it has been completely written.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Stat describes the object stored under key, returning ErrNotExist if there is none
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// List describes every object whose key starts with prefix, ordered by key
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Get opens the object stored under key for reading, returning ErrNotExist if there is none
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object stored under key. Deleting an object that does not exist is not an error.
+	Delete(ctx context.Context, key string) error
+	// Location describes where key is stored, such as a file path or URL, for logs and errors
+	Location(key string) string
+}
+
+// Appender is implemented by backends that can append to an object in place
+type Appender interface {
+	// Append adds data to the end of the object stored under key, creating it if needed
+	Append(ctx context.Context, key string, data []byte) error
+}
+
+// Retainer is implemented by backends that can protect archived records from being altered or deleted
+type Retainer interface {
+	// PutRetained stores an object like Put and protects it for the backend's configured retention period
+	PutRetained(ctx context.Context, key string, r io.Reader, size int64) error
+}
+
+// Checker is implemented by backends that can check they are usable before anything is stored in them
+type Checker interface {
+	// Check reports why the backend can't be used, or nil if it can
+	Check(ctx context.Context) error
+}
+
+// PutRecord stores an archived record such as a bound book, protecting it from changes if the backend supports retention
+func PutRecord(ctx context.Context, backend Backend, key string, r io.Reader, size int64) error {
+	if retainer, ok := backend.(Retainer); ok {
+		return retainer.PutRetained(ctx, key, r, size)
+	}
+	return backend.Put(ctx, key, r, size)
+}
+
+// Check checks that backend is usable if it supports checking, and otherwise assumes it is
+func Check(ctx context.Context, backend Backend) error {
+	if checker, ok := backend.(Checker); ok {
+		return checker.Check(ctx)
+	}
+	return nil
+}
+
+// Append adds data to the end of the object stored under key. Backends that can't append in place have the
+// object rewritten with data added to the end.
+func Append(ctx context.Context, backend Backend, key string, data []byte) error {
+	if appender, ok := backend.(Appender); ok {
+		return appender.Append(ctx, key, data)
+	}
+	return appendByRewriting(ctx, backend, key, data)
+}
+
+// appendByRewriting adds data to the end of the object stored under key by reading it and storing it again
+func appendByRewriting(ctx context.Context, backend Backend, key string, data []byte) error {
+	existing, err := ReadAll(ctx, backend, key)
+	if err != nil && !errors.Is(err, ErrNotExist) {
+		return err
+	}
+	combined := append(existing, data...)
+	return backend.Put(ctx, key, bytes.NewReader(combined), int64(len(combined)))
+}
+
+// ReadAll returns the contents of the object stored under key
+func ReadAll(ctx context.Context, backend Backend, key string) ([]byte, error) {
+	object, err := backend.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := object.Close(); err != nil {
+			log.Printf("Warning: failed to close %s: %v", backend.Location(key), err)
+		}
+	}()
+	content, err := io.ReadAll(object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", backend.Location(key), err)
+	}
+	return content, nil
+}
+
+// cleanKey checks that key names an object inside the backend and returns it in canonical form
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean(key)
+	if key == "" || cleaned == "." || path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return cleaned, nil
+}
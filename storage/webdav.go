@@ -0,0 +1,428 @@
+/*
+Copyright © 2025 Route 1337 LLC.
+This file is part of Fastbound Downloader.
+*/
+
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webDAVPropfindBody asks a WebDAV server for only the properties needed to describe an object
+const webDAVPropfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/><d:getlastmodified/></d:prop></d:propfind>`
+
+// WebDAVConfig Where and how to connect to a WebDAV share such as Nextcloud
+type WebDAVConfig struct {
+	URL         string // URL of the directory objects are stored under, such as https://cloud.example.com/remote.php/dav/files/user/books
+	Username    string // Username and Password log in with basic auth
+	Password    string
+	BearerToken string // Sent as an Authorization: Bearer header instead of basic auth
+	CAFile      string // PEM file of extra certificate authorities to trust, for shares with a private CA
+}
+
+// WebDAV A Backend that stores objects as files under a directory of a WebDAV share
+type WebDAV struct {
+	client      *http.Client
+	baseURL     *url.URL
+	username    string
+	password    string
+	bearerToken string
+	createdDirs sync.Map // Directories already created by this backend, so each is only created once
+}
+
+// NewWebDAV creates a Backend storing objects on a WebDAV share. It does not contact the server.
+func NewWebDAV(config WebDAVConfig) (*WebDAV, error) {
+	baseURL, err := url.Parse(strings.TrimSuffix(config.URL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid webdav url %q: %w", config.URL, err)
+	}
+	if baseURL.Scheme != "http" && baseURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid webdav url %q: scheme must be http or https", config.URL)
+	}
+	if baseURL.User != nil {
+		return nil, fmt.Errorf("invalid webdav url %q: use username and password rather than credentials in the url", config.URL)
+	}
+	if config.BearerToken != "" && (config.Username != "" || config.Password != "") {
+		return nil, fmt.Errorf("webdav can log in with a username and password or a bearer token, not both")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.CAFile != "" {
+		caCertificates, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read webdav ca file: %w", err)
+		}
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(caCertificates) {
+			return nil, fmt.Errorf("webdav ca file %s does not contain any PEM certificates", config.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+	}
+
+	return &WebDAV{
+		client:      &http.Client{Transport: transport},
+		baseURL:     baseURL,
+		username:    config.Username,
+		password:    config.Password,
+		bearerToken: config.BearerToken,
+	}, nil
+}
+
+// Location returns the URL of key
+func (w *WebDAV) Location(key string) string {
+	location := *w.baseURL
+	location.Path = path.Join(w.baseURL.Path, key)
+	location.RawPath = ""
+	return location.String()
+}
+
+// objectURL returns the URL of key after checking it stays inside the base directory
+func (w *WebDAV) objectURL(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return w.Location(cleaned), nil
+}
+
+// do sends a request with the configured credentials
+func (w *WebDAV) do(ctx context.Context, method string, target string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil && size >= 0 {
+		request.ContentLength = size
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	if w.bearerToken != "" {
+		request.Header.Set("Authorization", "Bearer "+w.bearerToken)
+	} else if w.username != "" || w.password != "" {
+		request.SetBasicAuth(w.username, w.password)
+	}
+	return w.client.Do(request)
+}
+
+// closeResponse discards whatever is left of a response so its connection can be reused
+func closeResponse(response *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+	_ = response.Body.Close()
+}
+
+// statusError describes a request that got an unexpected response, marking missing objects with ErrNotExist
+func (w *WebDAV) statusError(action string, key string, response *http.Response) error {
+	switch response.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("failed to %s %s: %w", action, w.Location(key), ErrNotExist)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("failed to %s %s: the server refused the credentials (%s)", action, w.Location(key), response.Status)
+	default:
+		return fmt.Errorf("failed to %s %s: %s", action, w.Location(key), response.Status)
+	}
+}
+
+// makeDirs creates every directory from the base directory down to dir, which is relative to it
+func (w *WebDAV) makeDirs(ctx context.Context, dir string) error {
+	if dir == "." || dir == "" {
+		return nil
+	}
+	current := ""
+	for _, part := range strings.Split(dir, "/") {
+		current = path.Join(current, part)
+		if _, ok := w.createdDirs.Load(current); ok {
+			continue
+		}
+		response, err := w.do(ctx, "MKCOL", w.Location(current)+"/", nil, -1, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", w.Location(current), err)
+		}
+		closeResponse(response)
+		// 405 Method Not Allowed means the directory is already there
+		if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusMethodNotAllowed {
+			return w.statusError("create directory", current, response)
+		}
+		w.createdDirs.Store(current, true)
+	}
+	return nil
+}
+
+// Put uploads r to a temporary name next to its destination and moves it into place on the server
+func (w *WebDAV) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	destinationURL, err := w.objectURL(key)
+	if err != nil {
+		return err
+	}
+	key, _ = cleanKey(key)
+	if err := w.makeDirs(ctx, path.Dir(key)); err != nil {
+		return err
+	}
+
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return fmt.Errorf("failed to name a temporary file for %s: %w", w.Location(key), err)
+	}
+	tempKey := path.Join(path.Dir(key), PartialFilePrefix+hex.EncodeToString(random)+PartialFileSuffix)
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		// Use a fresh context so a cancelled upload is still cleaned up
+		cleanupContext, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		if err := w.Delete(cleanupContext, tempKey); err != nil {
+			log.Printf("Warning: failed to remove partial upload %s: %v", w.Location(tempKey), err)
+		}
+	}()
+	counter := &countingReader{Reader: r}
+	response, err := w.do(ctx, http.MethodPut, w.Location(tempKey), counter, size, nil)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", w.Location(key), err)
+	}
+	closeResponse(response)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return w.statusError("upload", key, response)
+	}
+	if size >= 0 && counter.read != size {
+		return fmt.Errorf("failed to upload %s: expected %d bytes but sent %d", w.Location(key), size, counter.read)
+	}
+
+	response, err = w.do(ctx, "MOVE", w.Location(tempKey), nil, -1, http.Header{
+		"Destination": {destinationURL},
+		"Overwrite":   {"T"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", w.Location(key), err)
+	}
+	closeResponse(response)
+	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusNoContent {
+		return w.statusError("move into place", key, response)
+	}
+	committed = true
+	return nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	io.Reader
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+// webDAVMultistatus The body of a PROPFIND response
+type webDAVMultistatus struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Propstats []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				ContentLength string `xml:"DAV: getcontentlength"`
+				LastModified  string `xml:"DAV: getlastmodified"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// webDAVEntry One file or directory found by PROPFIND
+type webDAVEntry struct {
+	key   string
+	isDir bool
+	info  ObjectInfo
+}
+
+// propfind describes the object or directory at key, which may be "" for the base directory, and with depth 1 its children
+func (w *WebDAV) propfind(ctx context.Context, key string, depth string) ([]webDAVEntry, error) {
+	target := w.Location(key)
+	if depth != "0" {
+		target += "/"
+	}
+	response, err := w.do(ctx, "PROPFIND", target, strings.NewReader(webDAVPropfindBody), int64(len(webDAVPropfindBody)), http.Header{
+		"Depth":        {depth},
+		"Content-Type": {"application/xml; charset=utf-8"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe %s: %w", w.Location(key), err)
+	}
+	defer closeResponse(response)
+	if response.StatusCode != http.StatusMultiStatus {
+		return nil, w.statusError("describe", key, response)
+	}
+	var multistatus webDAVMultistatus
+	if err := xml.NewDecoder(response.Body).Decode(&multistatus); err != nil {
+		return nil, fmt.Errorf("failed to read the description of %s: %w", w.Location(key), err)
+	}
+
+	var entries []webDAVEntry
+	for _, item := range multistatus.Responses {
+		href, err := url.Parse(item.Href)
+		if err != nil {
+			return nil, fmt.Errorf("server described %s with an unreadable href %q: %w", w.Location(key), item.Href, err)
+		}
+		entryKey := strings.Trim(strings.TrimPrefix(href.Path, w.baseURL.Path), "/")
+		entry := webDAVEntry{key: entryKey, info: ObjectInfo{Key: entryKey}}
+		for _, propstat := range item.Propstats {
+			if !strings.Contains(propstat.Status, " 200") {
+				continue
+			}
+			entry.isDir = entry.isDir || propstat.Prop.ResourceType.Collection != nil
+			if size, err := strconv.ParseInt(propstat.Prop.ContentLength, 10, 64); err == nil {
+				entry.info.Size = size
+			}
+			if modTime, err := http.ParseTime(propstat.Prop.LastModified); err == nil {
+				entry.info.ModTime = modTime
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Stat describes the file for key with a PROPFIND request
+func (w *WebDAV) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	if _, err := w.objectURL(key); err != nil {
+		return ObjectInfo{}, err
+	}
+	entries, err := w.propfind(ctx, key, "0")
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if len(entries) == 0 {
+		return ObjectInfo{}, fmt.Errorf("failed to describe %s: the server returned nothing", w.Location(key))
+	}
+	if entries[0].isDir {
+		return ObjectInfo{}, fmt.Errorf("%s is a directory: %w", w.Location(key), ErrNotExist)
+	}
+	info := entries[0].info
+	info.Key = key
+	return info, nil
+}
+
+// List describes every file whose key starts with prefix, in key order, skipping unfinished uploads.
+// Directories are listed one level at a time because many servers refuse infinite depth PROPFIND requests.
+func (w *WebDAV) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	pending := []string{""}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+		entries, err := w.propfind(ctx, dir, "1")
+		if errors.Is(err, ErrNotExist) && dir == "" {
+			// Nothing has been stored yet
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.key == dir {
+				continue
+			}
+			if entry.isDir {
+				// Only walk directories that could hold a matching key
+				if strings.HasPrefix(entry.key+"/", prefix) || strings.HasPrefix(prefix, entry.key+"/") {
+					pending = append(pending, entry.key)
+				}
+				continue
+			}
+			name := path.Base(entry.key)
+			if strings.HasPrefix(name, PartialFilePrefix) && strings.HasSuffix(name, PartialFileSuffix) {
+				continue
+			}
+			if strings.HasPrefix(entry.key, prefix) {
+				objects = append(objects, entry.info)
+			}
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// Get downloads the file for key
+func (w *WebDAV) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	objectURL, err := w.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	response, err := w.do(ctx, http.MethodGet, objectURL, nil, -1, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", w.Location(key), err)
+	}
+	if response.StatusCode != http.StatusOK {
+		closeResponse(response)
+		return nil, w.statusError("download", key, response)
+	}
+	return response.Body, nil
+}
+
+// Delete removes the file for key
+func (w *WebDAV) Delete(ctx context.Context, key string) error {
+	objectURL, err := w.objectURL(key)
+	if err != nil {
+		return err
+	}
+	response, err := w.do(ctx, http.MethodDelete, objectURL, nil, -1, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", w.Location(key), err)
+	}
+	closeResponse(response)
+	if response.StatusCode == http.StatusNotFound || (response.StatusCode >= 200 && response.StatusCode <= 299) {
+		return nil
+	}
+	return w.statusError("delete", key, response)
+}
+
+// Check logs in and makes sure the base directory exists, creating it if its parent does
+func (w *WebDAV) Check(ctx context.Context) error {
+	entries, err := w.propfind(ctx, "", "0")
+	if errors.Is(err, ErrNotExist) {
+		response, err := w.do(ctx, "MKCOL", w.Location("")+"/", nil, -1, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", w.Location(""), err)
+		}
+		closeResponse(response)
+		if response.StatusCode != http.StatusCreated {
+			return w.statusError("create directory", "", response)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 || !entries[0].isDir {
+		return fmt.Errorf("%s is not a directory", w.Location(""))
+	}
+	return nil
+}